@@ -202,18 +202,21 @@ func BenchmarkAbiOriginalNames(b *testing.B) {
 	// in _originalNamePairs as of November 2024, so it's a realistic figure.
 	// Structs with tens of fields are also relatively normal.
 	salt := []byte("some salt bytes")
+	var pairs []string
 	for n := range 2000 {
 		name := fmt.Sprintf("name_%d", n)
 		garbled := hashWithCustomSalt(salt, name)
-		_originalNamePairs = append(_originalNamePairs, garbled, name)
+		pairs = append(pairs, garbled, name)
 	}
+	_originalNamePairsKey = 12345
+	_originalNamePairsData = string(encryptNamePairs(pairs, _originalNamePairsKey))
 	_originalNamesInit()
 	// Pick twenty obfuscated names at random to use as inputs below.
 	// Use a deterministic random source so it's stable between benchmark runs.
 	rnd := rand.New(rand.NewPCG(1, 2))
 	var chosen []string
-	for i := 0; i < len(_originalNamePairs); i += 2 {
-		chosen = append(chosen, _originalNamePairs[i])
+	for i := 0; i < len(pairs); i += 2 {
+		chosen = append(chosen, pairs[i])
 	}
 	rnd.Shuffle(len(chosen), func(i, j int) {
 		chosen[i], chosen[j] = chosen[j], chosen[i]
@@ -251,6 +254,6 @@ func BenchmarkAbiOriginalNames(b *testing.B) {
 			}
 		}
 	})
-	_originalNamePairs = []string{}
+	_originalNamePairsData = ""
 	_originalNamesReplacer = nil
 }
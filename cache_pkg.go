@@ -107,7 +107,7 @@ func parseFiles(lpkg *listedPackage, dir string, paths []string, mainPatch bool)
 			}
 		} else if mainPackage && reflectPatchFile == "" && !strings.HasPrefix(base, "_cgo_") {
 			// Note that we cannot add our code to e.g. _cgo_gotypes.go.
-			src, err = reflectMainPrePatch(path)
+			src, err = reflectMainPrePatch(path, lpkg)
 			if err != nil {
 				return nil, err
 			}
@@ -167,7 +167,7 @@ func computePkgCache(fsCache *cache.Cache, lpkg *listedPackage, pkg *types.Packa
 		ReflectObjectNames: map[string]string{},
 	}
 	// Stop early if we don't import reflect, e.g. much of std.
-	if !lpkg.hasDep("reflect") {
+	if !lpkg.hasDep("reflect") && !lpkg.hasReflectHints() {
 		return computed, nil
 	}
 	for _, imp := range lpkg.Imports {
@@ -201,7 +201,7 @@ func computePkgCache(fsCache *cache.Cache, lpkg *listedPackage, pkg *types.Packa
 				return nil
 			}
 			// Avoid parsing and typechecking if the dependency doesn't import reflect.
-			if !lpkg.hasDep("reflect") {
+			if !lpkg.hasDep("reflect") && !lpkg.hasReflectHints() {
 				return nil
 			}
 			// Missing or corrupted entry in the cache for a dependency.
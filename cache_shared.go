@@ -56,6 +56,34 @@ type sharedCacheType struct {
 
 	GOGARBLE string
 
+	// InterfaceMethods holds the method names of every interface in the build,
+	// as exported methods with any other name cannot implement an interface.
+	// It is set when -methods is used; see computeInterfaceMethods.
+	InterfaceMethods map[string]bool
+
+	// MethodByNamePackages holds the import paths of the packages whose
+	// exported methods may be looked up via MethodByName, so they are kept.
+	MethodByNamePackages map[string]bool
+
+	// InterfaceMethodsHash is a hash of InterfaceMethods and MethodByNamePackages,
+	// folded into addGarbleToHash when -methods is used.
+	InterfaceMethodsHash []byte
+
+	// PackageConfigs holds the per-package settings from garble.toml,
+	// keyed by GOGARBLE-style patterns; see loadConfig.
+	PackageConfigs map[string]packageConfig
+
+	// ObfuscatorWeights holds the weights of the literal obfuscators from garble.toml,
+	// keyed by their names; see [literals.Register].
+	ObfuscatorWeights map[string]int
+
+	// ReflectHints lists the types from garble.toml which are used via reflection,
+	// in the form "pkg/path.TypeName".
+	ReflectHints []string
+
+	// ConfigHash is a hash of garble.toml, folded into addGarbleToHash.
+	ConfigHash []byte
+
 	// GoCmd is [GoEnv.GOROOT]/bin/go, so that we run exactly the same version
 	// of the Go tool that the original "go build" invocation did.
 	GoCmd string
@@ -66,6 +94,7 @@ type sharedCacheType struct {
 		GOOS   string // the GOOS build target
 		GOARCH string // the GOARCH build target
 
+		GOMOD     string // to find garble.toml; see loadConfig
 		GOVERSION string
 		GOROOT    string
 	}
@@ -266,6 +295,16 @@ func writeFileExclusive(name string, data []byte) error {
 	return err
 }
 
+// packageConfig holds the settings of a [packages."pattern"] table in garble.toml,
+// overriding the garble flags for the matching packages. Nil means unset.
+type packageConfig struct {
+	Literals *bool
+	Lines    *bool
+
+	// Obfuscators pins the literal obfuscators to pick from, by name.
+	Obfuscators []string
+}
+
 // listedPackage contains the 'go list -json -export' fields obtained by the
 // root process, shared with all garble sub-processes via a file.
 type listedPackage struct {
@@ -303,6 +342,10 @@ type listedPackage struct {
 	// ToObfuscate records whether the package should be obfuscated.
 	// When true, GarbleActionID must not be empty.
 	ToObfuscate bool `json:"-"`
+
+	// GarbleKeep holds the names kept via //garble:keep when ToObfuscate is true,
+	// as collected by collectKeptNames. See [transformer.keptObject].
+	GarbleKeep map[string]bool `json:"-"`
 }
 
 func (p *listedPackage) hasDep(path string) bool {
@@ -427,7 +470,7 @@ func linknamedToList() []string {
 }
 
 // appendListedPackages gets information about the current package
-// and all of its dependencies
+// and all of its dependencies.
 func appendListedPackages(packages []string, mainBuild bool) error {
 	startTime := time.Now()
 	args := []string{
@@ -444,6 +487,13 @@ func appendListedPackages(packages []string, mainBuild bool) error {
 	}
 	args = append(args, garbleBuildFlags...)
 	args = append(args, sharedCache.ForwardBuildFlags...)
+	// With -pgo=auto and more than one root package, cmd/go builds the dependencies
+	// of main packages with a default.pgo file as copies like "fmt [test/main]".
+	// The linknamed packages folded in below are extra roots, so always list
+	// the original packages, which the copies are looked up as.
+	// The profile only matters to the compiler, which is given it via -pgoprofile;
+	// see [transformer.loadHotFunc].
+	args = append(args, "-pgo=off")
 
 	if !mainBuild {
 		// If the top-level build included the -mod or -modfile flags,
@@ -494,8 +544,8 @@ func appendListedPackages(packages []string, mainBuild bool) error {
 	var pkgErrors strings.Builder
 	anyToObfuscate := false
 	for dec.More() {
-		var pkg listedPackage
-		if err := dec.Decode(&pkg); err != nil {
+		pkg := new(listedPackage)
+		if err := dec.Decode(pkg); err != nil {
 			return err
 		}
 
@@ -534,8 +584,9 @@ func appendListedPackages(packages []string, mainBuild bool) error {
 			return fmt.Errorf("duplicate package: %q", pkg.ImportPath)
 		}
 		if pkg.BuildID != "" {
-			actionID := decodeBuildIDHash(splitActionID(pkg.BuildID))
-			pkg.GarbleActionID = addGarbleToHash(actionID)
+			if pkg.GarbleActionID, err = garbleActionID(pkg); err != nil {
+				return err
+			}
 		}
 
 		// Decide ToObfuscate as we read each package, to avoid a second pass
@@ -564,16 +615,23 @@ func appendListedPackages(packages []string, mainBuild bool) error {
 		case pkg.Name == "main" && strings.HasSuffix(path, ".test"),
 			path == "command-line-arguments",
 			strings.HasPrefix(path, "plugin/unnamed"),
-			module.MatchPrefixPatterns(sharedCache.GOGARBLE, path):
+			matchGarblePatterns(sharedCache.GOGARBLE, path):
 
 			pkg.ToObfuscate = true
 			anyToObfuscate = true
 			if len(pkg.GarbleActionID) == 0 {
 				return fmt.Errorf("package %q to be obfuscated lacks build id?", pkg.ImportPath)
 			}
+			// The standard library never uses garble's directives.
+			if !pkg.Standard {
+				var err error
+				if pkg.GarbleKeep, err = collectKeptNames(pkg); err != nil {
+					return err
+				}
+			}
 		}
 
-		sharedCache.ListedPackages.set(pkg.ImportPath, &pkg)
+		sharedCache.ListedPackages.set(pkg.ImportPath, pkg)
 	}
 
 	if err := cmd.Wait(); err != nil {
@@ -586,7 +644,7 @@ func appendListedPackages(packages []string, mainBuild bool) error {
 	// Only the top-level build must match packages to obfuscate; the later
 	// runtime-linknamed std fill need not.
 	// Don't error if the user ran: GOGARBLE='*' garble build runtime
-	if mainBuild && !anyToObfuscate && !module.MatchPrefixPatterns(sharedCache.GOGARBLE, "runtime") {
+	if mainBuild && !anyToObfuscate && !matchGarblePatterns(sharedCache.GOGARBLE, "runtime") {
 		return fmt.Errorf("GOGARBLE=%q does not match any packages to be built", sharedCache.GOGARBLE)
 	}
 
@@ -604,6 +662,26 @@ func appendListedPackages(packages []string, mainBuild bool) error {
 	return nil
 }
 
+// matchGarblePatterns reports whether a package path matches a GOGARBLE value.
+// Like GOPRIVATE, it is a comma-separated list of glob patterns matching
+// path prefixes, but patterns starting with "!" exclude the paths they match.
+// A list with only exclusions matches all other paths.
+func matchGarblePatterns(globs, path string) bool {
+	var include, exclude []string
+	for pattern := range strings.SplitSeq(globs, ",") {
+		if pattern, ok := strings.CutPrefix(pattern, "!"); ok {
+			exclude = append(exclude, pattern)
+		} else if pattern != "" {
+			include = append(include, pattern)
+		}
+	}
+	if len(include) == 0 && len(exclude) > 0 {
+		include = append(include, "*")
+	}
+	return module.MatchPrefixPatterns(strings.Join(include, ","), path) &&
+		!module.MatchPrefixPatterns(strings.Join(exclude, ","), path)
+}
+
 var ErrNotFound = errors.New("not found")
 
 var ErrNotDependency = errors.New("not a dependency")
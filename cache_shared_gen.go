@@ -11,9 +11,9 @@ import (
 // MarshalMsg implements msgp.Marshaler
 func (z *listedPackage) MarshalMsg(b []byte) (o []byte, err error) {
 	o = msgp.Require(b, z.Msgsize())
-	// map header, size 14
+	// map header, size 15
 	// string "Name"
-	o = append(o, 0x8e, 0xa4, 0x4e, 0x61, 0x6d, 0x65)
+	o = append(o, 0x8f, 0xa4, 0x4e, 0x61, 0x6d, 0x65)
 	o = msgp.AppendString(o, z.Name)
 	// string "ImportPath"
 	o = append(o, 0xaa, 0x49, 0x6d, 0x70, 0x6f, 0x72, 0x74, 0x50, 0x61, 0x74, 0x68)
@@ -77,6 +77,13 @@ func (z *listedPackage) MarshalMsg(b []byte) (o []byte, err error) {
 	// string "ToObfuscate"
 	o = append(o, 0xab, 0x54, 0x6f, 0x4f, 0x62, 0x66, 0x75, 0x73, 0x63, 0x61, 0x74, 0x65)
 	o = msgp.AppendBool(o, z.ToObfuscate)
+	// string "GarbleKeep"
+	o = append(o, 0xaa, 0x47, 0x61, 0x72, 0x62, 0x6c, 0x65, 0x4b, 0x65, 0x65, 0x70)
+	o = msgp.AppendMapHeader(o, uint32(len(z.GarbleKeep)))
+	for za0007, za0008 := range z.GarbleKeep {
+		o = msgp.AppendString(o, za0007)
+		o = msgp.AppendBool(o, za0008)
+	}
 	return
 }
 
@@ -283,6 +290,34 @@ func (z *listedPackage) UnmarshalMsg(bts []byte) (o []byte, err error) {
 				err = msgp.WrapError(err, "ToObfuscate")
 				return
 			}
+		case "GarbleKeep":
+			var zb0007 uint32
+			zb0007, bts, err = msgp.ReadMapHeaderBytes(bts)
+			if err != nil {
+				err = msgp.WrapError(err, "GarbleKeep")
+				return
+			}
+			if z.GarbleKeep == nil {
+				z.GarbleKeep = make(map[string]bool, zb0007)
+			} else if len(z.GarbleKeep) > 0 {
+				clear(z.GarbleKeep)
+			}
+			for zb0007 > 0 {
+				var za0008 bool
+				zb0007--
+				var za0007 string
+				za0007, bts, err = msgp.ReadStringBytes(bts)
+				if err != nil {
+					err = msgp.WrapError(err, "GarbleKeep")
+					return
+				}
+				za0008, bts, err = msgp.ReadBoolBytes(bts)
+				if err != nil {
+					err = msgp.WrapError(err, "GarbleKeep", za0007)
+					return
+				}
+				z.GarbleKeep[za0007] = za0008
+			}
 		default:
 			bts, err = msgp.Skip(bts)
 			if err != nil {
@@ -322,7 +357,13 @@ func (z *listedPackage) Msgsize() (s int) {
 	} else {
 		s += 1 + 4 + msgp.StringPrefixSize + len(z.Error.Pos) + 4 + msgp.StringPrefixSize + len(z.Error.Err)
 	}
-	s += 15 + msgp.ArrayHeaderSize + (sha256.Size * (msgp.ByteSize)) + 12 + msgp.BoolSize
+	s += 15 + msgp.ArrayHeaderSize + (sha256.Size * (msgp.ByteSize)) + 12 + msgp.BoolSize + 11 + msgp.MapHeaderSize
+	if z.GarbleKeep != nil {
+		for za0007, za0008 := range z.GarbleKeep {
+			_ = za0008
+			s += msgp.StringPrefixSize + len(za0007) + msgp.BoolSize
+		}
+	}
 	return
 }
 
@@ -445,6 +486,137 @@ func (z *listedPackagesData) Msgsize() (s int) {
 	return
 }
 
+// MarshalMsg implements msgp.Marshaler
+func (z *packageConfig) MarshalMsg(b []byte) (o []byte, err error) {
+	o = msgp.Require(b, z.Msgsize())
+	// map header, size 3
+	// string "Literals"
+	o = append(o, 0x83, 0xa8, 0x4c, 0x69, 0x74, 0x65, 0x72, 0x61, 0x6c, 0x73)
+	if z.Literals == nil {
+		o = msgp.AppendNil(o)
+	} else {
+		o = msgp.AppendBool(o, *z.Literals)
+	}
+	// string "Lines"
+	o = append(o, 0xa5, 0x4c, 0x69, 0x6e, 0x65, 0x73)
+	if z.Lines == nil {
+		o = msgp.AppendNil(o)
+	} else {
+		o = msgp.AppendBool(o, *z.Lines)
+	}
+	// string "Obfuscators"
+	o = append(o, 0xab, 0x4f, 0x62, 0x66, 0x75, 0x73, 0x63, 0x61, 0x74, 0x6f, 0x72, 0x73)
+	o = msgp.AppendArrayHeader(o, uint32(len(z.Obfuscators)))
+	for za0001 := range z.Obfuscators {
+		o = msgp.AppendString(o, z.Obfuscators[za0001])
+	}
+	return
+}
+
+// UnmarshalMsg implements msgp.Unmarshaler
+func (z *packageConfig) UnmarshalMsg(bts []byte) (o []byte, err error) {
+	var field []byte
+	_ = field
+	var zb0001 uint32
+	zb0001, bts, err = msgp.ReadMapHeaderBytes(bts)
+	if err != nil {
+		err = msgp.WrapError(err)
+		return
+	}
+	for zb0001 > 0 {
+		zb0001--
+		field, bts, err = msgp.ReadMapKeyZC(bts)
+		if err != nil {
+			err = msgp.WrapError(err)
+			return
+		}
+		switch msgp.UnsafeString(field) {
+		case "Literals":
+			if msgp.IsNil(bts) {
+				bts, err = msgp.ReadNilBytes(bts)
+				if err != nil {
+					return
+				}
+				z.Literals = nil
+			} else {
+				if z.Literals == nil {
+					z.Literals = new(bool)
+				}
+				*z.Literals, bts, err = msgp.ReadBoolBytes(bts)
+				if err != nil {
+					err = msgp.WrapError(err, "Literals")
+					return
+				}
+			}
+		case "Lines":
+			if msgp.IsNil(bts) {
+				bts, err = msgp.ReadNilBytes(bts)
+				if err != nil {
+					return
+				}
+				z.Lines = nil
+			} else {
+				if z.Lines == nil {
+					z.Lines = new(bool)
+				}
+				*z.Lines, bts, err = msgp.ReadBoolBytes(bts)
+				if err != nil {
+					err = msgp.WrapError(err, "Lines")
+					return
+				}
+			}
+		case "Obfuscators":
+			var zb0002 uint32
+			zb0002, bts, err = msgp.ReadArrayHeaderBytes(bts)
+			if err != nil {
+				err = msgp.WrapError(err, "Obfuscators")
+				return
+			}
+			if cap(z.Obfuscators) >= int(zb0002) {
+				z.Obfuscators = (z.Obfuscators)[:zb0002]
+			} else {
+				z.Obfuscators = make([]string, zb0002)
+			}
+			for za0001 := range z.Obfuscators {
+				z.Obfuscators[za0001], bts, err = msgp.ReadStringBytes(bts)
+				if err != nil {
+					err = msgp.WrapError(err, "Obfuscators", za0001)
+					return
+				}
+			}
+		default:
+			bts, err = msgp.Skip(bts)
+			if err != nil {
+				err = msgp.WrapError(err)
+				return
+			}
+		}
+	}
+	o = bts
+	return
+}
+
+// Msgsize returns an upper bound estimate of the number of bytes occupied by the serialized message
+func (z *packageConfig) Msgsize() (s int) {
+	s = 1 + 9
+	if z.Literals == nil {
+		s += msgp.NilSize
+	} else {
+		s += msgp.BoolSize
+	}
+	s += 6
+	if z.Lines == nil {
+		s += msgp.NilSize
+	} else {
+		s += msgp.BoolSize
+	}
+	s += 12 + msgp.ArrayHeaderSize
+	for za0001 := range z.Obfuscators {
+		s += msgp.StringPrefixSize + len(z.Obfuscators[za0001])
+	}
+	return
+}
+
 // MarshalMsg implements msgp.Marshaler
 func (z packageError) MarshalMsg(b []byte) (o []byte, err error) {
 	o = msgp.Require(b, z.Msgsize())
@@ -570,9 +742,9 @@ func (z pkgRange) Msgsize() (s int) {
 // MarshalMsg implements msgp.Marshaler
 func (z *sharedCacheType) MarshalMsg(b []byte) (o []byte, err error) {
 	o = msgp.Require(b, z.Msgsize())
-	// map header, size 7
+	// map header, size 14
 	// string "ForwardBuildFlags"
-	o = append(o, 0x87, 0xb1, 0x46, 0x6f, 0x72, 0x77, 0x61, 0x72, 0x64, 0x42, 0x75, 0x69, 0x6c, 0x64, 0x46, 0x6c, 0x61, 0x67, 0x73)
+	o = append(o, 0x8e, 0xb1, 0x46, 0x6f, 0x72, 0x77, 0x61, 0x72, 0x64, 0x42, 0x75, 0x69, 0x6c, 0x64, 0x46, 0x6c, 0x61, 0x67, 0x73)
 	o = msgp.AppendArrayHeader(o, uint32(len(z.ForwardBuildFlags)))
 	for za0001 := range z.ForwardBuildFlags {
 		o = msgp.AppendString(o, z.ForwardBuildFlags[za0001])
@@ -597,18 +769,65 @@ func (z *sharedCacheType) MarshalMsg(b []byte) (o []byte, err error) {
 	// string "GOGARBLE"
 	o = append(o, 0xa8, 0x47, 0x4f, 0x47, 0x41, 0x52, 0x42, 0x4c, 0x45)
 	o = msgp.AppendString(o, z.GOGARBLE)
+	// string "InterfaceMethods"
+	o = append(o, 0xb0, 0x49, 0x6e, 0x74, 0x65, 0x72, 0x66, 0x61, 0x63, 0x65, 0x4d, 0x65, 0x74, 0x68, 0x6f, 0x64, 0x73)
+	o = msgp.AppendMapHeader(o, uint32(len(z.InterfaceMethods)))
+	for za0002, za0003 := range z.InterfaceMethods {
+		o = msgp.AppendString(o, za0002)
+		o = msgp.AppendBool(o, za0003)
+	}
+	// string "MethodByNamePackages"
+	o = append(o, 0xb4, 0x4d, 0x65, 0x74, 0x68, 0x6f, 0x64, 0x42, 0x79, 0x4e, 0x61, 0x6d, 0x65, 0x50, 0x61, 0x63, 0x6b, 0x61, 0x67, 0x65, 0x73)
+	o = msgp.AppendMapHeader(o, uint32(len(z.MethodByNamePackages)))
+	for za0004, za0005 := range z.MethodByNamePackages {
+		o = msgp.AppendString(o, za0004)
+		o = msgp.AppendBool(o, za0005)
+	}
+	// string "InterfaceMethodsHash"
+	o = append(o, 0xb4, 0x49, 0x6e, 0x74, 0x65, 0x72, 0x66, 0x61, 0x63, 0x65, 0x4d, 0x65, 0x74, 0x68, 0x6f, 0x64, 0x73, 0x48, 0x61, 0x73, 0x68)
+	o = msgp.AppendBytes(o, z.InterfaceMethodsHash)
+	// string "PackageConfigs"
+	o = append(o, 0xae, 0x50, 0x61, 0x63, 0x6b, 0x61, 0x67, 0x65, 0x43, 0x6f, 0x6e, 0x66, 0x69, 0x67, 0x73)
+	o = msgp.AppendMapHeader(o, uint32(len(z.PackageConfigs)))
+	for za0006, za0007 := range z.PackageConfigs {
+		o = msgp.AppendString(o, za0006)
+		o, err = za0007.MarshalMsg(o)
+		if err != nil {
+			err = msgp.WrapError(err, "PackageConfigs", za0006)
+			return
+		}
+	}
+	// string "ObfuscatorWeights"
+	o = append(o, 0xb1, 0x4f, 0x62, 0x66, 0x75, 0x73, 0x63, 0x61, 0x74, 0x6f, 0x72, 0x57, 0x65, 0x69, 0x67, 0x68, 0x74, 0x73)
+	o = msgp.AppendMapHeader(o, uint32(len(z.ObfuscatorWeights)))
+	for za0008, za0009 := range z.ObfuscatorWeights {
+		o = msgp.AppendString(o, za0008)
+		o = msgp.AppendInt(o, za0009)
+	}
+	// string "ReflectHints"
+	o = append(o, 0xac, 0x52, 0x65, 0x66, 0x6c, 0x65, 0x63, 0x74, 0x48, 0x69, 0x6e, 0x74, 0x73)
+	o = msgp.AppendArrayHeader(o, uint32(len(z.ReflectHints)))
+	for za0010 := range z.ReflectHints {
+		o = msgp.AppendString(o, z.ReflectHints[za0010])
+	}
+	// string "ConfigHash"
+	o = append(o, 0xaa, 0x43, 0x6f, 0x6e, 0x66, 0x69, 0x67, 0x48, 0x61, 0x73, 0x68)
+	o = msgp.AppendBytes(o, z.ConfigHash)
 	// string "GoCmd"
 	o = append(o, 0xa5, 0x47, 0x6f, 0x43, 0x6d, 0x64)
 	o = msgp.AppendString(o, z.GoCmd)
 	// string "GoEnv"
 	o = append(o, 0xa5, 0x47, 0x6f, 0x45, 0x6e, 0x76)
-	// map header, size 4
+	// map header, size 5
 	// string "GOOS"
-	o = append(o, 0x84, 0xa4, 0x47, 0x4f, 0x4f, 0x53)
+	o = append(o, 0x85, 0xa4, 0x47, 0x4f, 0x4f, 0x53)
 	o = msgp.AppendString(o, z.GoEnv.GOOS)
 	// string "GOARCH"
 	o = append(o, 0xa6, 0x47, 0x4f, 0x41, 0x52, 0x43, 0x48)
 	o = msgp.AppendString(o, z.GoEnv.GOARCH)
+	// string "GOMOD"
+	o = append(o, 0xa5, 0x47, 0x4f, 0x4d, 0x4f, 0x44)
+	o = msgp.AppendString(o, z.GoEnv.GOMOD)
 	// string "GOVERSION"
 	o = append(o, 0xa9, 0x47, 0x4f, 0x56, 0x45, 0x52, 0x53, 0x49, 0x4f, 0x4e)
 	o = msgp.AppendString(o, z.GoEnv.GOVERSION)
@@ -690,6 +909,149 @@ func (z *sharedCacheType) UnmarshalMsg(bts []byte) (o []byte, err error) {
 				err = msgp.WrapError(err, "GOGARBLE")
 				return
 			}
+		case "InterfaceMethods":
+			var zb0003 uint32
+			zb0003, bts, err = msgp.ReadMapHeaderBytes(bts)
+			if err != nil {
+				err = msgp.WrapError(err, "InterfaceMethods")
+				return
+			}
+			if z.InterfaceMethods == nil {
+				z.InterfaceMethods = make(map[string]bool, zb0003)
+			} else if len(z.InterfaceMethods) > 0 {
+				clear(z.InterfaceMethods)
+			}
+			for zb0003 > 0 {
+				var za0003 bool
+				zb0003--
+				var za0002 string
+				za0002, bts, err = msgp.ReadStringBytes(bts)
+				if err != nil {
+					err = msgp.WrapError(err, "InterfaceMethods")
+					return
+				}
+				za0003, bts, err = msgp.ReadBoolBytes(bts)
+				if err != nil {
+					err = msgp.WrapError(err, "InterfaceMethods", za0002)
+					return
+				}
+				z.InterfaceMethods[za0002] = za0003
+			}
+		case "MethodByNamePackages":
+			var zb0004 uint32
+			zb0004, bts, err = msgp.ReadMapHeaderBytes(bts)
+			if err != nil {
+				err = msgp.WrapError(err, "MethodByNamePackages")
+				return
+			}
+			if z.MethodByNamePackages == nil {
+				z.MethodByNamePackages = make(map[string]bool, zb0004)
+			} else if len(z.MethodByNamePackages) > 0 {
+				clear(z.MethodByNamePackages)
+			}
+			for zb0004 > 0 {
+				var za0005 bool
+				zb0004--
+				var za0004 string
+				za0004, bts, err = msgp.ReadStringBytes(bts)
+				if err != nil {
+					err = msgp.WrapError(err, "MethodByNamePackages")
+					return
+				}
+				za0005, bts, err = msgp.ReadBoolBytes(bts)
+				if err != nil {
+					err = msgp.WrapError(err, "MethodByNamePackages", za0004)
+					return
+				}
+				z.MethodByNamePackages[za0004] = za0005
+			}
+		case "InterfaceMethodsHash":
+			z.InterfaceMethodsHash, bts, err = msgp.ReadBytesBytes(bts, z.InterfaceMethodsHash)
+			if err != nil {
+				err = msgp.WrapError(err, "InterfaceMethodsHash")
+				return
+			}
+		case "PackageConfigs":
+			var zb0005 uint32
+			zb0005, bts, err = msgp.ReadMapHeaderBytes(bts)
+			if err != nil {
+				err = msgp.WrapError(err, "PackageConfigs")
+				return
+			}
+			if z.PackageConfigs == nil {
+				z.PackageConfigs = make(map[string]packageConfig, zb0005)
+			} else if len(z.PackageConfigs) > 0 {
+				clear(z.PackageConfigs)
+			}
+			for zb0005 > 0 {
+				var za0007 packageConfig
+				zb0005--
+				var za0006 string
+				za0006, bts, err = msgp.ReadStringBytes(bts)
+				if err != nil {
+					err = msgp.WrapError(err, "PackageConfigs")
+					return
+				}
+				bts, err = za0007.UnmarshalMsg(bts)
+				if err != nil {
+					err = msgp.WrapError(err, "PackageConfigs", za0006)
+					return
+				}
+				z.PackageConfigs[za0006] = za0007
+			}
+		case "ObfuscatorWeights":
+			var zb0006 uint32
+			zb0006, bts, err = msgp.ReadMapHeaderBytes(bts)
+			if err != nil {
+				err = msgp.WrapError(err, "ObfuscatorWeights")
+				return
+			}
+			if z.ObfuscatorWeights == nil {
+				z.ObfuscatorWeights = make(map[string]int, zb0006)
+			} else if len(z.ObfuscatorWeights) > 0 {
+				clear(z.ObfuscatorWeights)
+			}
+			for zb0006 > 0 {
+				var za0009 int
+				zb0006--
+				var za0008 string
+				za0008, bts, err = msgp.ReadStringBytes(bts)
+				if err != nil {
+					err = msgp.WrapError(err, "ObfuscatorWeights")
+					return
+				}
+				za0009, bts, err = msgp.ReadIntBytes(bts)
+				if err != nil {
+					err = msgp.WrapError(err, "ObfuscatorWeights", za0008)
+					return
+				}
+				z.ObfuscatorWeights[za0008] = za0009
+			}
+		case "ReflectHints":
+			var zb0007 uint32
+			zb0007, bts, err = msgp.ReadArrayHeaderBytes(bts)
+			if err != nil {
+				err = msgp.WrapError(err, "ReflectHints")
+				return
+			}
+			if cap(z.ReflectHints) >= int(zb0007) {
+				z.ReflectHints = (z.ReflectHints)[:zb0007]
+			} else {
+				z.ReflectHints = make([]string, zb0007)
+			}
+			for za0010 := range z.ReflectHints {
+				z.ReflectHints[za0010], bts, err = msgp.ReadStringBytes(bts)
+				if err != nil {
+					err = msgp.WrapError(err, "ReflectHints", za0010)
+					return
+				}
+			}
+		case "ConfigHash":
+			z.ConfigHash, bts, err = msgp.ReadBytesBytes(bts, z.ConfigHash)
+			if err != nil {
+				err = msgp.WrapError(err, "ConfigHash")
+				return
+			}
 		case "GoCmd":
 			z.GoCmd, bts, err = msgp.ReadStringBytes(bts)
 			if err != nil {
@@ -697,14 +1059,14 @@ func (z *sharedCacheType) UnmarshalMsg(bts []byte) (o []byte, err error) {
 				return
 			}
 		case "GoEnv":
-			var zb0003 uint32
-			zb0003, bts, err = msgp.ReadMapHeaderBytes(bts)
+			var zb0008 uint32
+			zb0008, bts, err = msgp.ReadMapHeaderBytes(bts)
 			if err != nil {
 				err = msgp.WrapError(err, "GoEnv")
 				return
 			}
-			for zb0003 > 0 {
-				zb0003--
+			for zb0008 > 0 {
+				zb0008--
 				field, bts, err = msgp.ReadMapKeyZC(bts)
 				if err != nil {
 					err = msgp.WrapError(err, "GoEnv")
@@ -723,6 +1085,12 @@ func (z *sharedCacheType) UnmarshalMsg(bts []byte) (o []byte, err error) {
 						err = msgp.WrapError(err, "GoEnv", "GOARCH")
 						return
 					}
+				case "GOMOD":
+					z.GoEnv.GOMOD, bts, err = msgp.ReadStringBytes(bts)
+					if err != nil {
+						err = msgp.WrapError(err, "GoEnv", "GOMOD")
+						return
+					}
 				case "GOVERSION":
 					z.GoEnv.GOVERSION, bts, err = msgp.ReadStringBytes(bts)
 					if err != nil {
@@ -767,6 +1135,38 @@ func (z *sharedCacheType) Msgsize() (s int) {
 	} else {
 		s += z.ListedPackages.Msgsize()
 	}
-	s += 16 + msgp.BytesPrefixSize + len(z.BinaryContentID) + 9 + msgp.StringPrefixSize + len(z.GOGARBLE) + 6 + msgp.StringPrefixSize + len(z.GoCmd) + 6 + 1 + 5 + msgp.StringPrefixSize + len(z.GoEnv.GOOS) + 7 + msgp.StringPrefixSize + len(z.GoEnv.GOARCH) + 10 + msgp.StringPrefixSize + len(z.GoEnv.GOVERSION) + 7 + msgp.StringPrefixSize + len(z.GoEnv.GOROOT)
+	s += 16 + msgp.BytesPrefixSize + len(z.BinaryContentID) + 9 + msgp.StringPrefixSize + len(z.GOGARBLE) + 17 + msgp.MapHeaderSize
+	if z.InterfaceMethods != nil {
+		for za0002, za0003 := range z.InterfaceMethods {
+			_ = za0003
+			s += msgp.StringPrefixSize + len(za0002) + msgp.BoolSize
+		}
+	}
+	s += 21 + msgp.MapHeaderSize
+	if z.MethodByNamePackages != nil {
+		for za0004, za0005 := range z.MethodByNamePackages {
+			_ = za0005
+			s += msgp.StringPrefixSize + len(za0004) + msgp.BoolSize
+		}
+	}
+	s += 21 + msgp.BytesPrefixSize + len(z.InterfaceMethodsHash) + 15 + msgp.MapHeaderSize
+	if z.PackageConfigs != nil {
+		for za0006, za0007 := range z.PackageConfigs {
+			_ = za0007
+			s += msgp.StringPrefixSize + len(za0006) + za0007.Msgsize()
+		}
+	}
+	s += 18 + msgp.MapHeaderSize
+	if z.ObfuscatorWeights != nil {
+		for za0008, za0009 := range z.ObfuscatorWeights {
+			_ = za0009
+			s += msgp.StringPrefixSize + len(za0008) + msgp.IntSize
+		}
+	}
+	s += 13 + msgp.ArrayHeaderSize
+	for za0010 := range z.ReflectHints {
+		s += msgp.StringPrefixSize + len(z.ReflectHints[za0010])
+	}
+	s += 11 + msgp.BytesPrefixSize + len(z.ConfigHash) + 6 + msgp.StringPrefixSize + len(z.GoCmd) + 6 + 1 + 5 + msgp.StringPrefixSize + len(z.GoEnv.GOOS) + 7 + msgp.StringPrefixSize + len(z.GoEnv.GOARCH) + 6 + msgp.StringPrefixSize + len(z.GoEnv.GOMOD) + 10 + msgp.StringPrefixSize + len(z.GoEnv.GOVERSION) + 7 + msgp.StringPrefixSize + len(z.GoEnv.GOROOT)
 	return
 }
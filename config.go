@@ -0,0 +1,523 @@
+// Copyright (c) 2026, The Garble Authors.
+// See LICENSE for licensing information.
+
+package main
+
+import (
+	"crypto/sha256"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"golang.org/x/mod/module"
+
+	"mvdan.cc/garble/internal/literals"
+)
+
+// configFileName is the name of the configuration file garble looks for
+// in the directory of the main module's go.mod file.
+const configFileName = "garble.toml"
+
+// projectConfig is the content of a garble.toml file, such as:
+//
+//	literals = true
+//	seed = "o9WDTZ4CN4w"
+//	gogarble = "*,!example.com/public-sdk"
+//	controlflow = "auto junk_jumps=4"
+//	reflect = ["example.com/plugins.Config"]
+//
+//	[obfuscators]
+//	split = 0
+//	seed = 2
+//
+//	[packages."example.com/hotpath"]
+//	literals = false
+//
+// Its settings apply to every command, such as "garble build" and "garble reverse",
+// so that they do not need to be repeated for every invocation.
+// The garble flags and environment variables take precedence.
+//
+// The boolean settings are pointers, so that they can be set to false explicitly.
+type projectConfig struct {
+	Literals        *bool
+	CacheLiterals   *bool
+	LiteralsMinSize int
+	Tiny            *bool
+	Methods         *bool
+	Lines           *bool
+	Embed           *bool
+	Seed            string
+	GOGARBLE        string
+	ControlFlow     string
+
+	// Packages holds per-package settings, keyed by GOGARBLE-style patterns.
+	// When multiple patterns match a package, the longest one is used.
+	Packages map[string]packageConfig
+
+	// Obfuscators sets the weights of the literal obfuscators by name,
+	// such as zero to disable one. See [literals.Register].
+	Obfuscators map[string]int
+
+	// Reflect lists types which are used via reflection in ways that garble
+	// cannot detect, such as "example.com/plugins.Config".
+	// Their names are then restored at run time, like with detected reflection.
+	Reflect []string
+}
+
+// loadConfig reads garble.toml next to the main module's go.mod, if there is one.
+// Global settings are applied to the garble flags which were not set explicitly,
+// and per-package settings and reflection hints are stored in sharedCache.
+// It must be called from the top-level garble process after fetchGoEnv.
+func loadConfig() error {
+	gomod := sharedCache.GoEnv.GOMOD
+	if gomod == "" || gomod == os.DevNull {
+		return nil // not in a module
+	}
+	path := filepath.Join(filepath.Dir(gomod), configFileName)
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	cfg, err := decodeConfig(string(data))
+	if err != nil {
+		return err
+	}
+	obfuscators := literals.ObfuscatorNames()
+	for name, weight := range cfg.Obfuscators {
+		if !slices.Contains(obfuscators, name) {
+			return fmt.Errorf("%s: unknown obfuscator %q", configFileName, name)
+		}
+		if weight < 0 {
+			return fmt.Errorf("%s: obfuscator %q has a negative weight", configFileName, name)
+		}
+	}
+	for pattern, pcfg := range cfg.Packages {
+		for _, name := range pcfg.Obfuscators {
+			if !slices.Contains(obfuscators, name) {
+				return fmt.Errorf("%s: unknown obfuscator %q for %q", configFileName, name, pattern)
+			}
+		}
+	}
+	for _, hint := range cfg.Reflect {
+		if i := strings.LastIndexByte(hint, '.'); i <= 0 || strings.Contains(hint[i:], "/") {
+			return fmt.Errorf("%s: reflect entries must be like pkg/path.TypeName: %q", configFileName, hint)
+		}
+	}
+	log.Printf("loaded %s", path)
+
+	set := make(map[string]bool)
+	flagSet.Visit(func(f *flag.Flag) { set[f.Name] = true })
+	for name, value := range map[string]*bool{
+		"literals":      cfg.Literals,
+		"cacheliterals": cfg.CacheLiterals,
+		"tiny":          cfg.Tiny,
+		"methods":       cfg.Methods,
+		"lines":         cfg.Lines,
+		"embed":         cfg.Embed,
+	} {
+		if value != nil && !set[name] {
+			flagSet.Set(name, strconv.FormatBool(*value))
+		}
+	}
+	if cfg.LiteralsMinSize != 0 && !set["literalsminsize"] {
+		if err := flagSet.Set("literalsminsize", strconv.Itoa(cfg.LiteralsMinSize)); err != nil {
+			return fmt.Errorf("%s: %v", configFileName, err)
+		}
+	}
+	if cfg.Seed != "" && !set["seed"] {
+		if err := flagSet.Set("seed", cfg.Seed); err != nil {
+			return fmt.Errorf("%s: %v", configFileName, err)
+		}
+		if flagSeed.random {
+			fmt.Fprintf(os.Stderr, "-seed chosen at random: %s\n", flagSeed.String())
+		}
+	}
+	if cfg.GOGARBLE != "" && os.Getenv("GOGARBLE") == "" {
+		sharedCache.GOGARBLE = cfg.GOGARBLE
+	}
+	if cfg.ControlFlow != "" && !set["controlflow"] {
+		if err := flagSet.Set("controlflow", cfg.ControlFlow); err != nil {
+			return fmt.Errorf("%s: %v", configFileName, err)
+		}
+	}
+
+	sharedCache.PackageConfigs = cfg.Packages
+	sharedCache.ObfuscatorWeights = cfg.Obfuscators
+	sharedCache.ReflectHints = cfg.Reflect
+	sum := sha256.Sum256(data)
+	sharedCache.ConfigHash = sum[:]
+	return nil
+}
+
+// decodeConfig decodes a garble.toml file. Rather than supporting all of TOML,
+// it only supports what garble.toml needs: key-value pairs whose values are
+// booleans, integers, strings, or arrays of strings, the [obfuscators] table,
+// and [packages."pattern"] tables. Arrays may span multiple lines.
+func decodeConfig(data string) (projectConfig, error) {
+	var cfg projectConfig
+	var (
+		table   string // the table header, or empty for the top level
+		pattern string // the pattern of a [packages."pattern"] table
+		seen    = make(map[string]bool)
+	)
+	lines := strings.Split(data, "\n")
+	for i := 0; i < len(lines); i++ {
+		lineNum := i + 1
+		errorf := func(format string, args ...any) error {
+			return fmt.Errorf("%s:%d: %s", configFileName, lineNum, fmt.Sprintf(format, args...))
+		}
+		line := strings.TrimSpace(stripConfigComment(lines[i]))
+		if line == "" {
+			continue
+		}
+		if header, ok := strings.CutPrefix(line, "["); ok {
+			header, ok = strings.CutSuffix(header, "]")
+			keys, err := splitConfigKey(header)
+			if !ok || err != nil {
+				return cfg, errorf("invalid table header: %s", line)
+			}
+			table = strings.TrimSpace(header)
+			if seen[table] {
+				return cfg, errorf("duplicate table %s", table)
+			}
+			seen[table] = true
+			switch {
+			case len(keys) == 1 && keys[0] == "obfuscators":
+				pattern = ""
+				cfg.Obfuscators = make(map[string]int)
+			case len(keys) == 2 && keys[0] == "packages":
+				pattern = keys[1]
+				if cfg.Packages == nil {
+					cfg.Packages = make(map[string]packageConfig)
+				}
+				cfg.Packages[pattern] = packageConfig{}
+			default:
+				return cfg, errorf("unknown table %s", table)
+			}
+			continue
+		}
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			return cfg, errorf("expected key = value: %s", line)
+		}
+		key = strings.TrimSpace(key)
+		value = strings.TrimSpace(value)
+		for strings.HasPrefix(value, "[") && !strings.HasSuffix(value, "]") && i+1 < len(lines) {
+			i++
+			value += " " + strings.TrimSpace(stripConfigComment(lines[i]))
+		}
+		fullKey := key
+		if table != "" {
+			fullKey = table + "." + key
+		}
+		keys, err := splitConfigKey(key)
+		if err != nil || len(keys) != 1 {
+			return cfg, errorf("unknown setting %q", fullKey)
+		}
+		if seen[fullKey] {
+			return cfg, errorf("duplicate setting %q", fullKey)
+		}
+		seen[fullKey] = true
+
+		name := keys[0]
+		switch {
+		case table == "":
+			err = cfg.set(name, value)
+		case pattern == "":
+			var weight int
+			weight, err = configInt(value)
+			cfg.Obfuscators[name] = weight
+		default:
+			pcfg := cfg.Packages[pattern]
+			err = pcfg.set(name, value)
+			cfg.Packages[pattern] = pcfg
+		}
+		if errors.Is(err, errUnknownSetting) {
+			return cfg, errorf("unknown setting %q", fullKey)
+		} else if err != nil {
+			return cfg, errorf("%s: %v", fullKey, err)
+		}
+	}
+	return cfg, nil
+}
+
+var errUnknownSetting = errors.New("unknown setting")
+
+func (cfg *projectConfig) set(name, value string) (err error) {
+	switch name {
+	case "literals":
+		cfg.Literals, err = configBool(value)
+	case "cacheliterals":
+		cfg.CacheLiterals, err = configBool(value)
+	case "literalsminsize":
+		cfg.LiteralsMinSize, err = configInt(value)
+	case "tiny":
+		cfg.Tiny, err = configBool(value)
+	case "methods":
+		cfg.Methods, err = configBool(value)
+	case "lines":
+		cfg.Lines, err = configBool(value)
+	case "embed":
+		cfg.Embed, err = configBool(value)
+	case "seed":
+		cfg.Seed, err = configString(value)
+	case "gogarble":
+		cfg.GOGARBLE, err = configString(value)
+	case "controlflow":
+		cfg.ControlFlow, err = configString(value)
+	case "reflect":
+		cfg.Reflect, err = configStrings(value)
+	default:
+		return errUnknownSetting
+	}
+	return err
+}
+
+func (cfg *packageConfig) set(name, value string) (err error) {
+	switch name {
+	case "literals":
+		cfg.Literals, err = configBool(value)
+	case "lines":
+		cfg.Lines, err = configBool(value)
+	case "obfuscators":
+		cfg.Obfuscators, err = configStrings(value)
+	default:
+		return errUnknownSetting
+	}
+	return err
+}
+
+// stripConfigComment removes a trailing "#" comment from a line,
+// unless the "#" is inside a string.
+func stripConfigComment(line string) string {
+	var quote byte
+	for i := 0; i < len(line); i++ {
+		switch c := line[i]; {
+		case quote == '"' && c == '\\':
+			i++ // skip the escaped character
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '#':
+			return line[:i]
+		}
+	}
+	return line
+}
+
+// splitConfigKey splits a dotted key like packages."example.com/foo",
+// where each part is either a bare key or a quoted string.
+func splitConfigKey(key string) ([]string, error) {
+	var keys []string
+	key = strings.TrimSpace(key)
+	for {
+		var part string
+		if strings.HasPrefix(key, `"`) || strings.HasPrefix(key, "'") {
+			end := configStringEnd(key)
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated string")
+			}
+			var err error
+			if part, err = configString(key[:end]); err != nil {
+				return nil, err
+			}
+			key = key[end:]
+		} else {
+			end := strings.IndexFunc(key, func(r rune) bool {
+				return !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_' || r == '-')
+			})
+			if end < 0 {
+				end = len(key)
+			}
+			if end == 0 {
+				return nil, fmt.Errorf("invalid key")
+			}
+			part, key = key[:end], key[end:]
+		}
+		keys = append(keys, part)
+		key = strings.TrimSpace(key)
+		if key == "" {
+			return keys, nil
+		}
+		rest, ok := strings.CutPrefix(key, ".")
+		if !ok {
+			return nil, fmt.Errorf("invalid key")
+		}
+		key = strings.TrimSpace(rest)
+	}
+}
+
+// configStringEnd returns the end of the quoted string at the start of s,
+// or -1 if it is not terminated.
+func configStringEnd(s string) int {
+	quote := s[0]
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			if quote == '"' {
+				i++
+			}
+		case quote:
+			return i + 1
+		}
+	}
+	return -1
+}
+
+func configBool(value string) (*bool, error) {
+	switch value {
+	case "true", "false":
+		b := value == "true"
+		return &b, nil
+	}
+	return nil, fmt.Errorf("expected a boolean: %s", value)
+}
+
+func configInt(value string) (int, error) {
+	n, err := strconv.Atoi(strings.ReplaceAll(value, "_", ""))
+	if err != nil {
+		return 0, fmt.Errorf("expected an integer: %s", value)
+	}
+	return n, nil
+}
+
+// configString decodes a basic string, which is double-quoted and may contain
+// escapes, or a literal string, which is single-quoted.
+func configString(value string) (string, error) {
+	if len(value) >= 2 && value[0] == '\'' && value[len(value)-1] == '\'' {
+		return value[1 : len(value)-1], nil
+	}
+	if len(value) >= 2 && value[0] == '"' && configStringEnd(value) == len(value) {
+		if s, err := strconv.Unquote(value); err == nil {
+			return s, nil
+		}
+	}
+	return "", fmt.Errorf("expected a string: %s", value)
+}
+
+// configStrings decodes an array of strings, which may have a trailing comma.
+func configStrings(value string) ([]string, error) {
+	errInvalid := fmt.Errorf("expected an array of strings: %s", value)
+	inner, ok1 := strings.CutPrefix(value, "[")
+	inner, ok2 := strings.CutSuffix(inner, "]")
+	if !ok1 || !ok2 {
+		return nil, errInvalid
+	}
+	var list []string
+	for inner = strings.TrimSpace(inner); inner != ""; {
+		end := -1
+		if inner[0] == '"' || inner[0] == '\'' {
+			end = configStringEnd(inner)
+		}
+		if end < 0 {
+			return nil, errInvalid
+		}
+		s, err := configString(inner[:end])
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, s)
+		inner = strings.TrimSpace(inner[end:])
+		if rest, ok := strings.CutPrefix(inner, ","); ok {
+			inner = strings.TrimSpace(rest)
+		} else if inner != "" {
+			return nil, errInvalid
+		}
+	}
+	return list, nil
+}
+
+// configForPackage returns the garble.toml settings for a package,
+// from the longest pattern matching its import path.
+func configForPackage(lpkg *listedPackage) packageConfig {
+	path := lpkg.ImportPath
+	if lpkg.ForTest != "" {
+		path = lpkg.ForTest
+	}
+	var cfg packageConfig
+	chosen := ""
+	for pattern, pcfg := range sharedCache.PackageConfigs {
+		if !module.MatchPrefixPatterns(pattern, path) {
+			continue
+		}
+		// Break ties between patterns of the same length for determinism.
+		if chosen == "" || len(pattern) > len(chosen) || (len(pattern) == len(chosen) && pattern < chosen) {
+			cfg, chosen = pcfg, pattern
+		}
+	}
+	return cfg
+}
+
+// obfuscatesLiterals reports whether -literals applies to a package,
+// which garble.toml may override.
+func obfuscatesLiterals(lpkg *listedPackage) bool {
+	if cfg := configForPackage(lpkg); cfg.Literals != nil {
+		return *cfg.Literals
+	}
+	return flagLiterals
+}
+
+// obfuscatorWeights returns the weights of the literal obfuscators for a package.
+// If garble.toml pins the obfuscators for the package, the others are disabled,
+// and the pinned ones are enabled even if their weight is otherwise zero.
+func obfuscatorWeights(lpkg *listedPackage) literals.ObfuscatorWeights {
+	pinned := configForPackage(lpkg).Obfuscators
+	if len(pinned) == 0 {
+		return sharedCache.ObfuscatorWeights
+	}
+	weights := make(literals.ObfuscatorWeights)
+	for _, name := range literals.ObfuscatorNames() {
+		weights[name] = 0
+	}
+	for _, name := range pinned {
+		weights[name] = max(sharedCache.ObfuscatorWeights[name], 1)
+	}
+	return weights
+}
+
+// mayObfuscateLiterals reports whether -literals applies to any package,
+// including when garble.toml enables it for some packages only.
+func mayObfuscateLiterals() bool {
+	if flagLiterals {
+		return true
+	}
+	for _, cfg := range sharedCache.PackageConfigs {
+		if cfg.Literals != nil && *cfg.Literals {
+			return true
+		}
+	}
+	return false
+}
+
+// obfuscatesLines reports whether -lines applies to a package,
+// which garble.toml may override.
+func obfuscatesLines(lpkg *listedPackage) bool {
+	if cfg := configForPackage(lpkg); cfg.Lines != nil {
+		return *cfg.Lines
+	}
+	return flagLines
+}
+
+// hasReflectHints reports whether a package or any of its dependencies
+// declares a type listed in garble.toml as used via reflection.
+func (p *listedPackage) hasReflectHints() bool {
+	for _, hint := range sharedCache.ReflectHints {
+		path := hint[:strings.LastIndexByte(hint, '.')]
+		if path == p.ImportPath || p.hasDep(path) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,290 @@
+// Copyright (c) 2026, The Garble Authors.
+// See LICENSE for licensing information.
+
+package main
+
+import (
+	"bytes"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	ah "mvdan.cc/garble/internal/asthelper"
+	"mvdan.cc/garble/internal/literals"
+)
+
+// Directives which exclude declarations from parts of the obfuscation.
+// They can be placed in the doc comment of a function, a method, a type,
+// a struct field, a var or const declaration, or a file's package clause
+// to apply to all the declarations in the file.
+const (
+	// directiveKeep keeps the original names of declarations.
+	directiveKeep = "//garble:keep"
+
+	// directiveNoLiterals skips obfuscating literals with -literals;
+	// see [literals.Obfuscate].
+	directiveNoLiterals = literals.NoLiteralsDirective
+
+	// directiveNoPosition keeps the original position information.
+	directiveNoPosition = "//garble:noposition"
+)
+
+// directiveCacheLiterals decodes the literals in a function only once per process,
+// like -cacheliterals does for all functions; see [literals.CacheConfig].
+// It can also be placed in a file's package clause.
+const directiveCacheLiterals = literals.CacheLiteralsDirective
+
+// collectKeptNames returns the names kept via //garble:keep in a package,
+// to fill [listedPackage.GarbleKeep].
+//
+// Other packages must agree on which names are kept, so we collect them
+// syntactically in the root process, much like computeInterfaceMethods.
+// Package-level declarations are keyed by their name, and fields and methods
+// by the names of their type and themselves, such as "Type.Field" or "Type.Method".
+// The keys are resolved to objects by [keptObjects].
+func collectKeptNames(lpkg *listedPackage) (map[string]bool, error) {
+	var kept map[string]bool
+	keep := func(key string) {
+		if kept == nil {
+			kept = make(map[string]bool)
+		}
+		kept[key] = true
+	}
+	for _, goFile := range lpkg.CompiledGoFiles {
+		if !filepath.IsAbs(goFile) {
+			goFile = filepath.Join(lpkg.Dir, goFile)
+		}
+		src, err := os.ReadFile(goFile)
+		if err != nil {
+			return nil, err
+		}
+		if !bytes.Contains(src, []byte(directiveKeep)) {
+			continue
+		}
+		file, err := parser.ParseFile(token.NewFileSet(), goFile, src, parser.SkipObjectResolution|parser.ParseComments)
+		if err != nil {
+			continue // let the compiler report syntax errors
+		}
+		all := ah.HasDirective(file.Doc, directiveKeep)
+		for _, decl := range file.Decls {
+			switch decl := decl.(type) {
+			case *ast.FuncDecl:
+				if !all && !ah.HasDirective(decl.Doc, directiveKeep) {
+					continue
+				}
+				if decl.Recv != nil {
+					if len(decl.Recv.List) > 0 {
+						keep(recvTypeName(decl.Recv.List[0].Type) + "." + decl.Name.Name)
+					}
+				} else {
+					keep(decl.Name.Name)
+				}
+			case *ast.GenDecl:
+				declKept := all || ah.HasDirective(decl.Doc, directiveKeep)
+				for _, spec := range decl.Specs {
+					switch spec := spec.(type) {
+					case *ast.ValueSpec:
+						if declKept || ah.HasDirective(spec.Doc, directiveKeep) {
+							for _, name := range spec.Names {
+								keep(name.Name)
+							}
+						}
+					case *ast.TypeSpec:
+						if declKept || ah.HasDirective(spec.Doc, directiveKeep) {
+							keep(spec.Name.Name)
+						}
+						switch typ := spec.Type.(type) {
+						case *ast.StructType:
+							for _, field := range typ.Fields.List {
+								if all || ah.HasDirective(field.Doc, directiveKeep) {
+									for _, name := range field.Names {
+										keep(spec.Name.Name + "." + name.Name)
+									}
+								}
+							}
+						case *ast.InterfaceType:
+							for _, field := range typ.Methods.List {
+								if all || ah.HasDirective(field.Doc, directiveKeep) {
+									for _, name := range field.Names {
+										keep(spec.Name.Name + "." + name.Name)
+									}
+								}
+							}
+						}
+					}
+				}
+			}
+		}
+	}
+	return kept, nil
+}
+
+// recvTypeName returns the name of a method's receiver type,
+// such as "T" for "*T" or "T[K, V]".
+func recvTypeName(expr ast.Expr) string {
+	for {
+		switch x := expr.(type) {
+		case *ast.ParenExpr:
+			expr = x.X
+		case *ast.StarExpr:
+			expr = x.X
+		case *ast.IndexExpr:
+			expr = x.X
+		case *ast.IndexListExpr:
+			expr = x.X
+		case *ast.Ident:
+			return x.Name
+		default:
+			return ""
+		}
+	}
+}
+
+// keptObject reports whether an object's name is kept via //garble:keep.
+func (tf *transformer) keptObject(lpkg *listedPackage, obj types.Object) bool {
+	if len(lpkg.GarbleKeep) == 0 {
+		return false
+	}
+	switch origin := obj.(type) {
+	case *types.Func:
+		obj = origin.Origin()
+	case *types.Var:
+		obj = origin.Origin()
+	}
+	kept, ok := tf.keptObjects[obj.Pkg()]
+	if !ok {
+		kept = keptObjects(obj.Pkg(), lpkg.GarbleKeep)
+		if tf.keptObjects == nil {
+			tf.keptObjects = make(map[*types.Package]map[types.Object]bool)
+		}
+		tf.keptObjects[obj.Pkg()] = kept
+	}
+	return kept[obj]
+}
+
+// keptObjects resolves the keys collected by [collectKeptNames] to the objects of a package.
+func keptObjects(pkg *types.Package, keys map[string]bool) map[types.Object]bool {
+	kept := make(map[types.Object]bool)
+	scope := pkg.Scope()
+	for key := range keys {
+		typeName, member, ok := strings.Cut(key, ".")
+		obj := scope.Lookup(typeName)
+		if obj == nil {
+			continue // e.g. declared in a file excluded by build tags
+		}
+		if !ok {
+			kept[obj] = true
+			continue
+		}
+		if tname, ok := obj.(*types.TypeName); ok {
+			if obj := declaredMember(tname, member); obj != nil {
+				kept[obj] = true
+			}
+		}
+	}
+	keepImplementedMethods(scope, kept)
+	return kept
+}
+
+// declaredMember returns the field or method with a name declared by a type,
+// not counting those promoted from embedded fields.
+func declaredMember(tname *types.TypeName, name string) types.Object {
+	named, ok := tname.Type().(*types.Named)
+	if !ok {
+		return nil
+	}
+	for method := range named.Methods() {
+		if method.Name() == name {
+			return method
+		}
+	}
+	switch typ := named.Underlying().(type) {
+	case *types.Struct:
+		for field := range typ.Fields() {
+			if field.Name() == name {
+				return field
+			}
+		}
+	case *types.Interface:
+		for method := range typ.ExplicitMethods() {
+			if method.Name() == name {
+				return method
+			}
+		}
+	}
+	return nil
+}
+
+// keepImplementedMethods also keeps the methods which must agree on their names
+// with the kept unexported methods: those of the interfaces they implement,
+// and those of the other types implementing the same interfaces.
+// Exported methods are never obfuscated when they may implement an interface.
+//
+// Only the named and non-generic types of a package are considered,
+// as unexported methods can only implement interfaces in the same package.
+func keepImplementedMethods(scope *types.Scope, kept map[types.Object]bool) {
+	names := make(map[string]bool)
+	for obj := range kept {
+		if fn, ok := obj.(*types.Func); ok && fn.Signature().Recv() != nil && !fn.Exported() {
+			names[fn.Name()] = true
+		}
+	}
+	if len(names) == 0 {
+		return
+	}
+	var ifaces, concrete []*types.Named
+	for _, name := range scope.Names() {
+		tname, ok := scope.Lookup(name).(*types.TypeName)
+		if !ok || tname.IsAlias() {
+			continue
+		}
+		named, ok := tname.Type().(*types.Named)
+		if !ok || named.TypeParams().Len() > 0 {
+			continue
+		}
+		if types.IsInterface(named) {
+			ifaces = append(ifaces, named)
+		} else {
+			concrete = append(concrete, named)
+		}
+	}
+
+	// Keeping a method may require keeping more interface methods, so repeat until nothing changes.
+	for changed := true; changed; {
+		changed = false
+		for _, iface := range ifaces {
+			for name := range names {
+				obj, _, _ := types.LookupFieldOrMethod(iface, false, iface.Obj().Pkg(), name)
+				method, ok := obj.(*types.Func)
+				if !ok {
+					continue
+				}
+				methods := []*types.Func{method}
+				for _, typ := range concrete {
+					ptr := types.NewPointer(typ)
+					if !types.Implements(ptr, iface.Underlying().(*types.Interface)) {
+						continue
+					}
+					obj, _, _ := types.LookupFieldOrMethod(ptr, false, typ.Obj().Pkg(), name)
+					if method, ok := obj.(*types.Func); ok {
+						methods = append(methods, method)
+					}
+				}
+				if !slices.ContainsFunc(methods, func(method *types.Func) bool { return kept[method] }) {
+					continue
+				}
+				for _, method := range methods {
+					if !kept[method] {
+						kept[method] = true
+						changed = true
+					}
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,305 @@
+// Copyright (c) 2026, The Garble Authors.
+// See LICENSE for licensing information.
+
+package main
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"golang.org/x/tools/go/ast/astutil"
+)
+
+//go:embed embed_code.go
+var embedCode string
+
+// embedFileName is the name of the file we add to packages when using -embed,
+// declaring the variables with the decrypted contents of the embedded files.
+const embedFileName = "GARBLE_embed.go"
+
+// embedConfig is the JSON file which cmd/go gives the compiler via -embedcfg,
+// telling it which files to embed for each //go:embed pattern.
+type embedConfig struct {
+	Patterns map[string][]string
+	Files    map[string]string
+}
+
+// obfuscateEmbeds encrypts the files embedded via //go:embed in the current package,
+// returning the compiler flags pointing to the encrypted files,
+// as well as a new file decrypting them at run time.
+//
+// Each variable with a //go:embed directive is renamed, so that it holds
+// the encrypted contents, and the new file declares what replaces it.
+// Variables of type string or []byte are decrypted the first time they are read,
+// as their uses are rewritten to call an accessor in the new file.
+// Exported variables and those which are assigned to are still decrypted
+// when the package is initialized, as not all of their uses can be rewritten.
+// Variables of type embed.FS are replaced by an [_embedFS] with the same methods,
+// decrypting each file the first time it is opened or read.
+//
+// If the package does not embed any files, the new file is nil.
+func (tf *transformer) obfuscateEmbeds(flags []string, files []*ast.File) ([]string, *ast.File, error) {
+	cfgPath := flagValue(flags, "-embedcfg")
+	if cfgPath == "" {
+		return flags, nil, nil
+	}
+	data, err := os.ReadFile(cfgPath)
+	if err != nil {
+		return nil, nil, err
+	}
+	var cfg embedConfig
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return nil, nil, fmt.Errorf("cannot parse -embedcfg: %v", err)
+	}
+	key := tf.obfRand.Uint64()
+
+	var decls strings.Builder
+	// accessors holds the accessor name replacing each use of a variable.
+	accessors := make(map[types.Object]string)
+	for _, file := range files {
+		for _, decl := range file.Decls {
+			decl, ok := decl.(*ast.GenDecl)
+			if !ok || decl.Tok != token.VAR {
+				continue
+			}
+			for _, spec := range decl.Specs {
+				spec := spec.(*ast.ValueSpec)
+				doc := spec.Doc
+				if !decl.Lparen.IsValid() {
+					doc = decl.Doc
+				}
+				patterns, err := embedPatterns(doc)
+				if err != nil {
+					return nil, nil, err
+				}
+				if len(patterns) == 0 {
+					continue
+				}
+				// The compiler ensures that there is a single variable
+				// without a value, of type string, []byte, or embed.FS.
+				name := spec.Names[0]
+				obj := tf.info.Defs[name]
+				if obj == nil {
+					continue // "_"
+				}
+				embedName := "_embedded_" + name.Name
+				spec.Names[0] = &ast.Ident{NamePos: name.NamePos, Name: embedName}
+
+				typ := obj.Type()
+				if types.Identical(typ, types.Typ[types.String]) ||
+					types.Identical(typ, types.NewSlice(types.Typ[types.Byte])) {
+					state, err := embedSingleFileState(cfg, patterns, key)
+					if err != nil {
+						return nil, nil, err
+					}
+					if obj.Exported() || embedVarAssigned(files, tf.info, obj) {
+						fmt.Fprintf(&decls, "var %s = %s(_decryptEmbed(string(%s), %#x))\n", name.Name, typ, embedName, state)
+						continue
+					}
+					accessor := "_embedGet_" + name.Name
+					accessors[obj] = accessor
+					fmt.Fprintf(&decls, "var _embedLazy_%s _embedLazy[%s]\n\n", name.Name, typ)
+					fmt.Fprintf(&decls, "func %s() %s { return _embedLazy_%s.get(string(%s), %#x) }\n\n",
+						accessor, typ, name.Name, embedName, state)
+				} else { // embed.FS
+					if err := checkEmbedFSUses(files, tf.info, obj); err != nil {
+						return nil, nil, err
+					}
+					fmt.Fprintf(&decls, "var %s = &_embedFS{fsys: %s, key: %#x}\n", name.Name, embedName, key)
+				}
+			}
+		}
+	}
+	if decls.Len() == 0 {
+		return flags, nil, nil
+	}
+
+	// Every embedded file belongs to one of the variables above.
+	dir := filepath.Join(sharedTempDir, tf.curPkg.obfuscatedSourceDir())
+	if err := os.MkdirAll(dir, 0o777); err != nil {
+		return nil, nil, err
+	}
+	for _, name := range slices.Sorted(maps.Keys(cfg.Files)) {
+		content, err := os.ReadFile(cfg.Files[name])
+		if err != nil {
+			return nil, nil, err
+		}
+		// XORing with the keystream again decrypts the contents.
+		encrypted := _decryptEmbed(string(content), _embedState(name, key))
+		f, err := os.CreateTemp(dir, "embed-*")
+		if err != nil {
+			return nil, nil, err
+		}
+		_, err = f.Write(encrypted)
+		if err2 := f.Close(); err == nil {
+			err = err2
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		cfg.Files[name] = f.Name()
+	}
+	newCfg, err := os.CreateTemp(sharedTempDir, "embedcfg")
+	if err != nil {
+		return nil, nil, err
+	}
+	err = json.NewEncoder(newCfg).Encode(cfg)
+	if err2 := newCfg.Close(); err == nil {
+		err = err2
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	flags = flagSetValue(flags, "-embedcfg", newCfg.Name())
+
+	_, code, _ := strings.Cut(embedCode, "// Injected code below this line.")
+	src := fmt.Sprintf("package %s\n\nimport (\n\t\"embed\"\n\t\"io\"\n\t\"io/fs\"\n\t\"sync\"\n)\n\n%s%s", files[0].Name.Name, &decls, code)
+	newFile, err := parser.ParseFile(fset, embedFileName, src, parser.SkipObjectResolution)
+	if err != nil {
+		return nil, nil, err
+	}
+	for i, file := range files {
+		files[i] = astutil.Apply(file, func(c *astutil.Cursor) bool {
+			ident, ok := c.Node().(*ast.Ident)
+			if !ok {
+				return true
+			}
+			if accessor := accessors[tf.info.Uses[ident]]; accessor != "" {
+				c.Replace(&ast.CallExpr{Fun: &ast.Ident{NamePos: ident.NamePos, Name: accessor}})
+			}
+			return true
+		}, nil).(*ast.File)
+	}
+	return flags, newFile, nil
+}
+
+// embedVarAssigned reports whether a variable is assigned to or has its address taken,
+// in which case its uses cannot be replaced with calls.
+func embedVarAssigned(files []*ast.File, info *types.Info, obj types.Object) bool {
+	assigned := false
+	for _, file := range files {
+		astutil.Apply(file, func(c *astutil.Cursor) bool {
+			ident, ok := c.Node().(*ast.Ident)
+			if !ok || info.Uses[ident] != obj {
+				return true
+			}
+			switch parent := c.Parent().(type) {
+			case *ast.AssignStmt:
+				assigned = assigned || slices.Contains(parent.Lhs, ast.Expr(ident))
+			case *ast.RangeStmt:
+				assigned = assigned || parent.Key == ident || parent.Value == ident
+			case *ast.UnaryExpr:
+				assigned = assigned || parent.Op == token.AND
+			}
+			return true
+		}, nil)
+	}
+	return assigned
+}
+
+// checkEmbedFSUses returns an error if an embed.FS variable is used
+// other than via its methods or as an interface such as fs.FS,
+// as it is replaced by an [_embedFS] with the same methods.
+func checkEmbedFSUses(files []*ast.File, info *types.Info, obj types.Object) error {
+	var err error
+	for _, file := range files {
+		astutil.Apply(file, func(c *astutil.Cursor) bool {
+			ident, ok := c.Node().(*ast.Ident)
+			if !ok || err != nil || info.Uses[ident] != obj {
+				return true
+			}
+			var target types.Type
+			switch parent := c.Parent().(type) {
+			case *ast.SelectorExpr:
+				return true // a method
+			case *ast.CallExpr:
+				if tv := info.Types[parent.Fun]; tv.IsType() {
+					target = tv.Type // a conversion
+				} else if sig, ok := tv.Type.Underlying().(*types.Signature); ok {
+					i := slices.Index(parent.Args, ast.Expr(ident))
+					if params := sig.Params(); sig.Variadic() && i >= params.Len()-1 {
+						target = params.At(params.Len() - 1).Type().(*types.Slice).Elem()
+					} else if i >= 0 && i < params.Len() {
+						target = params.At(i).Type()
+					}
+				}
+			case *ast.ValueSpec:
+				if parent.Type != nil {
+					target = info.TypeOf(parent.Type)
+				}
+			case *ast.AssignStmt:
+				if i := slices.Index(parent.Rhs, ast.Expr(ident)); i >= 0 && len(parent.Lhs) == len(parent.Rhs) {
+					target = info.TypeOf(parent.Lhs[i])
+				}
+			}
+			if target == nil || !types.IsInterface(target) {
+				err = fmt.Errorf("%s: -embed can only encrypt %s if it is used via its methods or as an fs.FS",
+					fset.Position(ident.Pos()), obj.Name())
+			}
+			return true
+		}, nil)
+	}
+	return err
+}
+
+// embedPatterns returns the patterns of the //go:embed directives in a doc comment.
+// Like cmd/go, patterns may be quoted if they contain spaces.
+func embedPatterns(doc *ast.CommentGroup) ([]string, error) {
+	if doc == nil {
+		return nil, nil
+	}
+	var patterns []string
+	for _, comment := range doc.List {
+		text, ok := strings.CutPrefix(comment.Text, "//go:embed")
+		if !ok || (text != "" && text[0] != ' ' && text[0] != '\t') {
+			continue
+		}
+		for {
+			text = strings.TrimLeft(text, " \t")
+			if text == "" {
+				break
+			}
+			if text[0] == '"' || text[0] == '`' {
+				quoted, err := strconv.QuotedPrefix(text)
+				if err != nil {
+					return nil, fmt.Errorf("invalid quoted //go:embed pattern: %s", text)
+				}
+				pattern, _ := strconv.Unquote(quoted)
+				patterns = append(patterns, pattern)
+				text = text[len(quoted):]
+				continue
+			}
+			i := strings.IndexAny(text, " \t")
+			if i < 0 {
+				i = len(text)
+			}
+			patterns = append(patterns, text[:i])
+			text = text[i:]
+		}
+	}
+	return patterns, nil
+}
+
+// embedSingleFileState returns the keystream seed for the file
+// embedded into a string or []byte variable.
+func embedSingleFileState(cfg embedConfig, patterns []string, key uint64) (uint64, error) {
+	var names []string
+	for _, pattern := range patterns {
+		names = append(names, cfg.Patterns[pattern]...)
+	}
+	if len(names) != 1 {
+		return 0, fmt.Errorf("expected a single file embedded for %q, found %d", patterns, len(names))
+	}
+	return _embedState(names[0], key), nil
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"embed"
+	"io"
+	"io/fs"
+	"sync"
+)
+
+// The code below is injected into packages embedding files via //go:embed
+// when using -embed, as the embedded file contents are then encrypted.
+// Each file is XORed with a xorshift keystream seeded from its name,
+// so _decryptEmbed also encrypts them at compile time.
+//
+// The files are only decrypted when they are first used.
+// Variables of type string and []byte are read via _embedLazy,
+// and embed.FS variables are replaced with an _embedFS wrapping them.
+// The names stay as they are, so that embed.FS can still find its files.
+
+// Injected code below this line.
+
+// _embedState returns the xorshift keystream seed for an embedded file.
+// The name is hashed via FNV-1a, so that each file gets a different keystream.
+func _embedState(name string, key uint64) uint64 {
+	state := key
+	for i := range len(name) {
+		state ^= uint64(name[i])
+		state *= 1099511628211
+	}
+	return state | 1 // xorshift never leaves a zero state
+}
+
+// _decryptEmbed decrypts the contents of an embedded file.
+func _decryptEmbed(data string, state uint64) []byte {
+	out := make([]byte, len(data))
+	for i := range len(data) {
+		state ^= state << 13
+		state ^= state >> 7
+		state ^= state << 17
+		out[i] = data[i] ^ byte(state)
+	}
+	return out
+}
+
+// _embedLazy holds the contents of a file embedded into a string or []byte,
+// decrypted the first time they are read.
+type _embedLazy[T string | []byte] struct {
+	once sync.Once
+	data T
+}
+
+func (l *_embedLazy[T]) get(data string, state uint64) T {
+	l.once.Do(func() { l.data = T(_decryptEmbed(data, state)) })
+	return l.data
+}
+
+// _embedFS has the same methods as embed.FS, which holds the encrypted files.
+// Each file is decrypted the first time it is opened or read.
+type _embedFS struct {
+	fsys embed.FS
+	key  uint64
+
+	mu    sync.Mutex
+	files map[string]string
+}
+
+func (f *_embedFS) decrypted(name, data string) string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if plain, ok := f.files[name]; ok {
+		return plain
+	}
+	if f.files == nil {
+		f.files = make(map[string]string)
+	}
+	plain := string(_decryptEmbed(data, _embedState(name, f.key)))
+	f.files[name] = plain
+	return plain
+}
+
+func (f *_embedFS) Open(name string) (fs.File, error) {
+	file, err := f.fsys.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	info, err := file.Stat()
+	if err != nil || info.IsDir() {
+		return file, err // directories only list names, which are not encrypted
+	}
+	data, err := io.ReadAll(file)
+	file.Close()
+	if err != nil {
+		return nil, err
+	}
+	return &_embedFile{info: info, data: f.decrypted(name, string(data))}, nil
+}
+
+func (f *_embedFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	return f.fsys.ReadDir(name)
+}
+
+func (f *_embedFS) ReadFile(name string) ([]byte, error) {
+	data, err := f.fsys.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	return []byte(f.decrypted(name, string(data))), nil
+}
+
+// _embedFile is an opened file of an _embedFS.
+// Like the files opened from embed.FS, it implements io.Seeker and io.ReaderAt.
+type _embedFile struct {
+	info   fs.FileInfo
+	data   string
+	offset int64
+}
+
+func (f *_embedFile) Stat() (fs.FileInfo, error) { return f.info, nil }
+
+func (f *_embedFile) Close() error { return nil }
+
+func (f *_embedFile) Read(b []byte) (int, error) {
+	if f.offset >= int64(len(f.data)) {
+		return 0, io.EOF
+	}
+	if f.offset < 0 {
+		return 0, &fs.PathError{Op: "read", Path: f.info.Name(), Err: fs.ErrInvalid}
+	}
+	n := copy(b, f.data[f.offset:])
+	f.offset += int64(n)
+	return n, nil
+}
+
+func (f *_embedFile) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += f.offset
+	case io.SeekEnd:
+		offset += int64(len(f.data))
+	}
+	if offset < 0 || offset > int64(len(f.data)) {
+		return 0, &fs.PathError{Op: "seek", Path: f.info.Name(), Err: fs.ErrInvalid}
+	}
+	f.offset = offset
+	return offset, nil
+}
+
+func (f *_embedFile) ReadAt(b []byte, offset int64) (int, error) {
+	if offset < 0 || offset > int64(len(f.data)) {
+		return 0, &fs.PathError{Op: "read", Path: f.info.Name(), Err: fs.ErrInvalid}
+	}
+	n := copy(b, f.data[offset:])
+	if n < len(b) {
+		return n, io.EOF
+	}
+	return n, nil
+}
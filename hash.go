@@ -116,6 +116,10 @@ func addGarbleToHash(inputHash []byte) [sha256.Size]byte {
 	// separate the env vars and flags, to reduce the chances of collisions.
 	fmt.Fprintf(hasher, " GOGARBLE=%s", sharedCache.GOGARBLE)
 	appendFlags(hasher, true)
+	if sharedCache.ConfigHash != nil {
+		// Per-package settings and reflection hints from garble.toml.
+		fmt.Fprintf(hasher, " config=%x", sharedCache.ConfigHash)
+	}
 	// addGarbleToHash returns the sum buffer, so we need a new copy.
 	// Otherwise the next use of the global sumBuffer would conflict.
 	var sumBuffer [sha256.Size]byte
@@ -123,6 +127,27 @@ func addGarbleToHash(inputHash []byte) [sha256.Size]byte {
 	return sumBuffer
 }
 
+// garbleActionID returns the GarbleActionID for a package with a build ID,
+// adding garble's own inputs to its action ID via [addGarbleToHash].
+// The strings set via -ldflags=-X for the package's variables are added too,
+// as they are injected into the obfuscated code; see [computeLinkerVariableStrings].
+func garbleActionID(lpkg *listedPackage) ([sha256.Size]byte, error) {
+	actionID := decodeBuildIDHash(splitActionID(lpkg.BuildID))
+	if !mayObfuscateLiterals() {
+		return addGarbleToHash(actionID), nil
+	}
+	ldflags, err := buildLdflags()
+	if err != nil {
+		return [sha256.Size]byte{}, err
+	}
+	for v := range linkerVariables(ldflags) {
+		if v.inPackage(lpkg.ImportPath, lpkg.Name) {
+			actionID = fmt.Appendf(actionID, " -X=%s=%s", v.name, v.value)
+		}
+	}
+	return addGarbleToHash(actionID), nil
+}
+
 // appendFlags writes garble's own flags to w in string form.
 // Errors are ignored, as w is always a buffer or hasher.
 // If forBuildHash is set, only the flags affecting a build are written.
@@ -133,6 +158,24 @@ func appendFlags(w io.Writer, forBuildHash bool) {
 	if flagTiny {
 		io.WriteString(w, " -tiny")
 	}
+	if flagMethods {
+		io.WriteString(w, " -methods")
+		if forBuildHash {
+			fmt.Fprintf(w, "=%x", sharedCache.InterfaceMethodsHash)
+		}
+	}
+	if flagLines {
+		io.WriteString(w, " -lines")
+	}
+	if flagEmbed {
+		io.WriteString(w, " -embed")
+	}
+	if flagCacheLiterals {
+		io.WriteString(w, " -cacheliterals")
+	}
+	if flagLiteralsMin != literals.MinSize {
+		fmt.Fprintf(w, " -literalsminsize=%d", flagLiteralsMin)
+	}
 	if flagDebug && !forBuildHash {
 		// -debug doesn't affect the build result at all,
 		// so don't give it separate entries in the build cache.
@@ -150,12 +193,20 @@ func appendFlags(w io.Writer, forBuildHash bool) {
 		io.WriteString(w, " -debugdir=")
 		io.WriteString(w, flagDebugDir)
 	}
+	if flagMapFile != "" && !forBuildHash {
+		// Like -debugdir, -mapfile doesn't affect obfuscation output.
+		io.WriteString(w, " -mapfile=")
+		io.WriteString(w, flagMapFile)
+	}
 	if flagSeed.present() {
 		io.WriteString(w, " -seed=")
 		io.WriteString(w, flagSeed.String())
 	}
-	if flagControlFlow && forBuildHash {
-		io.WriteString(w, " -ctrlflow")
+	if flagControlFlow.enabled() {
+		// The flag never contains quotes, so joining cannot fail.
+		arg, _ := cmdgoQuotedJoin([]string{"-controlflow=" + flagControlFlow.String()})
+		io.WriteString(w, " ")
+		io.WriteString(w, arg)
 	}
 	if literals.TestObfuscator != "" && forBuildHash {
 		io.WriteString(w, literals.TestObfuscator)
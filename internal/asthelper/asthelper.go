@@ -9,6 +9,7 @@ import (
 	"go/constant"
 	"go/token"
 	"strconv"
+	"strings"
 )
 
 // StringLit returns an ast.BasicLit of kind STRING
@@ -213,3 +214,17 @@ func ConstToAst(val constant.Value) ast.Expr {
 		panic("unreachable")
 	}
 }
+
+// HasDirective reports whether a doc comment contains a directive,
+// such as "//garble:keep".
+func HasDirective(doc *ast.CommentGroup, directive string) bool {
+	if doc == nil {
+		return false
+	}
+	for _, comment := range doc.List {
+		if text, ok := strings.CutPrefix(comment.Text, directive); ok && (text == "" || text[0] == ' ' || text[0] == '\t') {
+			return true
+		}
+	}
+	return false
+}
@@ -1,11 +1,13 @@
 package ctrlflow
 
 import (
+	"errors"
 	"fmt"
 	"go/ast"
 	"go/token"
 	"go/types"
 	"log"
+	"maps"
 	"math"
 	mathrand "math/rand"
 	"os"
@@ -14,7 +16,6 @@ import (
 
 	"golang.org/x/tools/go/ast/astutil"
 	"golang.org/x/tools/go/ssa"
-	ah "mvdan.cc/garble/internal/asthelper"
 	"mvdan.cc/garble/internal/ssa2ast"
 )
 
@@ -27,11 +28,15 @@ const (
 	defaultJunkJumps     = 0
 	defaultFlattenPasses = 1
 	defaultTrashBlocks   = 0
+	defaultOutlineParts  = 0
+	defaultOutlineMerge  = 0
 
 	maxBlockSplits   = math.MaxInt32
 	maxJunkJumps     = 256
 	maxFlattenPasses = 4
 	maxTrashBlocks   = 1024
+	maxOutlineParts  = 32
+	maxOutlineMerge  = 1
 
 	minTrashBlockStmts = 1
 	maxTrashBlockStmts = 32
@@ -72,6 +77,97 @@ func (m directiveParamMap) StringSlice(name string) []string {
 	return slice
 }
 
+// Mode selects which functions are obfuscated by [Obfuscate].
+type Mode string
+
+const (
+	// ModeAnnotated only obfuscates functions with the directive.
+	ModeAnnotated Mode = "annotated"
+
+	// ModeAll obfuscates every eligible function.
+	ModeAll Mode = "all"
+
+	// ModeAuto obfuscates the eligible functions which are complex enough
+	// to benefit from it, but not so large that obfuscating them is costly.
+	ModeAuto Mode = "auto"
+)
+
+// Config selects the functions to obfuscate and how.
+type Config struct {
+	Mode Mode
+
+	// DefaultParams holds parameters in the same form as the directive,
+	// such as "junk_jumps=4 flatten_hardening=xor", which apply to all
+	// obfuscated functions unless their directive overrides them.
+	DefaultParams string
+
+	// Skip, if not nil, excludes functions without the directive
+	// which the mode would otherwise select.
+	Skip func(*ast.FuncDecl) bool
+
+	// Hot, if not nil, reports whether a function is on the hot path
+	// according to a profile. Hot functions without the directive are skipped,
+	// while the other functions start from [coldParams] rather than
+	// from the built-in defaults.
+	Hot func(*ast.FuncDecl) bool
+}
+
+// coldParams are the default parameters for the functions which a profile
+// shows are not on the hot path, so that the stronger obfuscation is cheap.
+// Both [Config.DefaultParams] and the parameters of each directive override them.
+const coldParams = "block_splits=2 junk_jumps=8 flatten_hardening=xor,delegate_table"
+
+// Thresholds for ModeAuto, in SSA basic blocks and instructions.
+const (
+	autoMinBlocks = 4
+	autoMaxInstrs = 1000
+)
+
+// intParams are the integer parameters accepted in directives and as defaults,
+// with their maximum values.
+var intParams = map[string]int{
+	"block_splits":   maxBlockSplits,
+	"junk_jumps":     maxJunkJumps,
+	"flatten_passes": maxFlattenPasses,
+	"trash_blocks":   maxTrashBlocks,
+	"outline_parts":  maxOutlineParts,
+	"outline_merge":  maxOutlineMerge,
+}
+
+// parseParams parses space-separated parameters of the form "key=value" or "key".
+func parseParams(fields string) directiveParamMap {
+	m := make(directiveParamMap)
+	for _, v := range strings.Fields(fields) {
+		key, value, _ := strings.Cut(v, "=")
+		m[key] = value
+	}
+	return m
+}
+
+// CheckParams reports whether default parameters, in the same form as used
+// in directives like "junk_jumps=4 flatten_hardening=xor", are valid.
+func CheckParams(params string) error {
+	m := parseParams(params)
+	for key := range m {
+		if key == "flatten_hardening" {
+			for _, name := range m.StringSlice(key) {
+				if _, ok := hardeningMap[name]; !ok {
+					return fmt.Errorf("unknown dispatcher hardening %q", name)
+				}
+			}
+			continue
+		}
+		max, ok := intParams[key]
+		if !ok {
+			return fmt.Errorf("unknown parameter %q", key)
+		}
+		if _, err := m.GetInt(key, 0, max); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // parseDirective parses a directive string and returns a map of directive parameters.
 // Each parameter should be in the form "key=value" or "key"
 func parseDirective(directive string) (directiveParamMap, bool) {
@@ -79,25 +175,46 @@ func parseDirective(directive string) (directiveParamMap, bool) {
 	if !ok {
 		return nil, false
 	}
+	return parseParams(fieldsStr), true
+}
 
-	fields := strings.Fields(fieldsStr)
-	if len(fields) == 0 {
-		return nil, true
+// eligible reports whether a function can be obfuscated when it is not annotated.
+// Functions with compiler directives like //go:nosplit or //go:linkname are skipped,
+// as the directives are lost when moving the function, as well as generic functions,
+// and init functions, which cannot be referenced by name.
+func eligible(funcDecl *ast.FuncDecl, ssaFunc *ssa.Function, mode Mode) bool {
+	if funcDecl.Body == nil || funcDecl.Name.Name == "init" || funcDecl.Name.Name == "_" {
+		return false
 	}
-	m := make(map[string]string)
-	for _, v := range fields {
-		key, value, ok := strings.Cut(v, "=")
-		if ok {
-			m[key] = value
-		} else {
-			m[key] = ""
+	if funcDecl.Doc != nil {
+		for _, comment := range funcDecl.Doc.List {
+			if strings.HasPrefix(comment.Text, "//go:") {
+				return false
+			}
 		}
 	}
-	return m, true
+	if ssaFunc == nil || ssaFunc.TypeParams().Len() > 0 || ssaFunc.Signature.RecvTypeParams().Len() > 0 {
+		return false
+	}
+	if mode == ModeAuto {
+		instrs := 0
+		for _, block := range ssaFunc.Blocks {
+			instrs += len(block.Instrs)
+		}
+		return len(ssaFunc.Blocks) >= autoMinBlocks && instrs <= autoMaxInstrs
+	}
+	return true
 }
 
-// Obfuscate obfuscates control flow of all functions with directive using control flattening.
-// All obfuscated functions are removed from the original file and moved to the new one.
+// Obfuscate obfuscates control flow of the selected functions using control flattening.
+// All obfuscated functions are removed from the original file and moved to the new one,
+// along with the imports which only they used, so info must describe the original files.
+//
+// With [ModeAnnotated], only the functions with the directive are obfuscated.
+// Other modes also select functions without the directive; see [eligible] and [Config.Skip].
+// Functions which cannot be converted back to Go syntax are then left unchanged,
+// unless they have the directive.
+//
 // Obfuscation can be customized by passing parameters from the directive, example:
 //
 // //garble:controlflow flatten_passes=1 junk_jumps=0 block_splits=0
@@ -106,53 +223,78 @@ func parseDirective(directive string) (directiveParamMap, bool) {
 // flatten_passes - controls number of passes of control flow flattening. Have exponential complexity and more than 3 passes are not recommended in most cases.
 // junk_jumps - controls how many junk jumps are added. It does not affect final binary by itself, but together with flattening linearly increases complexity.
 // block_splits - controls number of times largest block must be splitted. Together with flattening improves obfuscation of long blocks without branches.
-func Obfuscate(fset *token.FileSet, ssaPkg *ssa.Package, files []*ast.File, obfRand *mathrand.Rand) (newFileName string, newFile *ast.File, affectedFiles []*ast.File, err error) {
-	var ssaFuncs []*ssa.Function
-	var ssaParams []directiveParamMap
+// outline_parts - controls into how many functions the blocks are split, so that the size and boundaries of the function are hidden.
+// outline_merge - if 1, the outlined parts are merged into a function shared with the other functions doing the same.
+//
+// The same parameters can be given in [Config.DefaultParams],
+// which the parameters of each directive override.
+// With [Config.Hot], hot functions are left alone unless annotated,
+// and the rest are obfuscated more heavily by default.
+func Obfuscate(fset *token.FileSet, ssaPkg *ssa.Package, files []*ast.File, info *types.Info, obfRand *mathrand.Rand, cfg Config) (newFileName string, newFile *ast.File, err error) {
+	type candidate struct {
+		file       *ast.File
+		funcDecl   *ast.FuncDecl
+		ssaFunc    *ssa.Function
+		params     directiveParamMap
+		annotated  bool
+		virtualize bool
+	}
+	var candidates []candidate
 
 	for _, file := range files {
-		affected := false
 		for _, decl := range file.Decls {
 			funcDecl, ok := decl.(*ast.FuncDecl)
-			if !ok || funcDecl.Doc == nil {
+			if !ok {
 				continue
 			}
 
-			for _, comment := range funcDecl.Doc.List {
-				params, hasDirective := parseDirective(comment.Text)
-				if !hasDirective {
-					continue
-				}
-
-				path, _ := astutil.PathEnclosingInterval(file, funcDecl.Pos(), funcDecl.Pos())
-				ssaFunc := ssa.EnclosingFunction(ssaPkg, path)
-				if ssaFunc == nil {
-					panic("function exists in ast but not found in ssa")
+			var params directiveParamMap
+			annotated := false
+			if funcDecl.Doc != nil {
+				for _, comment := range funcDecl.Doc.List {
+					if params, annotated = parseDirective(comment.Text); annotated {
+						break
+					}
 				}
+			}
+			// Virtualized functions are not flattened, but they are selected like annotated ones.
+			virtualize := hasVirtualizeDirective(funcDecl)
+			annotated = annotated || virtualize
+			if !annotated && (cfg.Mode == ModeAnnotated || (cfg.Skip != nil && cfg.Skip(funcDecl))) {
+				continue
+			}
+			hot := cfg.Hot != nil && cfg.Hot(funcDecl)
+			if hot && !annotated {
+				log.Printf("skipping controlflow for hot function %s", funcDecl.Name.Name)
+				continue
+			}
 
-				ssaFuncs = append(ssaFuncs, ssaFunc)
-				ssaParams = append(ssaParams, params)
-
-				log.Printf("detected function for controlflow %s (params: %v)", funcDecl.Name.Name, params)
-
-				// Remove inplace function from original file
-				// TODO: implement a complete function removal
-				funcDecl.Name = ast.NewIdent("_")
-				funcDecl.Body = ah.BlockStmt()
-				funcDecl.Recv = nil
-				funcDecl.Type = &ast.FuncType{Params: &ast.FieldList{}}
-				affected = true
-
-				break
+			path, _ := astutil.PathEnclosingInterval(file, funcDecl.Pos(), funcDecl.Pos())
+			ssaFunc := ssa.EnclosingFunction(ssaPkg, path)
+			if annotated && ssaFunc == nil {
+				panic("function exists in ast but not found in ssa")
+			}
+			if !annotated && !eligible(funcDecl, ssaFunc, cfg.Mode) {
+				continue
 			}
-		}
 
-		if affected {
-			affectedFiles = append(affectedFiles, file)
+			merged := make(directiveParamMap)
+			if cfg.Hot != nil && !hot {
+				maps.Copy(merged, parseParams(coldParams))
+			}
+			maps.Copy(merged, parseParams(cfg.DefaultParams))
+			maps.Copy(merged, params)
+			candidates = append(candidates, candidate{file, funcDecl, ssaFunc, merged, annotated, virtualize})
+
+			if virtualize {
+				log.Printf("detected function for virtualization %s", funcDecl.Name.Name)
+			} else {
+				log.Printf("detected function for controlflow %s (params: %v)", funcDecl.Name.Name, merged)
+			}
 		}
 	}
 
-	if len(ssaFuncs) == 0 {
+	if len(candidates) == 0 {
 		return
 	}
 
@@ -179,38 +321,81 @@ func Obfuscate(fset *token.FileSet, ssaPkg *ssa.Package, files []*ast.File, obfR
 	}
 
 	var trashGen *trashGenerator
+	var trashState *opaqueState
+	var trashStateDecl ast.Decl
+	var vm *virtualizer
+	var partDispatch *partDispatcher
+	outlined := 0
+	var affectedFiles []*ast.File
+	affected := make(map[*ast.File]bool)
+
+	// Remove the function from the original file, as it is replaced by the new one.
+	// Unused imports are removed once all functions have been removed.
+	removeOriginal := func(cand candidate) {
+		removeDecl(cand.file, cand.funcDecl)
+		if !affected[cand.file] {
+			affected[cand.file] = true
+			affectedFiles = append(affectedFiles, cand.file)
+		}
+	}
+
+	for _, cand := range candidates {
+		ssaFunc, params := cand.ssaFunc, cand.params
 
-	for idx, ssaFunc := range ssaFuncs {
-		params := ssaParams[idx]
+		if cand.virtualize {
+			if vm == nil {
+				vm = newVirtualizer(ssaPkg.Pkg, funcConfig.ImportNameResolver, obfRand)
+			}
+			astFunc, err := vm.virtualize(ssaFunc)
+			if err != nil {
+				return "", nil, fmt.Errorf("cannot virtualize %s: %w", ssaFunc, err)
+			}
+			newFile.Decls = append(newFile.Decls, astFunc)
+			removeOriginal(cand)
+			continue
+		}
 
 		split, err := params.GetInt("block_splits", defaultBlockSplits, maxBlockSplits)
 		if err != nil {
-			return "", nil, nil, fmt.Errorf("controlflow directive on %s: %w", ssaFunc, err)
+			return "", nil, fmt.Errorf("controlflow directive on %s: %w", ssaFunc, err)
 		}
 		junkCount, err := params.GetInt("junk_jumps", defaultJunkJumps, maxJunkJumps)
 		if err != nil {
-			return "", nil, nil, fmt.Errorf("controlflow directive on %s: %w", ssaFunc, err)
+			return "", nil, fmt.Errorf("controlflow directive on %s: %w", ssaFunc, err)
 		}
 		passes, err := params.GetInt("flatten_passes", defaultFlattenPasses, maxFlattenPasses)
 		if err != nil {
-			return "", nil, nil, fmt.Errorf("controlflow directive on %s: %w", ssaFunc, err)
-		}
-		if passes == 0 {
-			fmt.Fprintf(os.Stderr, "control flow obfuscation for %q function has no effect on the resulting binary, to fix this flatten_passes must be greater than zero", ssaFunc)
+			return "", nil, fmt.Errorf("controlflow directive on %s: %w", ssaFunc, err)
 		}
 		flattenHardening := params.StringSlice("flatten_hardening")
 
 		trashBlockCount, err := params.GetInt("trash_blocks", defaultTrashBlocks, maxTrashBlocks)
 		if err != nil {
-			return "", nil, nil, fmt.Errorf("controlflow directive on %s: %w", ssaFunc, err)
+			return "", nil, fmt.Errorf("controlflow directive on %s: %w", ssaFunc, err)
+		}
+		outlineParts, err := params.GetInt("outline_parts", defaultOutlineParts, maxOutlineParts)
+		if err != nil {
+			return "", nil, fmt.Errorf("controlflow directive on %s: %w", ssaFunc, err)
+		}
+		outlineMerge, err := params.GetInt("outline_merge", defaultOutlineMerge, maxOutlineMerge)
+		if err != nil {
+			return "", nil, fmt.Errorf("controlflow directive on %s: %w", ssaFunc, err)
+		}
+		if outlineMerge > 0 {
+			outlineParts = max(outlineParts, 1)
+		}
+		if passes == 0 && outlineParts == 0 && cand.annotated {
+			fmt.Fprintf(os.Stderr, "control flow obfuscation for %q function has no effect on the resulting binary, to fix this flatten_passes must be greater than zero", ssaFunc)
 		}
 		if trashBlockCount > 0 && trashGen == nil {
 			trashGen = newTrashGenerator(ssaPkg.Prog, funcConfig.ImportNameResolver, obfRand)
+			trashState, trashStateDecl = newOpaqueState(obfRand)
 		}
 
+		var trashConds []ssa.Value
 		applyObfuscation := func(ssaFunc *ssa.Function) []dispatcherInfo {
 			if trashBlockCount > 0 {
-				addTrashBlockMarkers(ssaFunc, trashBlockCount, obfRand)
+				trashConds = append(trashConds, addTrashBlockMarkers(ssaFunc, trashBlockCount, obfRand)...)
 			}
 			for range split {
 				if !applySplitting(ssaFunc, obfRand) {
@@ -238,23 +423,27 @@ func Obfuscate(fset *token.FileSet, ssaPkg *ssa.Package, files []*ast.File, obfR
 		// Because of ssa package api limitations, implementation of hardening for control flow flattening dispatcher
 		// is implemented during converting by replacing key values with obfuscated ast expressions
 		var prologues []ast.Stmt
+		var hardeningDecls []ast.Decl
+		ssaRemap := make(map[ssa.Value]ast.Expr)
 		if len(flattenHardening) > 0 && len(dispatchers) > 0 {
 			hardening := newDispatcherHardening(flattenHardening)
 
-			ssaRemap := make(map[ssa.Value]ast.Expr)
 			for _, dispatcher := range dispatchers {
 				decl, stmt := hardening.Apply(dispatcher, ssaRemap, obfRand)
 				if decl != nil {
-					newFile.Decls = append(newFile.Decls, decl)
+					hardeningDecls = append(hardeningDecls, decl)
 				}
 				if stmt != nil {
 					prologues = append(prologues, stmt)
 				}
 			}
-			funcConfig.SsaValueRemap = ssaRemap
-		} else {
-			funcConfig.SsaValueRemap = nil
 		}
+		// The trash blocks are guarded by opaque predicates rather than constants,
+		// so that the compiler cannot remove them as dead code.
+		for _, cond := range trashConds {
+			ssaRemap[cond] = opaqueFalse(obfRand, trashState.load)
+		}
+		funcConfig.SsaValueRemap = ssaRemap
 
 		funcConfig.MarkerInstrCallback = nil
 		if trashBlockCount > 0 {
@@ -263,16 +452,71 @@ func Obfuscate(fset *token.FileSet, ssaPkg *ssa.Package, files []*ast.File, obfR
 			}
 		}
 
+		if outlineParts > 0 {
+			// Labels must be unique within the function merging parts,
+			// so each outlined function uses its own prefix.
+			outlineConfig := *funcConfig
+			outlineConfig.NamePrefix = "_s2a" + strconv.Itoa(outlined) + "_"
+			result, err := ssa2ast.ConvertOutlined(ssaFunc, &outlineConfig, newOutline(ssaFunc, outlineParts, obfRand))
+			if err == nil {
+				outlined++
+				for _, prologue := range prologues {
+					hardeningDecls = append(hardeningDecls, prologueDecl(prologue))
+				}
+				newFile.Decls = append(newFile.Decls, hardeningDecls...)
+				newFile.Decls = append(newFile.Decls, result.Context, result.Func)
+				if outlineMerge > 0 {
+					if partDispatch == nil {
+						partDispatch = newPartDispatcher(obfRand)
+					}
+					partDispatch.Add(result)
+				} else {
+					for _, i := range obfRand.Perm(len(result.Parts)) {
+						newFile.Decls = append(newFile.Decls, result.Parts[i])
+					}
+				}
+				removeOriginal(cand)
+				continue
+			}
+			if !errors.Is(err, ssa2ast.ErrUnsupported) {
+				return "", nil, err
+			}
+			// Flattening still applies to functions which cannot be outlined.
+			log.Printf("skipping outlining for %s: %v", ssaFunc, err)
+		}
+
 		astFunc, err := ssa2ast.Convert(ssaFunc, funcConfig)
 		if err != nil {
-			return "", nil, nil, err
+			if !cand.annotated && errors.Is(err, ssa2ast.ErrUnsupported) {
+				// Leave the original function in place.
+				log.Printf("skipping controlflow for %s: %v", ssaFunc, err)
+				continue
+			}
+			return "", nil, err
 		}
 		if len(prologues) > 0 {
 			astFunc.Body.List = append(prologues, astFunc.Body.List...)
 		}
+		newFile.Decls = append(newFile.Decls, hardeningDecls...)
 		newFile.Decls = append(newFile.Decls, astFunc)
+		removeOriginal(cand)
+	}
+	if vm != nil {
+		newFile.Decls = append(newFile.Decls, vm.Decls()...)
+	}
+	if partDispatch != nil {
+		newFile.Decls = append(newFile.Decls, partDispatch.Decl(obfRand))
+	}
+	for _, file := range affectedFiles {
+		removeUnusedImports(fset, file, info)
 	}
 
+	if len(newFile.Decls) == 0 {
+		return "", nil, nil
+	}
+	if trashStateDecl != nil {
+		newFile.Decls = append(newFile.Decls, trashStateDecl)
+	}
 	newFileName = mergedFileName
 	return
 }
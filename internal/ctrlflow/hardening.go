@@ -15,6 +15,7 @@ import (
 var hardeningMap = map[string]dispatcherHardening{
 	"xor":            xorHardening{},
 	"delegate_table": delegateTableHardening{},
+	"opaque":         opaqueHardening{},
 }
 
 func newDispatcherHardening(names []string) dispatcherHardening {
@@ -0,0 +1,150 @@
+package ctrlflow
+
+import (
+	"go/ast"
+	"go/token"
+	mathrand "math/rand"
+
+	"golang.org/x/tools/go/ssa"
+	ah "mvdan.cc/garble/internal/asthelper"
+)
+
+// opaqueState is a package-level variable read by opaque predicates,
+// along with a package-level pointer to it:
+//
+//	var <name> = <random int>
+//	var <ptrName> = &<name>
+//
+// Since both are variables, the compiler cannot fold the predicates reading them,
+// and a decompiler has to prove what the pointer points to and that neither changes.
+type opaqueState struct {
+	name, ptrName string
+}
+
+func newOpaqueState(rnd *mathrand.Rand) (*opaqueState, ast.Decl) {
+	s := &opaqueState{name: getRandomName(rnd), ptrName: getRandomName(rnd)}
+	decl := &ast.GenDecl{
+		Tok: token.VAR,
+		Specs: []ast.Spec{
+			&ast.ValueSpec{
+				Names:  []*ast.Ident{ast.NewIdent(s.name)},
+				Values: []ast.Expr{ah.IntLit(int(rnd.Int31()))},
+			},
+			&ast.ValueSpec{
+				Names:  []*ast.Ident{ast.NewIdent(s.ptrName)},
+				Values: []ast.Expr{ah.UnaryExpr(token.AND, ast.NewIdent(s.name))},
+			},
+		},
+	}
+	return s, decl
+}
+
+// load returns an expression reading the state via its pointer.
+func (s *opaqueState) load() ast.Expr {
+	return ah.StarExpr(ast.NewIdent(s.ptrName))
+}
+
+// opaqueZero returns an int expression which is always zero,
+// built from number-theoretic identities over the value returned by x.
+// These hold for any int, even when the arithmetic overflows,
+// as they only depend on the lowest bits of the result.
+// The x func is called once for each use of the value, and must not have side effects.
+func opaqueZero(rnd *mathrand.Rand, x func() ast.Expr) ast.Expr {
+	// Mix in a random constant, so that each predicate uses a different value.
+	mask := ah.IntLit(int(rnd.Int31()))
+	v := func() ast.Expr {
+		return &ast.ParenExpr{X: ah.BinaryExpr(x(), token.XOR, mask)}
+	}
+	switch rnd.Intn(4) {
+	case 0:
+		// The product of two consecutive numbers is even.
+		//
+		//	v * (v + 1) & 1
+		return ah.BinaryExpr(
+			ah.BinaryExpr(v(), token.MUL, &ast.ParenExpr{X: ah.BinaryExpr(v(), token.ADD, ah.IntLit(1))}),
+			token.AND, ah.IntLit(1),
+		)
+	case 1:
+		// A square is 0 or 1 modulo 4.
+		//
+		//	v * v & 2
+		return ah.BinaryExpr(ah.BinaryExpr(v(), token.MUL, v()), token.AND, ah.IntLit(2))
+	case 2:
+		// The product of three consecutive numbers, v*v*v - v, is even.
+		//
+		//	(v*v*v - v) & 1
+		cube := ah.BinaryExpr(ah.BinaryExpr(v(), token.MUL, v()), token.MUL, v())
+		return ah.BinaryExpr(&ast.ParenExpr{X: ah.BinaryExpr(cube, token.SUB, v())}, token.AND, ah.IntLit(1))
+	default:
+		// The square of an odd number is 1 modulo 8.
+		//
+		//	(v | 1) * (v | 1) & 7 ^ 1
+		odd := func() ast.Expr { return &ast.ParenExpr{X: ah.BinaryExpr(v(), token.OR, ah.IntLit(1))} }
+		return ah.BinaryExpr(
+			ah.BinaryExpr(ah.BinaryExpr(odd(), token.MUL, odd()), token.AND, ah.IntLit(7)),
+			token.XOR, ah.IntLit(1),
+		)
+	}
+}
+
+// opaqueFalse returns a bool expression which is always false,
+// reading the value returned by x like [opaqueZero].
+func opaqueFalse(rnd *mathrand.Rand, x func() ast.Expr) ast.Expr {
+	if rnd.Intn(3) > 0 {
+		return ah.BinaryExpr(opaqueZero(rnd, x), token.NEQ, ah.IntLit(0))
+	}
+	// 7*b*b - 1 is 6 modulo 7, which no square is.
+	// The operands are kept under 16 bits, so that the products fit in an int64.
+	//
+	//	7*b*b - 1 == a*a
+	shift := rnd.Intn(17)
+	half := func(shift int) ast.Expr {
+		return ah.CallExprByName("int64", ah.BinaryExpr(
+			&ast.ParenExpr{X: ah.BinaryExpr(x(), token.SHR, ah.IntLit(shift))},
+			token.AND, ah.IntLit(0xffff),
+		))
+	}
+	a, b := shift, 16-shift
+	return ah.BinaryExpr(
+		ah.BinaryExpr(
+			ah.BinaryExpr(ah.BinaryExpr(ah.IntLit(7), token.MUL, half(b)), token.MUL, half(b)),
+			token.SUB, ah.IntLit(1),
+		),
+		token.EQL,
+		ah.BinaryExpr(half(a), token.MUL, half(a)),
+	)
+}
+
+// opaqueHardening replaces the keys of the dispatcher with expressions
+// which add opaque zeros to them, over a value loaded from an [opaqueState]
+// when the function starts. Unlike the xor and delegate_table hardenings,
+// the keys cannot be computed from constants in the binary alone.
+type opaqueHardening struct{}
+
+func (opaqueHardening) Apply(dispatcher []cfgInfo, ssaRemap map[ssa.Value]ast.Expr, rnd *mathrand.Rand) (ast.Decl, ast.Stmt) {
+	state, decl := newOpaqueState(rnd)
+	localName := getRandomName(rnd)
+	local := func() ast.Expr { return ast.NewIdent(localName) }
+
+	keys := generateKeys(len(dispatcher), nil, rnd)
+	for i, info := range dispatcher {
+		k := keys[i]
+		r := int(rnd.Int31())
+
+		// The key is split into two random halves, one of which is hidden:
+		//
+		//	<k ^ r> ^ (<r> + <opaque zero>)
+		var hidden ast.Expr
+		switch zero := opaqueZero(rnd, local); rnd.Intn(3) {
+		case 0:
+			hidden = ah.BinaryExpr(ah.IntLit(r), token.ADD, zero)
+		case 1:
+			hidden = ah.BinaryExpr(ah.IntLit(r), token.SUB, zero)
+		default:
+			hidden = ah.BinaryExpr(ah.IntLit(r), token.OR, zero)
+		}
+		ssaRemap[info.CompareVar] = ah.IntLit(k)
+		ssaRemap[info.StoreVar] = &ast.ParenExpr{X: ah.BinaryExpr(ah.IntLit(k^r), token.XOR, &ast.ParenExpr{X: hidden})}
+	}
+	return decl, ah.AssignDefineStmt(ast.NewIdent(localName), state.load())
+}
@@ -0,0 +1,87 @@
+package ctrlflow
+
+import (
+	"bytes"
+	"go/ast"
+	"go/printer"
+	"go/token"
+	mathrand "math/rand"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-quicktest/qt"
+	ah "mvdan.cc/garble/internal/asthelper"
+)
+
+// Test_opaquePredicates checks that the generated predicates hold for edge values and random ones,
+// by running a program which prints the predicates which do not.
+func Test_opaquePredicates(t *testing.T) {
+	if testing.Short() {
+		t.Skip("requires building a program")
+	}
+	const (
+		seed       = 7777
+		predicates = 256
+	)
+	rnd := mathrand.New(mathrand.NewSource(seed))
+	x := func() ast.Expr { return ast.NewIdent("x") }
+
+	var body []ast.Stmt
+	for i := range predicates {
+		var cond ast.Expr
+		if i%2 == 0 {
+			cond = ah.BinaryExpr(opaqueZero(rnd, x), token.NEQ, ah.IntLit(0))
+		} else {
+			cond = opaqueFalse(rnd, x)
+		}
+		body = append(body, &ast.IfStmt{
+			Cond: cond,
+			Body: ah.BlockStmt(ah.ExprStmt(ah.CallExprByName("println", ah.IntLit(i), ast.NewIdent("x")))),
+		})
+	}
+
+	values := []string{"0", "1", "-1", "2", "-2", "7", "0xffff", "0x10000", "-0x10000", "math.MaxInt32", "math.MinInt32", "math.MaxInt", "math.MinInt"}
+	for range 16 {
+		values = append(values, ah.IntLit(int(rnd.Int63())).Value, "-"+ah.IntLit(int(rnd.Int63())).Value)
+	}
+	var valuesExpr []ast.Expr
+	for _, v := range values {
+		valuesExpr = append(valuesExpr, ast.NewIdent(v))
+	}
+
+	file := &ast.File{
+		Name: ast.NewIdent("main"),
+		Decls: []ast.Decl{
+			&ast.GenDecl{
+				Tok:   token.IMPORT,
+				Specs: []ast.Spec{&ast.ImportSpec{Path: ah.StringLit("math")}},
+			},
+			&ast.FuncDecl{
+				Name: ast.NewIdent("main"),
+				Type: &ast.FuncType{Params: &ast.FieldList{}},
+				Body: ah.BlockStmt(&ast.RangeStmt{
+					Key:   ast.NewIdent("_"),
+					Value: ast.NewIdent("x"),
+					Tok:   token.DEFINE,
+					X: &ast.CompositeLit{
+						Type: &ast.ArrayType{Elt: ast.NewIdent("int")},
+						Elts: valuesExpr,
+					},
+					Body: ah.BlockStmt(body...),
+				}),
+			},
+		},
+	}
+
+	var src bytes.Buffer
+	qt.Assert(t, qt.IsNil(printer.Fprint(&src, token.NewFileSet(), file)))
+	dir := t.TempDir()
+	path := filepath.Join(dir, "main.go")
+	qt.Assert(t, qt.IsNil(os.WriteFile(path, src.Bytes(), 0o666)))
+
+	out, err := exec.Command("go", "run", path).CombinedOutput()
+	qt.Assert(t, qt.IsNil(err), qt.Commentf("%s", out))
+	qt.Assert(t, qt.Equals(string(out), ""))
+}
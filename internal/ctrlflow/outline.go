@@ -0,0 +1,114 @@
+package ctrlflow
+
+import (
+	"go/ast"
+	"go/token"
+	mathrand "math/rand"
+
+	"golang.org/x/tools/go/ssa"
+	ah "mvdan.cc/garble/internal/asthelper"
+	"mvdan.cc/garble/internal/ssa2ast"
+)
+
+// newOutline randomly spreads the blocks of a function over the given number of parts,
+// or fewer if the function does not have enough blocks.
+func newOutline(ssaFunc *ssa.Function, parts int, obfRand *mathrand.Rand) *ssa2ast.Outline {
+	parts = min(parts, len(ssaFunc.Blocks))
+	outline := &ssa2ast.Outline{
+		Parts:       make([][]int, parts),
+		Keys:        generateKeys(len(ssaFunc.Blocks), nil, obfRand),
+		ContextName: getRandomName(obfRand),
+	}
+	for i, idx := range obfRand.Perm(len(ssaFunc.Blocks)) {
+		// The first blocks of the permutation ensure that no part is empty.
+		part := i
+		if i >= parts {
+			part = obfRand.Intn(parts)
+		}
+		outline.Parts[part] = append(outline.Parts[part], idx)
+	}
+	for range parts {
+		outline.PartNames = append(outline.PartNames, getRandomName(obfRand))
+	}
+	return outline
+}
+
+// prologueDecl turns the prologue of a dispatcher hardening, which declares local variables,
+// into a declaration of package-level variables with the same values.
+// This is needed for outlined functions, whose parts do not share local variables.
+// The values are only read from package-level variables which never change,
+// so they are the same when computed once at init time.
+func prologueDecl(prologue ast.Stmt) ast.Decl {
+	assign := prologue.(*ast.AssignStmt)
+	spec := &ast.ValueSpec{Values: assign.Rhs}
+	for _, lhs := range assign.Lhs {
+		spec.Names = append(spec.Names, lhs.(*ast.Ident))
+	}
+	return &ast.GenDecl{Tok: token.VAR, Specs: []ast.Spec{spec}}
+}
+
+// partDispatcher merges the parts of outlined functions into a single function,
+// so that unrelated functions share their code:
+//
+//	func <name>(id int, ctx any) {
+//		switch id {
+//		case <id>:
+//			<ctx param of the part> := ctx.(<context type of the part>)
+//			<statements of the part>
+//		}
+//	}
+type partDispatcher struct {
+	name, idName, ctxName string
+
+	parts []*ast.FuncDecl
+	calls []*ast.CallExpr
+}
+
+func newPartDispatcher(obfRand *mathrand.Rand) *partDispatcher {
+	return &partDispatcher{
+		name:    getRandomName(obfRand),
+		idName:  getRandomName(obfRand),
+		ctxName: getRandomName(obfRand),
+	}
+}
+
+// Add adds the parts of an outlined function to the dispatcher.
+func (d *partDispatcher) Add(outlined *ssa2ast.OutlinedFunc) {
+	d.parts = append(d.parts, outlined.Parts...)
+	d.calls = append(d.calls, outlined.Calls...)
+}
+
+// Decl returns the declaration of the dispatcher,
+// replacing the calls to each part with calls to the dispatcher.
+func (d *partDispatcher) Decl(obfRand *mathrand.Rand) ast.Decl {
+	ids := generateKeys(len(d.parts), nil, obfRand)
+	body := &ast.BlockStmt{}
+	for i, part := range d.parts {
+		call := d.calls[i]
+		call.Fun = ast.NewIdent(d.name)
+		call.Args = []ast.Expr{ah.IntLit(ids[i]), call.Args[0]}
+
+		param := part.Type.Params.List[0]
+		clause := &ast.CaseClause{
+			List: []ast.Expr{ah.IntLit(ids[i])},
+			Body: []ast.Stmt{ah.AssignDefineStmt(param.Names[0], &ast.TypeAssertExpr{
+				X:    ast.NewIdent(d.ctxName),
+				Type: param.Type,
+			})},
+		}
+		clause.Body = append(clause.Body, part.Body.List...)
+		body.List = append(body.List, clause)
+	}
+	obfRand.Shuffle(len(body.List), func(i, j int) {
+		body.List[i], body.List[j] = body.List[j], body.List[i]
+	})
+
+	return &ast.FuncDecl{
+		Name: ast.NewIdent(d.name),
+		Type: &ast.FuncType{Params: &ast.FieldList{List: []*ast.Field{
+			{Names: []*ast.Ident{ast.NewIdent(d.idName)}, Type: ast.NewIdent("int")},
+			{Names: []*ast.Ident{ast.NewIdent(d.ctxName)}, Type: &ast.InterfaceType{Methods: &ast.FieldList{}}},
+		}}},
+		Body: ah.BlockStmt(&ast.SwitchStmt{Tag: ast.NewIdent(d.idName), Body: body}),
+	}
+}
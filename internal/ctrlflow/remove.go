@@ -0,0 +1,98 @@
+package ctrlflow
+
+import (
+	"go/ast"
+	"go/token"
+	"go/types"
+	"slices"
+	"strconv"
+	"strings"
+
+	"golang.org/x/tools/go/ast/astutil"
+)
+
+// removeDecl removes a declaration from a file,
+// along with its doc comment and the comments and directives within it.
+func removeDecl(file *ast.File, decl ast.Decl) {
+	file.Decls = slices.DeleteFunc(file.Decls, func(d ast.Decl) bool { return d == decl })
+
+	start, end := decl.Pos(), decl.End()
+	if funcDecl, ok := decl.(*ast.FuncDecl); ok && funcDecl.Doc != nil {
+		start = funcDecl.Doc.Pos()
+	}
+	file.Comments = slices.DeleteFunc(file.Comments, func(group *ast.CommentGroup) bool {
+		return group.Pos() >= start && group.End() <= end
+	})
+}
+
+// removeUnusedImports removes the imports of a file which are no longer used
+// after removing declarations, according to the type information of the original file.
+// Blank imports are always kept, as they are not used by name.
+// An unused "unsafe" import is turned into a blank import if the file has any
+// //go:linkname directives, as the compiler only allows them when importing unsafe.
+func removeUnusedImports(fset *token.FileSet, file *ast.File, info *types.Info) {
+	usedNames := make(map[*types.PkgName]bool)
+	usedPkgs := make(map[*types.Package]bool)
+	ast.Inspect(file, func(node ast.Node) bool {
+		ident, ok := node.(*ast.Ident)
+		if !ok {
+			return true
+		}
+		switch obj := info.Uses[ident].(type) {
+		case nil:
+		case *types.PkgName:
+			usedNames[obj] = true
+		default:
+			// Dot imports make package-level objects usable without a qualifier.
+			if pkg := obj.Pkg(); pkg != nil && obj.Parent() == pkg.Scope() {
+				usedPkgs[pkg] = true
+			}
+		}
+		return true
+	})
+
+	var unused []*ast.ImportSpec
+	for _, imp := range file.Imports {
+		if imp.Name != nil && imp.Name.Name == "_" {
+			continue
+		}
+		pkgName := info.PkgNameOf(imp)
+		if pkgName == nil {
+			continue // e.g. import "C"
+		}
+		if imp.Name != nil && imp.Name.Name == "." {
+			if !usedPkgs[pkgName.Imported()] {
+				unused = append(unused, imp)
+			}
+		} else if !usedNames[pkgName] {
+			unused = append(unused, imp)
+		}
+	}
+	for _, imp := range unused {
+		name := ""
+		if imp.Name != nil {
+			name = imp.Name.Name
+		}
+		path, err := strconv.Unquote(imp.Path.Value)
+		if err != nil {
+			panic(err) // should never happen
+		}
+		if path == "unsafe" && hasLinkname(file) {
+			imp.Name = ast.NewIdent("_")
+			continue
+		}
+		astutil.DeleteNamedImport(fset, file, name, path)
+	}
+}
+
+// hasLinkname reports whether a file has any //go:linkname directives.
+func hasLinkname(file *ast.File) bool {
+	for _, group := range file.Comments {
+		for _, comment := range group.List {
+			if strings.HasPrefix(comment.Text, "//go:linkname ") {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -220,29 +220,11 @@ func applySplitting(ssaFunc *ssa.Function, obfRand *mathrand.Rand) bool {
 	return true
 }
 
-// randomAlwaysFalseCond generates two random int32 and a random compare operator that always returns false, examples:
-// 1350205738 <= 734900678
-// 1400381511 >= 1621623831
-// 2062290251 < 1908004916
-// 1228588894 > 1819094321
-// 2094727349 == 955574490
-func randomAlwaysFalseCond(obfRand *mathrand.Rand) (*ssa.Const, token.Token, *ssa.Const) {
-	tokens := []token.Token{token.EQL, token.NEQ, token.LSS, token.LEQ, token.GTR, token.GEQ}
-
-	val1, val2 := constant.MakeInt64(int64(obfRand.Int31())), constant.MakeInt64(int64(obfRand.Int31()))
-
-	var candidates []token.Token
-	for _, t := range tokens {
-		if !constant.Compare(val1, t, val2) {
-			candidates = append(candidates, t)
-		}
-	}
-
-	return ssa.NewConst(val1, types.Typ[types.Int]), candidates[obfRand.Intn(len(candidates))], ssa.NewConst(val2, types.Typ[types.Int])
-}
-
-// addTrashBlockMarkers adds unreachable blocks with ssa2ast.MarkerInstr to further generate trash statements
-func addTrashBlockMarkers(ssaFunc *ssa.Function, count int, obfRand *mathrand.Rand) {
+// addTrashBlockMarkers adds unreachable blocks with ssa2ast.MarkerInstr to further generate trash statements.
+// The conditions guarding the blocks are always false, and are returned so that they can be replaced
+// with opaque predicates when converting back to Go syntax, as constants would let the compiler
+// remove the blocks entirely.
+func addTrashBlockMarkers(ssaFunc *ssa.Function, count int, obfRand *mathrand.Rand) (conds []ssa.Value) {
 	var candidates []*ssa.BasicBlock
 	for _, block := range ssaFunc.Blocks {
 		if len(block.Succs) > 0 {
@@ -251,7 +233,7 @@ func addTrashBlockMarkers(ssaFunc *ssa.Function, count int, obfRand *mathrand.Ra
 	}
 
 	if len(candidates) == 0 {
-		return
+		return nil
 	}
 
 	for range count {
@@ -259,21 +241,9 @@ func addTrashBlockMarkers(ssaFunc *ssa.Function, count int, obfRand *mathrand.Ra
 		succsIdx := obfRand.Intn(len(targetBlock.Succs))
 		succs := targetBlock.Succs[succsIdx]
 
-		val1, op, val2 := randomAlwaysFalseCond(obfRand)
-		phiInstr := &ssa.Phi{
-			Edges: []ssa.Value{val1},
-		}
-		setType(phiInstr, types.Typ[types.Int])
-
-		binOpInstr := &ssa.BinOp{
-			X:  phiInstr,
-			Op: op,
-			Y:  val2,
-		}
-		setType(binOpInstr, types.Typ[types.Bool])
-
-		jmpInstr := &ssa.If{Cond: binOpInstr}
-		*binOpInstr.Referrers() = append(*binOpInstr.Referrers(), jmpInstr)
+		cond := ssa.NewConst(constant.MakeBool(false), types.Typ[types.Bool])
+		conds = append(conds, cond)
+		jmpInstr := &ssa.If{Cond: cond}
 
 		trashBlock := &ssa.BasicBlock{
 			Comment: "ctrflow.trash." + strconv.Itoa(targetBlock.Index),
@@ -287,8 +257,6 @@ func addTrashBlockMarkers(ssaFunc *ssa.Function, count int, obfRand *mathrand.Ra
 		trashBlockDispatch := &ssa.BasicBlock{
 			Comment: "ctrflow.trash.cond." + strconv.Itoa(targetBlock.Index),
 			Instrs: []ssa.Instruction{
-				phiInstr,
-				binOpInstr,
 				jmpInstr,
 			},
 			Preds: []*ssa.BasicBlock{targetBlock},
@@ -302,6 +270,7 @@ func addTrashBlockMarkers(ssaFunc *ssa.Function, count int, obfRand *mathrand.Ra
 
 		ssaFunc.Blocks = append(ssaFunc.Blocks, trashBlockDispatch, trashBlock)
 	}
+	return conds
 }
 
 func fixBlockIndexes(ssaFunc *ssa.Function) {
@@ -0,0 +1,1122 @@
+package ctrlflow
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/printer"
+	"go/token"
+	"go/types"
+	mathrand "math/rand"
+	"slices"
+	"strconv"
+
+	"golang.org/x/tools/go/ssa"
+	ah "mvdan.cc/garble/internal/asthelper"
+	"mvdan.cc/garble/internal/ssa2ast"
+)
+
+// VirtualizeDirective marks the functions to compile into bytecode
+// which runs on a generated interpreter, rather than flattening them.
+const VirtualizeDirective = "//garble:virtualize"
+
+// vmWordKind is the kind of a word of bytecode before it is encoded.
+type vmWordKind uint8
+
+const (
+	vmValue  vmWordKind = iota // a register index or a count
+	vmOpcode                   // the opcode of a handler
+	vmLabel                    // the address of a label
+)
+
+type vmWord struct {
+	kind    vmWordKind
+	n       int
+	handler *vmHandler
+}
+
+// vmHandler is an instruction of the virtual machine, implemented by the statements
+// of a case in the interpreter's switch. The statements read their operands
+// from the bytecode as they need them.
+type vmHandler struct {
+	body   []ast.Stmt
+	opcode int
+}
+
+// vmChunk is a sequence of bytecode starting at a label,
+// such as the code for a basic block.
+type vmChunk struct {
+	label int
+	words []vmWord
+}
+
+// vmProgram is the bytecode of a single virtualized function.
+type vmProgram struct {
+	codeName string
+	chunks   []*vmChunk
+}
+
+// virtualizer compiles the SSA of functions into bytecode for a virtual machine.
+// The interpreter is generated along with the bytecode, and is shared by all the functions
+// virtualized in a package. Its opcodes, the order of its handlers, and the encoding
+// of the bytecode are all random, so that each build has a different instruction set.
+//
+// The registers of the virtual machine hold values of any type, and each handler
+// asserts the types of the operands it reads, so that it can use them as in regular Go code.
+// Tuples, such as the results of calls, are held as []any.
+type virtualizer struct {
+	pkg *types.Package
+	tc  *ssa2ast.TypeConverter
+	rnd *mathrand.Rand
+
+	resolver ssa2ast.ImportNameResolver
+
+	handlers    map[string]*vmHandler
+	handlerList []*vmHandler
+	programs    []*vmProgram
+
+	// The names used by the interpreter, which are random to not clash with the package's names.
+	funcName, codeName, regsName, pcName, fetchName, argPrefix string
+
+	// The bytecode word at address i is encoded by xoring it with key + i*mul.
+	key, mul uint32
+
+	jmp, cond, move, ret *vmHandler
+}
+
+func newVirtualizer(pkg *types.Package, resolver ssa2ast.ImportNameResolver, rnd *mathrand.Rand) *virtualizer {
+	v := &virtualizer{
+		pkg:       pkg,
+		tc:        ssa2ast.NewTypeConverted(resolver),
+		rnd:       rnd,
+		resolver:  resolver,
+		handlers:  make(map[string]*vmHandler),
+		funcName:  getRandomName(rnd),
+		codeName:  getRandomName(rnd),
+		regsName:  getRandomName(rnd),
+		pcName:    getRandomName(rnd),
+		fetchName: getRandomName(rnd),
+		argPrefix: getRandomName(rnd),
+		key:       rnd.Uint32(),
+		mul:       rnd.Uint32() | 1,
+	}
+
+	// pc = fetch()
+	v.jmp = v.handler([]ast.Stmt{ah.AssignStmt(v.pc(), v.fetch())})
+
+	// if c, _ := regs[fetch()].(bool); c { pc = fetch() } else { fetch(); pc = fetch() }
+	cond := ast.NewIdent(v.argPrefix)
+	v.cond = v.handler([]ast.Stmt{&ast.IfStmt{
+		Init: &ast.AssignStmt{
+			Lhs: []ast.Expr{cond, ast.NewIdent("_")},
+			Tok: token.DEFINE,
+			Rhs: []ast.Expr{&ast.TypeAssertExpr{X: v.reg(v.fetch()), Type: ast.NewIdent("bool")}},
+		},
+		Cond: ast.NewIdent(v.argPrefix),
+		Body: ah.BlockStmt(ah.AssignStmt(v.pc(), v.fetch())),
+		Else: ah.BlockStmt(ah.ExprStmt(v.fetch()), ah.AssignStmt(v.pc(), v.fetch())),
+	}})
+
+	// d := fetch(); regs[d] = regs[fetch()]
+	dst := v.arg("d")
+	v.move = v.handler([]ast.Stmt{
+		ah.AssignDefineStmt(dst, v.fetch()),
+		ah.AssignStmt(v.reg(v.arg("d")), v.reg(v.fetch())),
+	})
+
+	// r := make([]any, fetch()); for i := range r { r[i] = regs[fetch()] }; return r
+	v.ret = v.handler([]ast.Stmt{
+		ah.AssignDefineStmt(v.arg("r"), ah.CallExprByName("make", anySliceType(), v.fetch())),
+		&ast.RangeStmt{
+			Key: v.arg("i"),
+			Tok: token.DEFINE,
+			X:   v.arg("r"),
+			Body: ah.BlockStmt(
+				ah.AssignStmt(ah.IndexExprByExpr(v.arg("r"), v.arg("i")), v.reg(v.fetch())),
+			),
+		},
+		ah.ReturnStmt(v.arg("r")),
+	})
+	return v
+}
+
+func anyType() ast.Expr {
+	return &ast.InterfaceType{Methods: &ast.FieldList{}}
+}
+
+func anySliceType() ast.Expr {
+	return &ast.ArrayType{Elt: anyType()}
+}
+
+func (v *virtualizer) arg(name string) *ast.Ident { return ast.NewIdent(v.argPrefix + name) }
+func (v *virtualizer) pc() *ast.Ident             { return ast.NewIdent(v.pcName) }
+func (v *virtualizer) fetch() ast.Expr            { return ah.CallExprByName(v.fetchName) }
+func (v *virtualizer) reg(index ast.Expr) ast.Expr {
+	return ah.IndexExprByExpr(ast.NewIdent(v.regsName), index)
+}
+
+// handler returns the handler with the given statements, reusing an existing one
+// when an instruction with the same types was already compiled.
+func (v *virtualizer) handler(body []ast.Stmt) *vmHandler {
+	var buf bytes.Buffer
+	if err := printer.Fprint(&buf, token.NewFileSet(), &ast.BlockStmt{List: body}); err != nil {
+		panic(err) // should never happen
+	}
+	key := buf.String()
+	if h, ok := v.handlers[key]; ok {
+		return h
+	}
+	h := &vmHandler{body: body}
+	v.handlers[key] = h
+	v.handlerList = append(v.handlerList, h)
+	return h
+}
+
+// typeExpr converts a type for use in the generated code, failing if the type cannot be named there,
+// such as unexported types from other packages, types declared inside functions,
+// or types from packages which are not imported by the package being obfuscated.
+// A named interface type which cannot be named is replaced with its underlying interface.
+// If emulated is true, any other named type which cannot be named is allowed too,
+// as a type assertion to an interface with its exported methods.
+func (v *virtualizer) typeExpr(typ types.Type, emulated bool) (ast.Expr, error) {
+	if named, ok := types.Unalias(typ).(*types.Named); ok && !v.nameable(named) {
+		if iface, ok := named.Underlying().(*types.Interface); ok {
+			typ = iface
+		} else if emulated {
+			var methods []*types.Func
+			for i := range named.NumMethods() {
+				if method := named.Method(i); method.Exported() {
+					methods = append(methods, method)
+				}
+			}
+			typ = types.NewInterfaceType(methods, nil).Complete()
+		}
+	}
+	if !v.nameable(typ) {
+		return nil, fmt.Errorf("type %v cannot be named: %w", typ, ssa2ast.ErrUnsupported)
+	}
+	return v.tc.Convert(typ)
+}
+
+func (v *virtualizer) nameable(typ types.Type) bool {
+	switch typ := types.Unalias(typ).(type) {
+	case *types.Basic:
+		return typ.Info()&types.IsUntyped == 0
+	case *types.Named:
+		obj := typ.Obj()
+		if obj.Pkg() == nil {
+			return true // error, comparable
+		}
+		if obj.Parent() != obj.Pkg().Scope() || (obj.Pkg() != v.pkg && (!obj.Exported() || !v.imported(obj.Pkg()))) {
+			return false
+		}
+		for i := range typ.TypeArgs().Len() {
+			if !v.nameable(typ.TypeArgs().At(i)) {
+				return false
+			}
+		}
+		return true
+	case *types.Pointer:
+		return v.nameable(typ.Elem())
+	case *types.Slice:
+		return v.nameable(typ.Elem())
+	case *types.Array:
+		return v.nameable(typ.Elem())
+	case *types.Chan:
+		return v.nameable(typ.Elem())
+	case *types.Map:
+		return v.nameable(typ.Key()) && v.nameable(typ.Elem())
+	case *types.Signature:
+		return v.nameable(typ.Params()) && v.nameable(typ.Results())
+	case *types.Tuple:
+		for i := range typ.Len() {
+			if !v.nameable(typ.At(i).Type()) {
+				return false
+			}
+		}
+		return true
+	case *types.Struct:
+		for i := range typ.NumFields() {
+			field := typ.Field(i)
+			if (field.Pkg() != v.pkg && !field.Exported()) || !v.nameable(field.Type()) {
+				return false
+			}
+		}
+		return true
+	case *types.Interface:
+		for i := range typ.NumMethods() {
+			method := typ.Method(i)
+			if (method.Pkg() != v.pkg && !method.Exported()) || !v.nameable(method.Type()) {
+				return false
+			}
+		}
+		return true
+	default:
+		return false
+	}
+}
+
+// imported reports whether pkg is directly imported by the package being obfuscated,
+// as the build only provides the export data for those packages.
+func (v *virtualizer) imported(pkg *types.Package) bool {
+	return slices.Contains(v.pkg.Imports(), pkg)
+}
+
+// vmFunc holds the state to compile a single function.
+type vmFunc struct {
+	v    *virtualizer
+	regs map[ssa.Value]int
+
+	// preloads are the initial values of registers, as keyed elements of a slice literal,
+	// such as the parameters, constants, and the addresses of globals.
+	preloads    []ast.Expr
+	lastPreload int
+	numRegs     int
+
+	chunks    []*vmChunk
+	numLabels int
+}
+
+func (f *vmFunc) preload(r int, expr ast.Expr) {
+	f.preloads = append(f.preloads, &ast.KeyValueExpr{Key: ah.IntLit(r), Value: expr})
+	f.lastPreload = r
+}
+
+func (f *vmFunc) newReg() int {
+	f.numRegs++
+	return f.numRegs - 1
+}
+
+// reg returns the register holding a value.
+func (f *vmFunc) reg(val ssa.Value) (int, error) {
+	if r, ok := f.regs[val]; ok {
+		return r, nil
+	}
+	var expr ast.Expr
+	switch val := val.(type) {
+	case *ssa.Const:
+		var err error
+		if expr, err = f.v.constExpr(val); err != nil {
+			return 0, err
+		}
+	case *ssa.Global:
+		expr = ah.UnaryExpr(token.AND, f.v.globalExpr(val))
+	case *ssa.Function:
+		var err error
+		if expr, err = f.v.funcExpr(val); err != nil {
+			return 0, err
+		}
+	case ssa.Instruction:
+		// Set by the handler of the instruction.
+	default:
+		return 0, fmt.Errorf("value %v of type %T: %w", val, val, ssa2ast.ErrUnsupported)
+	}
+	r := f.newReg()
+	f.regs[val] = r
+	if expr != nil {
+		f.preload(r, expr)
+	}
+	return r, nil
+}
+
+func (v *virtualizer) constExpr(c *ssa.Const) (ast.Expr, error) {
+	typExpr, err := v.typeExpr(c.Type(), false)
+	if err != nil {
+		return nil, err
+	}
+	if c.Value == nil {
+		// *new(T) is the zero value of any type
+		return ah.StarExpr(ah.CallExprByName("new", typExpr)), nil
+	}
+	expr := ah.ConstToAst(c.Value)
+	if basic, ok := c.Type().(*types.Basic); ok && basic.Kind() == types.String {
+		return expr, nil
+	}
+	return ah.CallExpr(&ast.ParenExpr{X: typExpr}, expr), nil
+}
+
+func (v *virtualizer) globalExpr(g *ssa.Global) ast.Expr {
+	if pkgIdent := v.resolver(g.Pkg.Pkg); pkgIdent != nil {
+		return ah.SelectExpr(pkgIdent, ast.NewIdent(g.Name()))
+	}
+	return ast.NewIdent(g.Name())
+}
+
+// declaredFunc reports whether fn is a non-generic function or method declared in Go code,
+// rather than a closure or a wrapper generated by go/ssa, so that it can be referred to by name.
+// Promoted methods are accepted, as a call via the outer type uses the same name.
+func declaredFunc(fn *ssa.Function) bool {
+	obj := fn.Object()
+	return fn.Parent() == nil && obj != nil && fn.Name() == obj.Name() &&
+		fn.TypeParams().Len() == 0 && len(fn.TypeArgs()) == 0
+}
+
+// funcExpr returns the expression naming a package-level function.
+func (v *virtualizer) funcExpr(fn *ssa.Function) (ast.Expr, error) {
+	if !declaredFunc(fn) || fn.Signature.Recv() != nil {
+		return nil, fmt.Errorf("function %v: %w", fn, ssa2ast.ErrUnsupported)
+	}
+	if pkgIdent := v.resolver(fn.Object().Pkg()); pkgIdent != nil {
+		return ah.SelectExpr(pkgIdent, ast.NewIdent(fn.Name())), nil
+	}
+	return ast.NewIdent(fn.Name()), nil
+}
+
+// handlerBuilder builds the statements of a handler.
+type handlerBuilder struct {
+	v     *virtualizer
+	f     *vmFunc
+	stmts []ast.Stmt
+	args  []vmWord
+	n     int
+}
+
+func (f *vmFunc) builder() *handlerBuilder {
+	return &handlerBuilder{v: f.v, f: f}
+}
+
+func (b *handlerBuilder) name() *ast.Ident {
+	b.n++
+	return b.v.arg(strconv.Itoa(b.n))
+}
+
+// dst reads the register to store the result in,
+// returning a func which gives the expression for the register.
+func (b *handlerBuilder) dst(val ssa.Value) (func() ast.Expr, error) {
+	r, err := b.f.reg(val)
+	if err != nil {
+		return nil, err
+	}
+	name := b.name()
+	b.stmts = append(b.stmts, ah.AssignDefineStmt(name, b.v.fetch()))
+	b.args = append(b.args, vmWord{kind: vmValue, n: r})
+	return func() ast.Expr { return b.v.reg(ast.NewIdent(name.Name)) }, nil
+}
+
+// load reads an operand into a local variable of the given type.
+func (b *handlerBuilder) load(val ssa.Value, typExpr ast.Expr) (ast.Expr, error) {
+	r, err := b.f.reg(val)
+	if err != nil {
+		return nil, err
+	}
+	name := b.name()
+	b.stmts = append(b.stmts, &ast.AssignStmt{
+		Lhs: []ast.Expr{name, ast.NewIdent("_")},
+		Tok: token.DEFINE,
+		Rhs: []ast.Expr{&ast.TypeAssertExpr{X: b.v.reg(b.v.fetch()), Type: typExpr}},
+	})
+	b.args = append(b.args, vmWord{kind: vmValue, n: r})
+	return ast.NewIdent(name.Name), nil
+}
+
+// operand reads an operand with the type of its value.
+func (b *handlerBuilder) operand(val ssa.Value) (ast.Expr, error) {
+	return b.operandAs(val, val.Type())
+}
+
+func (b *handlerBuilder) operandAs(val ssa.Value, typ types.Type) (ast.Expr, error) {
+	typExpr, err := b.v.typeExpr(typ, false)
+	if err != nil {
+		return nil, err
+	}
+	return b.load(val, typExpr)
+}
+
+// store sets the result, which may be a tuple.
+func (b *handlerBuilder) store(val ssa.Value, expr ast.Expr) error {
+	tuple, ok := val.Type().(*types.Tuple)
+	if !ok {
+		dst, err := b.dst(val)
+		if err != nil {
+			return err
+		}
+		b.stmts = append(b.stmts, ah.AssignStmt(dst(), expr))
+		return nil
+	}
+	if tuple.Len() == 0 {
+		b.stmts = append(b.stmts, ah.ExprStmt(expr))
+		return nil
+	}
+	dst, err := b.dst(val)
+	if err != nil {
+		return err
+	}
+	assign := &ast.AssignStmt{Tok: token.DEFINE, Rhs: []ast.Expr{expr}}
+	elems := &ast.CompositeLit{Type: anySliceType()}
+	for range tuple.Len() {
+		name := b.name()
+		assign.Lhs = append(assign.Lhs, name)
+		elems.Elts = append(elems.Elts, ast.NewIdent(name.Name))
+	}
+	b.stmts = append(b.stmts, assign, ah.AssignStmt(dst(), elems))
+	return nil
+}
+
+func (b *handlerBuilder) exec(stmt ast.Stmt) {
+	b.stmts = append(b.stmts, stmt)
+}
+
+// emit adds the handler built so far, along with its operands, to the chunk.
+func (b *handlerBuilder) emit(chunk *vmChunk) {
+	h := b.v.handler(b.stmts)
+	chunk.words = append(chunk.words, vmWord{kind: vmOpcode, handler: h})
+	chunk.words = append(chunk.words, b.args...)
+}
+
+// compileInstr compiles an instruction which is not a terminator of its block, nor a phi.
+func (f *vmFunc) compileInstr(instr ssa.Instruction, chunk *vmChunk) error {
+	b := f.builder()
+	unsupported := func() error {
+		return fmt.Errorf("instruction %v: %w", instr, ssa2ast.ErrUnsupported)
+	}
+	switch instr := instr.(type) {
+	case *ssa.DebugRef:
+		return nil
+	case *ssa.BinOp:
+		x, err := b.operand(instr.X)
+		if err != nil {
+			return err
+		}
+		y, err := b.operand(instr.Y)
+		if err != nil {
+			return err
+		}
+		if err := b.store(instr, ah.BinaryExpr(x, instr.Op, y)); err != nil {
+			return err
+		}
+	case *ssa.UnOp:
+		if g, ok := instr.X.(*ssa.Global); ok && instr.Op == token.MUL {
+			// Read globals directly, as their types may not be nameable.
+			if err := b.store(instr, f.v.globalExpr(g)); err != nil {
+				return err
+			}
+			break
+		}
+		x, err := b.operand(instr.X)
+		if err != nil {
+			return err
+		}
+		var expr ast.Expr
+		switch instr.Op {
+		case token.MUL:
+			expr = ah.StarExpr(x)
+		case token.NOT, token.SUB, token.XOR, token.ARROW:
+			expr = ah.UnaryExpr(instr.Op, x)
+		default:
+			return unsupported()
+		}
+		if err := b.store(instr, expr); err != nil {
+			return err
+		}
+	case *ssa.Convert, *ssa.ChangeType, *ssa.ChangeInterface, *ssa.SliceToArrayPointer:
+		val := instr.(ssa.Value)
+		x, err := b.operand(*instr.Operands(nil)[0])
+		if err != nil {
+			return err
+		}
+		if err := b.convert(val, x); err != nil {
+			return err
+		}
+	case *ssa.MakeInterface:
+		typExpr, err := f.v.typeExpr(instr.X.Type(), true)
+		if err != nil {
+			return err
+		}
+		x, err := b.load(instr.X, typExpr)
+		if err != nil {
+			return err
+		}
+		if err := b.convert(instr, x); err != nil {
+			return err
+		}
+	case *ssa.TypeAssert:
+		x, err := b.operand(instr.X)
+		if err != nil {
+			return err
+		}
+		typExpr, err := f.v.typeExpr(instr.AssertedType, false)
+		if err != nil {
+			return err
+		}
+		if err := b.store(instr, &ast.TypeAssertExpr{X: x, Type: typExpr}); err != nil {
+			return err
+		}
+	case *ssa.Extract:
+		tuple, err := b.load(instr.Tuple, anySliceType())
+		if err != nil {
+			return err
+		}
+		if err := b.store(instr, ah.IndexExprByExpr(tuple, ah.IntLit(instr.Index))); err != nil {
+			return err
+		}
+	case *ssa.Alloc:
+		typExpr, err := f.v.typeExpr(instr.Type().(*types.Pointer).Elem(), false)
+		if err != nil {
+			return err
+		}
+		if err := b.store(instr, ah.CallExprByName("new", typExpr)); err != nil {
+			return err
+		}
+	case *ssa.Store:
+		val, err := b.operand(instr.Val)
+		if err != nil {
+			return err
+		}
+		if g, ok := instr.Addr.(*ssa.Global); ok {
+			b.exec(ah.AssignStmt(f.v.globalExpr(g), val))
+			break
+		}
+		addr, err := b.operand(instr.Addr)
+		if err != nil {
+			return err
+		}
+		b.exec(ah.AssignStmt(ah.StarExpr(addr), val))
+	case *ssa.Field:
+		x, err := b.operand(instr.X)
+		if err != nil {
+			return err
+		}
+		field := instr.X.Type().Underlying().(*types.Struct).Field(instr.Field)
+		if err := b.store(instr, ah.SelectExpr(x, ast.NewIdent(field.Name()))); err != nil {
+			return err
+		}
+	case *ssa.FieldAddr:
+		x, err := b.operand(instr.X)
+		if err != nil {
+			return err
+		}
+		field := instr.X.Type().Underlying().(*types.Pointer).Elem().Underlying().(*types.Struct).Field(instr.Field)
+		if err := b.store(instr, ah.UnaryExpr(token.AND, ah.SelectExpr(x, ast.NewIdent(field.Name())))); err != nil {
+			return err
+		}
+	case *ssa.Index, *ssa.IndexAddr, *ssa.Lookup:
+		ops := instr.Operands(nil)
+		x, err := b.operand(*ops[0])
+		if err != nil {
+			return err
+		}
+		index, err := b.operand(*ops[1])
+		if err != nil {
+			return err
+		}
+		var expr ast.Expr = ah.IndexExprByExpr(x, index)
+		if _, ok := instr.(*ssa.IndexAddr); ok {
+			expr = ah.UnaryExpr(token.AND, expr)
+		}
+		if err := b.store(instr.(ssa.Value), expr); err != nil {
+			return err
+		}
+	case *ssa.Slice:
+		x, err := b.operand(instr.X)
+		if err != nil {
+			return err
+		}
+		expr := &ast.SliceExpr{X: x, Slice3: instr.Max != nil}
+		for _, part := range []struct {
+			val ssa.Value
+			dst *ast.Expr
+		}{{instr.Low, &expr.Low}, {instr.High, &expr.High}, {instr.Max, &expr.Max}} {
+			if part.val == nil {
+				continue
+			}
+			if *part.dst, err = b.operand(part.val); err != nil {
+				return err
+			}
+		}
+		if err := b.store(instr, expr); err != nil {
+			return err
+		}
+	case *ssa.MakeSlice, *ssa.MakeMap, *ssa.MakeChan:
+		val := instr.(ssa.Value)
+		typExpr, err := f.v.typeExpr(val.Type(), false)
+		if err != nil {
+			return err
+		}
+		call := ah.CallExprByName("make", typExpr)
+		for _, op := range instr.Operands(nil) {
+			if *op == nil {
+				continue
+			}
+			arg, err := b.operand(*op)
+			if err != nil {
+				return err
+			}
+			call.Args = append(call.Args, arg)
+		}
+		if err := b.store(val, call); err != nil {
+			return err
+		}
+	case *ssa.MapUpdate:
+		m, err := b.operand(instr.Map)
+		if err != nil {
+			return err
+		}
+		key, err := b.operand(instr.Key)
+		if err != nil {
+			return err
+		}
+		val, err := b.operand(instr.Value)
+		if err != nil {
+			return err
+		}
+		b.exec(ah.AssignStmt(ah.IndexExprByExpr(m, key), val))
+	case *ssa.Send:
+		ch, err := b.operand(instr.Chan)
+		if err != nil {
+			return err
+		}
+		val, err := b.operand(instr.X)
+		if err != nil {
+			return err
+		}
+		b.exec(&ast.SendStmt{Chan: ch, Value: val})
+	case *ssa.Call:
+		call, err := b.call(&instr.Call)
+		if err != nil {
+			return err
+		}
+		if err := b.store(instr, call); err != nil {
+			return err
+		}
+	case *ssa.Range:
+		if _, ok := instr.X.Type().Underlying().(*types.Basic); !ok {
+			return unsupported() // only strings
+		}
+		// Strings are immutable, so the iteration can be done upfront:
+		//
+		//	var items []any
+		//	for k, v := range s { items = append(items, []any{true, k, v}) }
+		//	regs[d] = &items
+		s, err := b.operand(instr.X)
+		if err != nil {
+			return err
+		}
+		items, k, val := b.name(), b.name(), b.name()
+		b.exec(&ast.DeclStmt{Decl: &ast.GenDecl{Tok: token.VAR, Specs: []ast.Spec{&ast.ValueSpec{
+			Names: []*ast.Ident{items},
+			Type:  anySliceType(),
+		}}}})
+		b.exec(&ast.RangeStmt{
+			Key: k, Value: val, Tok: token.DEFINE, X: s,
+			Body: ah.BlockStmt(ah.AssignStmt(
+				ast.NewIdent(items.Name),
+				ah.CallExprByName("append", ast.NewIdent(items.Name), &ast.CompositeLit{
+					Type: anySliceType(),
+					Elts: []ast.Expr{ast.NewIdent("true"), ast.NewIdent(k.Name), ast.NewIdent(val.Name)},
+				}),
+			)),
+		})
+		if err := b.store(instr, ah.UnaryExpr(token.AND, ast.NewIdent(items.Name))); err != nil {
+			return err
+		}
+	case *ssa.Next:
+		if !instr.IsString {
+			return unsupported()
+		}
+		// if len(*it) == 0 { regs[d] = []any{false, 0, rune(0)} } else { regs[d] = (*it)[0]; *it = (*it)[1:] }
+		dst, err := b.dst(instr)
+		if err != nil {
+			return err
+		}
+		it, err := b.load(instr.Iter, &ast.StarExpr{X: anySliceType()})
+		if err != nil {
+			return err
+		}
+		elems := func() ast.Expr { return &ast.ParenExpr{X: ah.StarExpr(ast.NewIdent(it.(*ast.Ident).Name))} }
+		b.exec(&ast.IfStmt{
+			Cond: ah.BinaryExpr(ah.CallExprByName("len", elems()), token.EQL, ah.IntLit(0)),
+			Body: ah.BlockStmt(ah.AssignStmt(dst(), &ast.CompositeLit{
+				Type: anySliceType(),
+				Elts: []ast.Expr{ast.NewIdent("false"), ah.IntLit(0), ah.CallExprByName("rune", ah.IntLit(0))},
+			})),
+			Else: ah.BlockStmt(
+				ah.AssignStmt(dst(), ah.IndexExprByExpr(elems(), ah.IntLit(0))),
+				ah.AssignStmt(ah.StarExpr(ast.NewIdent(it.(*ast.Ident).Name)), &ast.SliceExpr{X: elems(), Low: ah.IntLit(1)}),
+			),
+		})
+	default:
+		return unsupported()
+	}
+	b.emit(chunk)
+	return nil
+}
+
+// convert stores the value of x converted to the type of val.
+func (b *handlerBuilder) convert(val ssa.Value, x ast.Expr) error {
+	typExpr, err := b.v.typeExpr(val.Type(), false)
+	if err != nil {
+		return err
+	}
+	return b.store(val, ah.CallExpr(&ast.ParenExpr{X: typExpr}, x))
+}
+
+// call returns the expression for a call, reading its operands.
+func (b *handlerBuilder) call(common *ssa.CallCommon) (*ast.CallExpr, error) {
+	args := common.Args
+	call := &ast.CallExpr{}
+	switch fn := common.Value.(type) {
+	case *ssa.Builtin:
+		switch fn.Name() {
+		case "append", "cap", "clear", "close", "complex", "copy", "delete", "imag", "len", "max", "min", "print", "println", "real":
+		default:
+			return nil, fmt.Errorf("builtin %s: %w", fn.Name(), ssa2ast.ErrUnsupported)
+		}
+		call.Fun = ast.NewIdent(fn.Name())
+	case *ssa.Function:
+		if recv := fn.Signature.Recv(); recv != nil && !common.IsInvoke() {
+			if !declaredFunc(fn) {
+				return nil, fmt.Errorf("method %v: %w", fn, ssa2ast.ErrUnsupported)
+			}
+			typExpr, err := b.v.typeExpr(args[0].Type(), true)
+			if err != nil {
+				return nil, err
+			}
+			x, err := b.load(args[0], typExpr)
+			if err != nil {
+				return nil, err
+			}
+			call.Fun = ah.SelectExpr(x, ast.NewIdent(fn.Name()))
+			args = args[1:]
+			break
+		}
+		funcExpr, err := b.v.funcExpr(fn)
+		if err != nil {
+			return nil, err
+		}
+		call.Fun = funcExpr
+	default:
+		x, err := b.operand(common.Value)
+		if err != nil {
+			return nil, err
+		}
+		call.Fun = x
+		if common.IsInvoke() {
+			call.Fun = ah.SelectExpr(x, ast.NewIdent(common.Method.Name()))
+		}
+	}
+	for _, arg := range args {
+		x, err := b.operand(arg)
+		if err != nil {
+			return nil, err
+		}
+		call.Args = append(call.Args, x)
+	}
+	// The variadic arguments are always passed as a slice, or as a string to append to a byte slice.
+	if fn, ok := common.Value.(*ssa.Builtin); ok {
+		if fn.Name() == "append" && len(call.Args) == 2 {
+			call.Ellipsis = 1
+		}
+	} else if common.Signature().Variadic() {
+		call.Ellipsis = 1
+	}
+	return call, nil
+}
+
+func (f *vmFunc) newChunk() *vmChunk {
+	chunk := &vmChunk{label: f.numLabels}
+	f.numLabels++
+	f.chunks = append(f.chunks, chunk)
+	return chunk
+}
+
+// jumpTo adds the code to jump from one block to another,
+// first setting the phis of the target via temporary registers,
+// as phis may read each other.
+func (f *vmFunc) jumpTo(chunk *vmChunk, from, to *ssa.BasicBlock) error {
+	predIdx := -1
+	for i, pred := range to.Preds {
+		if pred == from {
+			predIdx = i
+			break
+		}
+	}
+	type move struct{ dst, tmp, src int }
+	var moves []move
+	for _, instr := range to.Instrs {
+		phi, ok := instr.(*ssa.Phi)
+		if !ok {
+			break
+		}
+		dst, err := f.reg(phi)
+		if err != nil {
+			return err
+		}
+		src, err := f.reg(phi.Edges[predIdx])
+		if err != nil {
+			return err
+		}
+		moves = append(moves, move{dst, f.newReg(), src})
+	}
+	for _, m := range moves {
+		chunk.words = append(chunk.words, vmWord{kind: vmOpcode, handler: f.v.move}, vmWord{n: m.tmp}, vmWord{n: m.src})
+	}
+	for _, m := range moves {
+		chunk.words = append(chunk.words, vmWord{kind: vmOpcode, handler: f.v.move}, vmWord{n: m.dst}, vmWord{n: m.tmp})
+	}
+	chunk.words = append(chunk.words, vmWord{kind: vmOpcode, handler: f.v.jmp}, vmWord{kind: vmLabel, n: to.Index})
+	return nil
+}
+
+// virtualize compiles a function into bytecode, and returns a function declaration
+// with the same name and signature which runs the bytecode with the interpreter.
+func (v *virtualizer) virtualize(ssaFunc *ssa.Function) (*ast.FuncDecl, error) {
+	if ssaFunc.TypeParams().Len() > 0 || ssaFunc.Signature.RecvTypeParams().Len() > 0 {
+		return nil, fmt.Errorf("generic function %v: %w", ssaFunc, ssa2ast.ErrUnsupported)
+	}
+	if len(ssaFunc.AnonFuncs) > 0 || ssaFunc.Recover != nil {
+		return nil, fmt.Errorf("function %v with closures or defers: %w", ssaFunc, ssa2ast.ErrUnsupported)
+	}
+
+	f := &vmFunc{v: v, regs: make(map[ssa.Value]int), lastPreload: -1}
+	decl := &ast.FuncDecl{
+		Name: ast.NewIdent(ssaFunc.Name()),
+		Type: &ast.FuncType{Params: &ast.FieldList{}},
+	}
+	for i, param := range ssaFunc.Params {
+		r := f.newReg()
+		f.regs[param] = r
+		typ := param.Type()
+		typExpr, err := v.typeExpr(typ, false)
+		if err != nil {
+			return nil, err
+		}
+		name := getRandomName(v.rnd)
+		f.preload(r, ast.NewIdent(name))
+		field := ah.Field(typExpr, ast.NewIdent(name))
+		sig := ssaFunc.Signature
+		switch {
+		case i == 0 && sig.Recv() != nil:
+			decl.Recv = &ast.FieldList{List: []*ast.Field{field}}
+			continue
+		case i == len(ssaFunc.Params)-1 && sig.Variadic():
+			field.Type = &ast.Ellipsis{Elt: field.Type.(*ast.ArrayType).Elt}
+		}
+		decl.Type.Params.List = append(decl.Type.Params.List, field)
+	}
+	results := ssaFunc.Signature.Results()
+	if results.Len() > 0 {
+		decl.Type.Results = &ast.FieldList{}
+		for i := range results.Len() {
+			typExpr, err := v.typeExpr(results.At(i).Type(), false)
+			if err != nil {
+				return nil, err
+			}
+			decl.Type.Results.List = append(decl.Type.Results.List, ah.Field(typExpr))
+		}
+	}
+
+	// The bytecode starts by jumping to the entry block,
+	// so that all blocks can be shuffled.
+	start := &vmChunk{label: -1}
+	start.words = []vmWord{{kind: vmOpcode, handler: v.jmp}, {kind: vmLabel, n: 0}}
+	f.numLabels = len(ssaFunc.Blocks)
+	for _, block := range ssaFunc.Blocks {
+		chunk := &vmChunk{label: block.Index}
+		f.chunks = append(f.chunks, chunk)
+		for _, instr := range block.Instrs {
+			switch instr := instr.(type) {
+			case *ssa.Phi:
+				if _, err := f.reg(instr); err != nil {
+					return nil, err
+				}
+			case *ssa.Jump:
+				if err := f.jumpTo(chunk, block, block.Succs[0]); err != nil {
+					return nil, err
+				}
+			case *ssa.If:
+				cond, err := f.reg(instr.Cond)
+				if err != nil {
+					return nil, err
+				}
+				chunk.words = append(chunk.words, vmWord{kind: vmOpcode, handler: v.cond}, vmWord{n: cond})
+				for _, succ := range block.Succs {
+					target := f.newChunk()
+					chunk.words = append(chunk.words, vmWord{kind: vmLabel, n: target.label})
+					if err := f.jumpTo(target, block, succ); err != nil {
+						return nil, err
+					}
+				}
+			case *ssa.Return:
+				chunk.words = append(chunk.words, vmWord{kind: vmOpcode, handler: v.ret}, vmWord{n: len(instr.Results)})
+				for _, res := range instr.Results {
+					r, err := f.reg(res)
+					if err != nil {
+						return nil, err
+					}
+					chunk.words = append(chunk.words, vmWord{n: r})
+				}
+			case *ssa.Panic:
+				b := f.builder()
+				x, err := b.operand(instr.X)
+				if err != nil {
+					return nil, err
+				}
+				b.exec(ah.ExprStmt(ah.CallExprByName("panic", x)))
+				b.emit(chunk)
+			default:
+				if err := f.compileInstr(instr, chunk); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+	v.rnd.Shuffle(len(f.chunks), func(i, j int) {
+		f.chunks[i], f.chunks[j] = f.chunks[j], f.chunks[i]
+	})
+	prog := &vmProgram{
+		codeName: getRandomName(v.rnd),
+		chunks:   append([]*vmChunk{start}, f.chunks...),
+	}
+	v.programs = append(v.programs, prog)
+
+	// Wrapper calling the interpreter:
+	/*
+		func <name>(<params>) (<results>) {
+			r := <funcName>(<codeName>, []any{0: <param 0>, ..., <reg>: <preload>, ..., <numRegs-1>: nil})
+			r0, _ := r[0].(<result 0>)
+			return r0, ...
+		}
+	*/
+	regs := &ast.CompositeLit{Type: anySliceType(), Elts: f.preloads}
+	if last := f.numRegs - 1; last > f.lastPreload {
+		regs.Elts = append(regs.Elts, &ast.KeyValueExpr{Key: ah.IntLit(last), Value: ast.NewIdent("nil")})
+	}
+	run := ah.CallExprByName(v.funcName, ast.NewIdent(prog.codeName), regs)
+	if results.Len() == 0 {
+		decl.Body = ah.BlockStmt(ah.ExprStmt(run))
+		return decl, nil
+	}
+	resName := getRandomName(v.rnd)
+	decl.Body = ah.BlockStmt(ah.AssignDefineStmt(ast.NewIdent(resName), run))
+	ret := &ast.ReturnStmt{}
+	for i := range results.Len() {
+		typExpr, err := v.typeExpr(results.At(i).Type(), false)
+		if err != nil {
+			return nil, err
+		}
+		name := getRandomName(v.rnd)
+		decl.Body.List = append(decl.Body.List, &ast.AssignStmt{
+			Lhs: []ast.Expr{ast.NewIdent(name), ast.NewIdent("_")},
+			Tok: token.DEFINE,
+			Rhs: []ast.Expr{&ast.TypeAssertExpr{X: ah.IndexExprByExpr(ast.NewIdent(resName), ah.IntLit(i)), Type: typExpr}},
+		})
+		ret.Results = append(ret.Results, ast.NewIdent(name))
+	}
+	decl.Body.List = append(decl.Body.List, ret)
+	return decl, nil
+}
+
+// Decls returns the declarations of the interpreter and of the bytecode of all programs.
+func (v *virtualizer) Decls() []ast.Decl {
+	// Opcodes are random and unique, and the handlers are shuffled.
+	opcodes := generateKeys(len(v.handlerList), nil, v.rnd)
+	for i, h := range v.handlerList {
+		h.opcode = opcodes[i]
+	}
+	handlers := append([]*vmHandler(nil), v.handlerList...)
+	v.rnd.Shuffle(len(handlers), func(i, j int) {
+		handlers[i], handlers[j] = handlers[j], handlers[i]
+	})
+
+	var decls []ast.Decl
+	for _, prog := range v.programs {
+		// Lay out the chunks to know the address of each label.
+		addrs := make(map[int]int)
+		size := 0
+		for _, chunk := range prog.chunks {
+			addrs[chunk.label] = size
+			size += len(chunk.words)
+		}
+		code := &ast.CompositeLit{Type: &ast.ArrayType{Elt: ast.NewIdent("uint32")}}
+		for _, chunk := range prog.chunks {
+			for _, word := range chunk.words {
+				n := word.n
+				switch word.kind {
+				case vmOpcode:
+					n = word.handler.opcode
+				case vmLabel:
+					n = addrs[word.n]
+				}
+				encoded := uint32(n) ^ (v.key + uint32(len(code.Elts))*v.mul)
+				code.Elts = append(code.Elts, ah.UintLit(uint64(encoded)))
+			}
+		}
+		decls = append(decls, &ast.GenDecl{
+			Tok: token.VAR,
+			Specs: []ast.Spec{&ast.ValueSpec{
+				Names:  []*ast.Ident{ast.NewIdent(prog.codeName)},
+				Values: []ast.Expr{code},
+			}},
+		})
+	}
+
+	// Code for the interpreter:
+	/*
+		func <funcName>(<codeName> []uint32, <regsName> []any) []any {
+			<pcName> := 0
+			<fetchName> := func() int {
+				v := int(<codeName>[<pcName>] ^ (<key> + uint32(<pcName>)*<mul>))
+				<pcName>++
+				return v
+			}
+			for {
+				switch <fetchName>() {
+				case <opcode>:
+					<handler>
+				...
+				}
+			}
+		}
+	*/
+	value := v.arg("v")
+	fetch := &ast.FuncLit{
+		Type: &ast.FuncType{
+			Params:  &ast.FieldList{},
+			Results: &ast.FieldList{List: []*ast.Field{ah.Field(ast.NewIdent("int"))}},
+		},
+		Body: ah.BlockStmt(
+			ah.AssignDefineStmt(value, ah.CallExprByName("int", ah.BinaryExpr(
+				ah.IndexExprByExpr(ast.NewIdent(v.codeName), v.pc()),
+				token.XOR,
+				&ast.ParenExpr{X: ah.BinaryExpr(
+					ah.UintLit(uint64(v.key)),
+					token.ADD,
+					ah.BinaryExpr(ah.CallExprByName("uint32", v.pc()), token.MUL, ah.UintLit(uint64(v.mul))),
+				)},
+			))),
+			&ast.IncDecStmt{X: v.pc(), Tok: token.INC},
+			ah.ReturnStmt(v.arg("v")),
+		),
+	}
+	var clauses []ast.Stmt
+	for _, h := range handlers {
+		clauses = append(clauses, &ast.CaseClause{
+			List: []ast.Expr{ah.IntLit(h.opcode)},
+			Body: h.body,
+		})
+	}
+	interp := &ast.FuncDecl{
+		Name: ast.NewIdent(v.funcName),
+		Type: &ast.FuncType{
+			Params: &ast.FieldList{List: []*ast.Field{
+				ah.Field(&ast.ArrayType{Elt: ast.NewIdent("uint32")}, ast.NewIdent(v.codeName)),
+				ah.Field(anySliceType(), ast.NewIdent(v.regsName)),
+			}},
+			Results: &ast.FieldList{List: []*ast.Field{ah.Field(anySliceType())}},
+		},
+		Body: ah.BlockStmt(
+			ah.AssignDefineStmt(v.pc(), ah.IntLit(0)),
+			ah.AssignDefineStmt(ast.NewIdent(v.fetchName), fetch),
+			&ast.ForStmt{Body: ah.BlockStmt(&ast.SwitchStmt{
+				Tag:  v.fetch(),
+				Body: &ast.BlockStmt{List: clauses},
+			})},
+		),
+	}
+	return append(decls, interp)
+}
+
+// hasVirtualizeDirective reports whether a function's doc comment has the directive.
+func hasVirtualizeDirective(funcDecl *ast.FuncDecl) bool {
+	return ah.HasDirective(funcDecl.Doc, VirtualizeDirective)
+}
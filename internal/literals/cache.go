@@ -0,0 +1,118 @@
+// Copyright (c) 2026, The Garble Authors.
+// See LICENSE for licensing information.
+
+package literals
+
+import (
+	"go/ast"
+	"go/token"
+	"go/types"
+	mathrand "math/rand"
+	"slices"
+	"strconv"
+
+	ah "mvdan.cc/garble/internal/asthelper"
+)
+
+// CacheLiteralsDirective makes the literals in a function be decoded only once
+// per process when found in its doc comment, or in all the functions of a file
+// when found in its package clause's doc comment.
+const CacheLiteralsDirective = "//garble:cacheliterals"
+
+// CacheConfig enables decoding literals only once per process,
+// keeping them in package-level variables guarded by a [sync.Once].
+//
+// Only strings and numbers are cached, as byte slices could be modified
+// by the code using them. Literals outside functions are left alone,
+// as package-level variables are only initialized once anyway.
+type CacheConfig struct {
+	// All caches the literals in all functions,
+	// and not just the ones with [CacheLiteralsDirective].
+	All bool
+
+	// Sync is the type-checked sync package, which the obfuscated files import.
+	// The package being obfuscated must depend on it.
+	Sync *types.Package
+}
+
+// literalCache adds the package-level variables and the sync import
+// to a file for the literals which are cached.
+type literalCache struct {
+	cfg      *CacheConfig
+	info     *types.Info
+	rand     *mathrand.Rand
+	nameFunc NameProviderFunc
+
+	syncName string
+	decls    []ast.Decl
+}
+
+// cached returns an expression which evaluates call only once, such as:
+//
+//	func() string {
+//		<once>.Do(func() { <slot> = <call> })
+//		return <slot>
+//	}()
+//
+// where <once> and <slot> are package-level variables of types sync.Once
+// and the result type of the func being called.
+func (c *literalCache) cached(call *ast.CallExpr) ast.Expr {
+	if c.syncName == "" {
+		c.syncName = c.nameFunc(c.rand, "syncImport")
+	}
+	resultType := "string" // the funcs of a Pool only decode strings
+	if lit, ok := call.Fun.(*ast.FuncLit); ok {
+		resultType = lit.Type.Results.List[0].Type.(*ast.Ident).Name
+	}
+	once := c.nameFunc(c.rand, "cachedLiteralOnce"+strconv.Itoa(len(c.decls)))
+	slot := c.nameFunc(c.rand, "cachedLiteral"+strconv.Itoa(len(c.decls)))
+
+	// The sync names are obfuscated along with the sync package,
+	// so they need type information.
+	onceObj := c.cfg.Sync.Scope().Lookup("Once")
+	onceIdent := ast.NewIdent(onceObj.Name())
+	c.info.Uses[onceIdent] = onceObj
+	doObj, _, _ := types.LookupFieldOrMethod(types.NewPointer(onceObj.Type()), false, c.cfg.Sync, "Do")
+	doIdent := ast.NewIdent(doObj.Name())
+	c.info.Uses[doIdent] = doObj
+
+	c.decls = append(c.decls, &ast.GenDecl{
+		Tok: token.VAR,
+		Specs: []ast.Spec{
+			&ast.ValueSpec{
+				Names: []*ast.Ident{ast.NewIdent(once)},
+				Type:  ah.SelectExpr(ast.NewIdent(c.syncName), onceIdent),
+			},
+			&ast.ValueSpec{
+				Names: []*ast.Ident{ast.NewIdent(slot)},
+				Type:  ast.NewIdent(resultType),
+			},
+		},
+	})
+
+	setSlot := &ast.FuncLit{
+		Type: &ast.FuncType{Params: &ast.FieldList{}},
+		Body: ah.BlockStmt(ah.AssignStmt(ast.NewIdent(slot), call)),
+	}
+	return ah.LambdaCall(&ast.FieldList{}, ast.NewIdent(resultType), ah.BlockStmt(
+		ah.ExprStmt(ah.CallExpr(ah.SelectExpr(ast.NewIdent(once), doIdent), setSlot)),
+		ah.ReturnStmt(ast.NewIdent(slot)),
+	), nil)
+}
+
+// addToFile adds the variables for the cached literals to a file,
+// as well as the import of the sync package.
+func (c *literalCache) addToFile(file *ast.File) {
+	if len(c.decls) == 0 {
+		return
+	}
+	name := ast.NewIdent(c.syncName)
+	c.info.Defs[name] = types.NewPkgName(token.NoPos, nil, c.syncName, c.cfg.Sync)
+	spec := &ast.ImportSpec{Name: name, Path: ah.StringLit(c.cfg.Sync.Path())}
+	file.Imports = append(file.Imports, spec)
+	file.Decls = slices.Insert(file.Decls, 0, ast.Decl(&ast.GenDecl{
+		Tok:   token.IMPORT,
+		Specs: []ast.Spec{spec},
+	}))
+	file.Decls = append(file.Decls, c.decls...)
+}
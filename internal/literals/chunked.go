@@ -0,0 +1,117 @@
+// Copyright (c) 2026, The Garble Authors.
+// See LICENSE for licensing information.
+
+package literals
+
+import (
+	"go/ast"
+	"go/token"
+	mathrand "math/rand"
+
+	ah "mvdan.cc/garble/internal/asthelper"
+)
+
+// chunkSize is the number of bytes decoded with each key by the chunked obfuscator.
+const chunkSize = 512
+
+// chunked is used for literals too large for the other obfuscators.
+// It encrypts the data with a xorshift keystream which is reseeded for every chunk,
+// so that both the generated code and the time to compile it grow linearly:
+//
+//	data := make([]byte, <len>)
+//	enc := "<encrypted data>"
+//	seeds := [...]uint64{<one seed per chunk>}
+//	var state uint64
+//	for i := range data {
+//		if i%<chunkSize> == 0 {
+//			state = seeds[i/<chunkSize>] ^ uint64(<external key>)
+//		}
+//		state ^= state << 13
+//		state ^= state >> 7
+//		state ^= state << 17
+//		data[i] = enc[i] ^ byte(state)
+//	}
+type chunked struct{}
+
+// check that the Obfuscator interface is implemented
+var _ Obfuscator = chunked{}
+
+func (chunked) Obfuscate(rand *mathrand.Rand, data []byte, extKeys []*ExternalKey) *ast.BlockStmt {
+	key := extKeys[rand.Intn(len(extKeys))]
+	key.AddRef()
+
+	var seeds []ast.Expr
+	var state uint64
+	for i := range data {
+		if i%chunkSize == 0 {
+			seed := rand.Uint64()
+			for seed == key.value {
+				seed = rand.Uint64() // a zero state would never change
+			}
+			seeds = append(seeds, ah.UintLit(seed))
+			state = seed ^ key.value
+		}
+		state ^= state << 13
+		state ^= state >> 7
+		state ^= state << 17
+		data[i] ^= byte(state)
+	}
+
+	xorshift := func(op token.Token, n int) ast.Stmt {
+		return &ast.AssignStmt{
+			Lhs: []ast.Expr{ast.NewIdent("state")},
+			Tok: token.XOR_ASSIGN,
+			Rhs: []ast.Expr{ah.BinaryExpr(ast.NewIdent("state"), op, ah.IntLit(n))},
+		}
+	}
+	return ah.BlockStmt(
+		ah.AssignDefineStmt(ast.NewIdent("data"), ah.CallExprByName("make", ah.ByteSliceType(), ah.IntLit(len(data)))),
+		ah.AssignDefineStmt(ast.NewIdent("enc"), ah.StringLit(string(data))),
+		ah.AssignDefineStmt(ast.NewIdent("seeds"), &ast.CompositeLit{
+			Type: ah.ArrayType(&ast.Ellipsis{}, ast.NewIdent("uint64")),
+			Elts: seeds,
+		}),
+		&ast.DeclStmt{
+			Decl: &ast.GenDecl{
+				Tok: token.VAR,
+				Specs: []ast.Spec{&ast.ValueSpec{
+					Names: []*ast.Ident{ast.NewIdent("state")},
+					Type:  ast.NewIdent("uint64"),
+				}},
+			},
+		},
+		&ast.RangeStmt{
+			Key: ast.NewIdent("i"),
+			Tok: token.DEFINE,
+			X:   ast.NewIdent("data"),
+			Body: ah.BlockStmt(
+				&ast.IfStmt{
+					Cond: ah.BinaryExpr(
+						ah.BinaryExpr(ast.NewIdent("i"), token.REM, ah.IntLit(chunkSize)),
+						token.EQL,
+						ah.IntLit(0),
+					),
+					Body: ah.BlockStmt(ah.AssignStmt(
+						ast.NewIdent("state"),
+						ah.BinaryExpr(
+							ah.IndexExprByExpr(ast.NewIdent("seeds"), ah.BinaryExpr(ast.NewIdent("i"), token.QUO, ah.IntLit(chunkSize))),
+							token.XOR,
+							ah.CallExprByName("uint64", key.Name()),
+						),
+					)),
+				},
+				xorshift(token.SHL, 13),
+				xorshift(token.SHR, 7),
+				xorshift(token.SHL, 17),
+				ah.AssignStmt(
+					ah.IndexExpr("data", ast.NewIdent("i")),
+					ah.BinaryExpr(
+						ah.IndexExpr("enc", ast.NewIdent("i")),
+						token.XOR,
+						ah.CallExprByName("byte", ast.NewIdent("state")),
+					),
+				),
+			),
+		},
+	)
+}
@@ -45,7 +45,8 @@ func FuzzObfuscate(f *testing.F) {
 	f.Add("long_enough_string", initialRandSeed)
 	f.Add("binary_\x00\x01\x02", initialRandSeed)
 	f.Add("whitespace    \n\t\t", initialRandSeed)
-	f.Add(strings.Repeat("x", (2<<10)+1), initialRandSeed) // past MaxSize
+	f.Add(strings.Repeat("x", literals.MaxSizeUnchunked+1), initialRandSeed) // chunked
+	f.Add(strings.Repeat("chunk", 1000), initialRandSeed)                    // multiple chunks
 
 	tdir := f.TempDir()
 	var tdirCounter atomic.Int64
@@ -72,7 +73,8 @@ func FuzzObfuscate(f *testing.F) {
 
 		// Obfuscate the literals and print the source back.
 		rand := mathrand.New(mathrand.NewSource(randSeed))
-		srcSyntax = literals.Obfuscate(rand, srcSyntax, &info, nil, func(rand *mathrand.Rand, baseName string) string {
+		// Obfuscate short literals too, to cover the cheap obfuscator used for them.
+		srcSyntax = literals.Obfuscate(rand, srcSyntax, &info, nil, literals.Config{MinSize: 1}, func(rand *mathrand.Rand, baseName string) string {
 			return fmt.Sprintf("%s%d", baseName, rand.Uint64())
 		})
 		count := tdirCounter.Add(1)
@@ -16,13 +16,21 @@ import (
 	ah "mvdan.cc/garble/internal/asthelper"
 )
 
-// MinSize is the lower bound limit, of the size of string-like literals
+// MinSize is the default lower bound limit, of the size of string-like literals
 // which we will obfuscate. This is needed in order for binary size to stay relatively
 // moderate, this also decreases the likelihood for performance slowdowns.
+//
+// A lower bound can be set via [Config.MinSize], in which case the literals
+// shorter than MinSize are obfuscated with a cheap algorithm of their own.
 const MinSize = 8
 
 // MaxSize is the upper limit of the size of string-like literals we will obfuscate.
-const MaxSize = 2 << 10 // 2 KiB
+const MaxSize = 1 << 20 // 1 MiB
+
+// MaxSizeUnchunked is the upper limit for using obfuscators which decode
+// the entire literal at once. Above this size, the data is decoded in chunks,
+// keeping the size of the generated code and its compile time linear.
+const MaxSizeUnchunked = 2 << 10 // 2 KiB
 
 // MaxSizeExpensive is the upper limit for using expensive obfuscators (split, seed).
 // Above this size, only cheap obfuscators are used.
@@ -35,15 +43,127 @@ const (
 	maxStringJunkBytes = 8
 )
 
+// NoLiteralsDirective excludes a declaration from literal obfuscation
+// when found in its doc comment.
+const NoLiteralsDirective = "//garble:noliterals"
+
 // NameProviderFunc defines a function type that generates a string based on a random source and a base name.
 type NameProviderFunc func(rand *mathrand.Rand, baseName string) string
 
+// Config holds the optional settings for [Obfuscate].
+type Config struct {
+	// Cache, if not nil, makes the literals in the functions it selects
+	// be decoded only once per process.
+	Cache *CacheConfig
+
+	// Weights overrides the weights of the registered obfuscators.
+	Weights ObfuscatorWeights
+
+	// Pool, if not nil, shares the obfuscation of repeated strings
+	// across all the files of a package.
+	Pool *Pool
+
+	// Hot, if not nil, reports whether a function is on the hot path
+	// according to a profile. Hot functions keep their numeric constants
+	// and only use cheap obfuscators, while the other functions prefer
+	// the expensive ones, which are harder to reverse.
+	Hot func(*ast.FuncDecl) bool
+
+	// MinSize, if not zero, overrides [MinSize] as the lower bound of the size
+	// of the string and byte literals to obfuscate.
+	MinSize int
+
+	// Skipped, if not nil, counts the literals left alone due to their size.
+	Skipped *SkippedSizes
+}
+
+// SkippedSizes counts the non-empty string and byte literals which were not obfuscated
+// because they were shorter than the minimum size, or longer than [MaxSize].
+type SkippedSizes struct {
+	Short, Long int
+}
+
 // Obfuscate replaces literals with obfuscated anonymous functions.
-func Obfuscate(rand *mathrand.Rand, file *ast.File, info *types.Info, linkStrings map[*types.Var]string, nameFunc NameProviderFunc) *ast.File {
-	or := newObfRand(rand, file, nameFunc)
+// Besides strings and byte slices, this includes integer, float, and boolean
+// constants, except for small numbers, and within loops and large composite literals.
+// Declarations with [NoLiteralsDirective] in their doc comments are skipped,
+// as well as the entire file when its package clause has the directive.
+//
+// The strings in linkStrings, set via -ldflags=-X, are injected into the
+// declarations of their variables, and then obfuscated like any other literal.
+//
+// The obfuscators are picked at random following weights; see [Register].
+func Obfuscate(rand *mathrand.Rand, file *ast.File, info *types.Info, linkStrings map[*types.Var]string, cfg Config, nameFunc NameProviderFunc) *ast.File {
+	injected := injectLinkStrings(file, info, linkStrings)
+	if ah.HasDirective(file.Doc, NoLiteralsDirective) {
+		return file
+	}
+	or := newObfRand(rand, file, cfg.Weights, nameFunc)
+	or.minSize, or.skipped = cfg.MinSize, cfg.Skipped
+	if or.minSize == 0 {
+		or.minSize = MinSize
+	}
+	cache := cfg.Cache
+	litCache := &literalCache{cfg: cache, info: info, rand: rand, nameFunc: nameFunc}
+	// caching is set when we are under a function whose literals are cached.
+	caching := false
+	maybeCached := func(call *ast.CallExpr) ast.Expr {
+		if caching {
+			return litCache.cached(call)
+		}
+		return call
+	}
+	// skipNumbers holds the nodes we are under which skip numeric constants.
+	skipNumbers := make(map[ast.Node]bool)
+	// conditions holds the conditions of if statements and tagless switches,
+	// and inConditions counts how many of them we are under.
+	// Boolean constants in them are left alone, so that the compiler can still
+	// remove the branches they guard, such as with "if runtime.GOOS == ..." or "if debug".
+	conditions := make(map[ast.Node]bool)
+	inConditions := 0
 	pre := func(cursor *astutil.Cursor) bool {
+		if conditions[cursor.Node()] {
+			inConditions++
+		}
+		if expr, ok := cursor.Node().(ast.Expr); ok && len(skipNumbers) == 0 && or.heat != heatHot {
+			tv := info.Types[expr]
+			if tv.IsValue() && tv.Value != nil && inConditions > 0 && isBoolType(tv.Type) {
+				if conditions[expr] {
+					inConditions--
+				}
+				return false
+			}
+			if tv.IsValue() && tv.Value != nil && isNumberType(tv.Type) &&
+				numberContextOK(cursor.Parent(), cursor.Name(), info) {
+				if newnode := obfuscateNumber(or, tv.Type.(*types.Basic), tv.Value); newnode != nil {
+					cursor.Replace(withPos(maybeCached(newnode), expr.Pos()))
+					return false
+				}
+			}
+		}
 		switch node := cursor.Node().(type) {
+		case *ast.IfStmt:
+			conditions[node.Cond] = true
+		case *ast.SwitchStmt:
+			if node.Tag == nil {
+				for _, stmt := range node.Body.List {
+					for _, expr := range stmt.(*ast.CaseClause).List {
+						conditions[expr] = true
+					}
+				}
+			}
 		case *ast.FuncDecl:
+			caching = cache != nil && (cache.All ||
+				ah.HasDirective(file.Doc, CacheLiteralsDirective) ||
+				ah.HasDirective(node.Doc, CacheLiteralsDirective))
+			or.heat = heatUnknown
+			if cfg.Hot != nil {
+				or.heat = heatCold
+				if cfg.Hot(node) {
+					or.heat = heatHot
+				}
+			}
+
 			// Obfuscating literals can push the stack frame over the //go:nosplit limit,
 			// which is just 800 bytes. These funcs are mostly in the runtime,
 			// so obfuscating strings in these is less important in any case.
@@ -54,47 +174,134 @@ func Obfuscate(rand *mathrand.Rand, file *ast.File, info *types.Info, linkString
 					}
 				}
 			}
+			if ah.HasDirective(node.Doc, NoLiteralsDirective) {
+				return false
+			}
 		case *ast.GenDecl:
+			if _, ok := cursor.Parent().(*ast.File); ok {
+				caching = false
+				or.heat = heatUnknown
+			}
 			// constants are obfuscated by replacing all references with the obfuscated value
 			if node.Tok == token.CONST {
 				return false
 			}
+			if ah.HasDirective(node.Doc, NoLiteralsDirective) {
+				return false
+			}
 		case *ast.ValueSpec:
-			for _, name := range node.Names {
-				obj := info.Defs[name].(*types.Var)
-				if _, e := linkStrings[obj]; e {
-					// Skip this entire ValueSpec to not break -ldflags=-X.
-					// TODO: support obfuscating those injected strings, too.
-					return false
-				}
+			if ah.HasDirective(node.Doc, NoLiteralsDirective) {
+				return false
 			}
 		}
+		if skipsNumbers(cursor.Node(), info) {
+			skipNumbers[cursor.Node()] = true
+		}
 		return true
 	}
 
+	// obfuscatedString returns the expression replacing a string literal at pos.
+	obfuscatedString := func(value string, pos token.Pos) ast.Expr {
+		call := cfg.Pool.call(or, value)
+		if call == nil {
+			call = obfuscateString(or, value)
+		}
+		return withPos(maybeCached(call), pos).(ast.Expr)
+	}
+	// namedString returns the value of a constant with a defined string type,
+	// such as "activate" in "switch command(cmd) { case activate: ... }".
+	namedString := func(expr ast.Expr) (string, bool) {
+		tv := info.Types[expr]
+		if !tv.IsValue() || tv.Value == nil || !isNamedString(tv.Type) {
+			return "", false
+		}
+		return constant.StringVal(tv.Value), true
+	}
+	// asString converts an expression with a defined string type to a plain string,
+	// which is obfuscated if it is a constant.
+	asString := func(expr ast.Expr) ast.Expr {
+		if value, ok := namedString(expr); ok && or.sizeOK(len(value)) {
+			return obfuscatedString(value, expr.Pos())
+		}
+		return ah.CallExprByName("string", expr)
+	}
+
 	post := func(cursor *astutil.Cursor) bool {
+		delete(skipNumbers, cursor.Node())
+		if conditions[cursor.Node()] {
+			inConditions--
+		}
+		if node, ok := cursor.Node().(*ast.SwitchStmt); ok {
+			// Constants with defined string types can't be obfuscated as they are,
+			// since we can't always refer to their type to convert the obfuscated strings.
+			// Switching on a plain string instead is equivalent,
+			// and we only do that when any of the cases can be obfuscated.
+			if node.Tag == nil || !isNamedString(info.TypeOf(node.Tag)) {
+				return true
+			}
+			obfuscable := false
+			for _, stmt := range node.Body.List {
+				for _, expr := range stmt.(*ast.CaseClause).List {
+					if !isNamedString(info.TypeOf(expr)) {
+						return true // e.g. an interface value
+					}
+					if value, ok := namedString(expr); ok && len(value) >= or.minSize && len(value) <= MaxSize {
+						obfuscable = true
+					}
+				}
+			}
+			if !obfuscable {
+				return true
+			}
+			node.Tag = asString(node.Tag)
+			for _, stmt := range node.Body.List {
+				clause := stmt.(*ast.CaseClause)
+				for i, expr := range clause.List {
+					clause.List[i] = asString(expr)
+				}
+			}
+			return true
+		}
 		node, ok := cursor.Node().(ast.Expr)
 		if !ok {
 			return true
 		}
 
+		// The strings injected from linkStrings were not type-checked.
+		value, isString := injected[node]
 		typeAndValue := info.Types[node]
-		if !typeAndValue.IsValue() {
-			return true
+		if typeAndValue.IsValue() && typeAndValue.Type == types.Typ[types.String] && typeAndValue.Value != nil {
+			value, isString = constant.StringVal(typeAndValue.Value), true
 		}
-
-		if typeAndValue.Type == types.Typ[types.String] && typeAndValue.Value != nil {
-			value := constant.StringVal(typeAndValue.Value)
-			if len(value) < MinSize || len(value) > MaxSize {
+		if isString {
+			if !or.sizeOK(len(value)) {
 				return true
 			}
 
-			cursor.Replace(withPos(obfuscateString(or, value), node.Pos()))
+			cursor.Replace(obfuscatedString(value, node.Pos()))
 
 			return true
 		}
+		if !typeAndValue.IsValue() {
+			return true
+		}
 
 		switch node := node.(type) {
+		case *ast.BinaryExpr:
+			// Like with switch statements, compare against a plain string
+			// when one side is a constant with a defined string type.
+			if (node.Op != token.EQL && node.Op != token.NEQ) || typeAndValue.Value != nil ||
+				!types.Identical(info.TypeOf(node.X), info.TypeOf(node.Y)) {
+				return true
+			}
+			_, okX := namedString(node.X)
+			_, okY := namedString(node.Y)
+			if okX || okY {
+				// asString counts the constants which are too short or too long.
+				node.X = asString(node.X)
+				node.Y = asString(node.Y)
+			}
+
 		case *ast.UnaryExpr:
 			// Account for the possibility of address operators like
 			// &[]byte used inline with function arguments.
@@ -136,19 +343,69 @@ func Obfuscate(rand *mathrand.Rand, file *ast.File, info *types.Info, linkString
 
 	newFile := astutil.Apply(file, pre, post).(*ast.File)
 	or.proxyDispatcher.AddToFile(newFile)
+	or.poolDispatcher.AddToFile(newFile)
+	litCache.addToFile(newFile)
 	return newFile
 }
 
+// isNamedString reports whether a type is a defined type with an underlying string type,
+// such as "type command string".
+func isNamedString(typ types.Type) bool {
+	if _, ok := types.Unalias(typ).(*types.Named); !ok {
+		return false
+	}
+	basic, ok := typ.Underlying().(*types.Basic)
+	return ok && basic.Info()&types.IsString != 0
+}
+
+// injectLinkStrings replaces the values of the package-level variables in linkStrings
+// with the strings injected via -ldflags=-X, returning the new literals.
+// Like cmd/link, variables initialized with non-constant expressions are left alone,
+// as their initialization at run time would replace the injected string anyway.
+func injectLinkStrings(file *ast.File, info *types.Info, linkStrings map[*types.Var]string) map[ast.Expr]string {
+	injected := make(map[ast.Expr]string)
+	for _, decl := range file.Decls {
+		decl, ok := decl.(*ast.GenDecl)
+		if !ok || decl.Tok != token.VAR {
+			continue
+		}
+		for _, spec := range decl.Specs {
+			spec := spec.(*ast.ValueSpec)
+			for i, name := range spec.Names {
+				value, ok := linkStrings[info.Defs[name].(*types.Var)]
+				if !ok {
+					continue
+				}
+				switch {
+				case len(spec.Values) == 0:
+					// All names share the string type; give the others their zero value.
+					spec.Values = make([]ast.Expr, len(spec.Names))
+					for i := range spec.Values {
+						spec.Values[i] = ah.StringLit("")
+						injected[spec.Values[i]] = ""
+					}
+				case len(spec.Values) != len(spec.Names):
+					continue // a multi-value call
+				}
+				if _, ok := injected[spec.Values[i]]; !ok && info.Types[spec.Values[i]].Value == nil {
+					continue // not a constant
+				}
+				lit := ah.StringLit(value)
+				lit.ValuePos = name.End()
+				spec.Values[i] = lit
+				injected[lit] = value
+			}
+		}
+	}
+	return injected
+}
+
 // handleCompositeLiteral checks if the input node is []byte or [...]byte and
 // calls the appropriate obfuscation method, returning a new node that should
 // be used to replace it.
 //
 // If the input node cannot be obfuscated nil is returned.
 func handleCompositeLiteral(or *obfRand, isPointer bool, node *ast.CompositeLit, info *types.Info) ast.Node {
-	if len(node.Elts) < MinSize || len(node.Elts) > MaxSize {
-		return nil
-	}
-
 	byteType := types.Universe.Lookup("byte").Type()
 
 	var arrayLen int64
@@ -168,6 +425,9 @@ func handleCompositeLiteral(or *obfRand, isPointer bool, node *ast.CompositeLit,
 	default:
 		return nil
 	}
+	if !or.sizeOK(len(node.Elts)) {
+		return nil
+	}
 
 	data := make([]byte, 0, len(node.Elts))
 
@@ -239,6 +499,18 @@ func withPos(node ast.Node, pos token.Pos) ast.Node {
 
 func obfuscateString(or *obfRand, data string) *ast.CallExpr {
 	obf := or.pickObfuscator(len(data))
+	if _, ok := obf.(short); ok {
+		// Junk bytes and external keys would cost more than the short string itself.
+		//
+		//	func() string {
+		//		data := []byte("<obfuscated>")
+		//		<decode data>
+		//		return string(data)
+		//	}()
+		block := obf.Obfuscate(or.rnd, []byte(data), nil)
+		block.List = append(block.List, ah.ReturnStmt(ah.CallExprByName("string", ast.NewIdent("data"))))
+		return ah.LambdaCall(&ast.FieldList{}, ast.NewIdent("string"), block, nil)
+	}
 
 	// Generate junk bytes to to prepend and append to the data.
 	// This is to prevent the obfuscated string from being easily fingerprintable.
@@ -251,7 +523,7 @@ func obfuscateString(or *obfRand, data string) *ast.CallExpr {
 	plainData := []byte(data)
 	plainDataWithJunkBytes := append(append(junkBytes[:splitIdx], plainData...), junkBytes[splitIdx:]...)
 
-	block := obf.obfuscate(or.rnd, plainDataWithJunkBytes, extKeys)
+	block := obf.Obfuscate(or.rnd, plainDataWithJunkBytes, extKeys)
 	params, args := extKeysToParams(or, extKeys)
 
 	// Generate unique cast bytes to string function and hide it using proxyDispatcher:
@@ -297,7 +569,7 @@ func obfuscateByteSlice(or *obfRand, isPointer bool, data []byte) *ast.CallExpr
 	obf := or.pickObfuscator(len(data))
 
 	extKeys := randExtKeys(or.rnd)
-	block := obf.obfuscate(or.rnd, data, extKeys)
+	block := obf.Obfuscate(or.rnd, data, extKeys)
 	params, args := extKeysToParams(or, extKeys)
 
 	if isPointer {
@@ -315,7 +587,7 @@ func obfuscateByteArray(or *obfRand, isPointer bool, data []byte, length int64)
 	obf := or.pickObfuscator(len(data))
 
 	extKeys := randExtKeys(or.rnd)
-	block := obf.obfuscate(or.rnd, data, extKeys)
+	block := obf.Obfuscate(or.rnd, data, extKeys)
 	params, args := extKeysToParams(or, extKeys)
 
 	arrayType := ah.ByteArrayType(length)
@@ -358,15 +630,35 @@ func obfuscateByteArray(or *obfRand, isPointer bool, data []byte, length int64)
 	return ah.LambdaCall(params, arrayType, block, args)
 }
 
-func (or *obfRand) pickObfuscator(size int) obfuscator {
-	if size < MinSize || size > MaxSize {
-		panic(fmt.Sprintf("nextObfuscator called with size %d outside [%d, %d]", size, MinSize, MaxSize))
+// sizeOK reports whether a string or byte literal of the given size is obfuscated,
+// counting it as skipped otherwise.
+func (or *obfRand) sizeOK(size int) bool {
+	switch {
+	case size == 0:
+		return false
+	case size < or.minSize:
+		if or.skipped != nil {
+			or.skipped.Short++
+		}
+		return false
+	case size > MaxSize:
+		if or.skipped != nil {
+			or.skipped.Long++
+		}
+		return false
+	}
+	return true
+}
+
+func (or *obfRand) pickObfuscator(size int) Obfuscator {
+	if size < 1 || size > MaxSize {
+		panic(fmt.Sprintf("pickObfuscator called with size %d outside [1, %d]", size, MaxSize))
 	}
-	if or.testObfuscator != nil {
-		return or.testObfuscator
+	if size < MinSize {
+		return short{}
 	}
-	if size <= MaxSizeExpensive {
-		return Obfuscators[or.rnd.Intn(len(Obfuscators))]
+	if or.testObfuscator != nil && size <= MaxSizeUnchunked {
+		return or.testObfuscator
 	}
-	return CheapObfuscators[or.rnd.Intn(len(CheapObfuscators))]
+	return or.weights.pick(or, size)
 }
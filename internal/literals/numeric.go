@@ -0,0 +1,227 @@
+// Copyright (c) 2026, The Garble Authors.
+// See LICENSE for licensing information.
+
+package literals
+
+import (
+	"fmt"
+	"go/ast"
+	"go/constant"
+	"go/token"
+	"go/types"
+	"math"
+	"slices"
+	"strconv"
+
+	ah "mvdan.cc/garble/internal/asthelper"
+)
+
+const (
+	// minNumberMagnitude is the lower bound of the absolute value of integer
+	// and integral float constants which we will obfuscate.
+	// Smaller numbers are very common as indexes, sizes, and bit shifts,
+	// so obfuscating them would slow down programs for little benefit.
+	minNumberMagnitude = 1 << 8
+
+	// maxNumberCompositeElts is the upper limit of the number of elements
+	// in a composite literal whose numeric constants we will obfuscate.
+	// Larger ones tend to be lookup tables, which would become costly to initialize.
+	maxNumberCompositeElts = 16
+
+	// minNumberExtKeyOps and maxNumberExtKeyOps bound the number of operations
+	// with external keys for one numeric constant.
+	minNumberExtKeyOps = 1
+	maxNumberExtKeyOps = 4
+)
+
+// isNumberType reports whether constants of a type are obfuscated by obfuscateNumber.
+// Named types are left alone, as we would need to refer to them by name.
+func isNumberType(typ types.Type) bool {
+	basic, ok := typ.(*types.Basic)
+	if !ok {
+		return false
+	}
+	switch {
+	case basic.Kind() == types.UntypedBool:
+		// Untyped boolean constants stay untyped in conditions like "if true".
+		return true
+	case basic.Info()&types.IsUntyped != 0:
+		return false
+	}
+	return basic.Info()&(types.IsInteger|types.IsFloat|types.IsBoolean) != 0
+}
+
+// isBoolType reports whether a type is a boolean, such as bool or untyped bool.
+func isBoolType(typ types.Type) bool {
+	basic, ok := typ.Underlying().(*types.Basic)
+	return ok && basic.Info()&types.IsBoolean != 0
+}
+
+// numberContextOK reports whether a constant expression at the cursor
+// can be replaced by a value computed at run time.
+// Only the outermost constant expressions are replaced to keep their semantics,
+// and some places such as array lengths require constants.
+func numberContextOK(parent ast.Node, field string, info *types.Info) bool {
+	switch parent := parent.(type) {
+	case *ast.ArrayType:
+		return false // the length of an array type
+	case *ast.KeyValueExpr:
+		return field != "Key" // array and slice indexes must be constant
+	case ast.Expr:
+		return info.Types[parent].Value == nil
+	}
+	return true
+}
+
+// skipsNumbers reports whether numeric constants under a node should be left alone,
+// to avoid slowing down loops or growing the initialization of large tables.
+// Labeled statements count as loops, as they may be the target of a backward goto,
+// such as in the code generated by control flow obfuscation.
+//
+// Conversions between unsafe.Pointer and uintptr are also skipped,
+// as calling a func while such a uintptr is live could let a goroutine stack move.
+func skipsNumbers(node ast.Node, info *types.Info) bool {
+	switch node := node.(type) {
+	case *ast.ForStmt, *ast.RangeStmt, *ast.LabeledStmt:
+		return true
+	case *ast.CompositeLit:
+		return len(node.Elts) > maxNumberCompositeElts
+	case *ast.CallExpr:
+		if isUnsafePointerConversion(node, info) {
+			return true
+		}
+		for _, arg := range node.Args {
+			if arg, ok := ast.Unparen(arg).(*ast.CallExpr); ok && isUnsafePointerConversion(arg, info) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// isUnsafePointerConversion reports whether call converts to or from unsafe.Pointer.
+func isUnsafePointerConversion(call *ast.CallExpr, info *types.Info) bool {
+	if !info.Types[call.Fun].IsType() || len(call.Args) != 1 {
+		return false
+	}
+	unsafePointer := types.Typ[types.UnsafePointer]
+	return types.Identical(info.TypeOf(call.Fun), unsafePointer) ||
+		types.Identical(info.TypeOf(call.Args[0]), unsafePointer)
+}
+
+// obfuscateNumber returns an expression which computes an integer, float,
+// or boolean constant of the given type at run time, such as:
+//
+//	func(garbleExternalKey0 uint16, garbleExternalKey1 uint64) int {
+//		x := uint64(<obfuscated value>)
+//		x = x <random operator> uint64(<external key>) // repeated random times
+//		return int(x)
+//	}(<external key values>)
+//
+// The result is nil if the constant is too small to be worth obfuscating.
+func obfuscateNumber(or *obfRand, typ *types.Basic, value constant.Value) *ast.CallExpr {
+	var (
+		bits   uint64
+		result func(x ast.Expr) ast.Expr
+	)
+	typName := typ.Name()
+	switch info := typ.Info(); {
+	case info&types.IsBoolean != 0:
+		// Compare the decoded value with itself or with a different value.
+		bits = or.rnd.Uint64()
+		want := bits
+		if !constant.BoolVal(value) {
+			want ^= or.rnd.Uint64() | 1
+		}
+		result = func(x ast.Expr) ast.Expr { return ah.BinaryExpr(x, token.EQL, ah.UintLit(want)) }
+		typName = "bool"
+
+	case info&types.IsInteger != 0:
+		value = constant.ToInt(value)
+		if v, ok := constant.Int64Val(value); ok {
+			if -minNumberMagnitude < v && v < minNumberMagnitude {
+				return nil
+			}
+			bits = uint64(v)
+		} else if v, ok := constant.Uint64Val(value); ok {
+			bits = v
+		} else {
+			return nil // should never happen for a typed constant
+		}
+		result = func(x ast.Expr) ast.Expr { return ah.CallExprByName(typName, x) }
+
+	case info&types.IsFloat != 0:
+		f, _ := constant.Float64Val(constant.ToFloat(value))
+		mantBits, minExp, maxExp := 53, -1022, 1023
+		if typ.Kind() == types.Float32 {
+			mantBits, minExp, maxExp = 24, -126, 127
+			f = float64(float32(f))
+		}
+		if f == math.Trunc(f) && math.Abs(f) < minNumberMagnitude {
+			return nil
+		}
+		// Split the float into an integer mantissa and a power of two,
+		// as neither conversion loses precision.
+		// We use all mantissa bits so that the power of two only reveals
+		// the magnitude of the number.
+		frac, exp := math.Frexp(f)
+		mant := int64(math.Ldexp(frac, mantBits))
+		exp -= mantBits
+		if exp < minExp || exp > maxExp {
+			return nil // the scale would not be a normal float
+		}
+		bits = uint64(mant)
+		result = func(x ast.Expr) ast.Expr {
+			var expr ast.Expr = ah.CallExprByName(typName, ah.CallExprByName("int64", x))
+			if exp != 0 {
+				scale := &ast.BasicLit{
+					Kind:  token.FLOAT,
+					Value: strconv.FormatFloat(math.Ldexp(1, exp), 'g', -1, 64),
+				}
+				expr = ah.BinaryExpr(expr, token.MUL, scale)
+			}
+			return expr
+		}
+
+	default:
+		return nil
+	}
+
+	extKeys := randExtKeys(or.rnd)
+	var stmts []ast.Stmt
+	// The operations may cancel each other out, such as adding and subtracting
+	// the same key, so keep going until the value in the code is a different one.
+	orig := bits
+	ops := minNumberExtKeyOps + or.rnd.Intn(maxNumberExtKeyOps-minNumberExtKeyOps)
+	for i := 0; i < ops || (bits == orig && i < 2*maxNumberExtKeyOps); i++ {
+		key := extKeys[or.rnd.Intn(len(extKeys))]
+		key.AddRef()
+
+		op := randOperator(or.rnd)
+		bits = evalOperator64(op, bits, key.value)
+		stmts = append(stmts, ah.AssignStmt(
+			ast.NewIdent("x"),
+			operatorToReversedBinaryExpr(op, ast.NewIdent("x"), ah.CallExprByName("uint64", key.Name())),
+		))
+	}
+	// Like in dataToByteSliceWithExtKeys, undo the operations in reverse order.
+	slices.Reverse(stmts)
+
+	stmts = append([]ast.Stmt{ah.AssignDefineStmt(ast.NewIdent("x"), ah.CallExprByName("uint64", ah.UintLit(bits)))}, stmts...)
+	stmts = append(stmts, ah.ReturnStmt(result(ast.NewIdent("x"))))
+	params, args := extKeysToParams(or, extKeys)
+	return ah.LambdaCall(params, ast.NewIdent(typName), ah.BlockStmt(stmts...), args)
+}
+
+func evalOperator64(t token.Token, x, y uint64) uint64 {
+	switch t {
+	case token.XOR:
+		return x ^ y
+	case token.ADD:
+		return x + y
+	case token.SUB:
+		return x - y
+	default:
+		panic(fmt.Sprintf("unknown operator: %s", t))
+	}
+}
@@ -30,54 +30,61 @@ func (r externalKeyProbability) Try(rand *mathrand.Rand) bool {
 	return rand.Float32() < float32(r)
 }
 
-// externalKey contains all information about the external key
-type externalKey struct {
+// ExternalKey contains all information about the external key.
+// External keys are passed as parameters to the function decoding a literal,
+// so that its data is not enough to decode it.
+type ExternalKey struct {
 	name, typ string
 	value     uint64
 	bits      int
 	refs      int
 }
 
-func (k *externalKey) Type() *ast.Ident {
+// Type returns the unsigned integer type of the key, such as uint16.
+func (k *ExternalKey) Type() *ast.Ident {
 	return ast.NewIdent(k.typ)
 }
 
-func (k *externalKey) Name() *ast.Ident {
+// Name returns the name of the parameter holding the key.
+func (k *ExternalKey) Name() *ast.Ident {
 	return ast.NewIdent(k.name)
 }
 
-func (k *externalKey) AddRef() {
+// Value returns the value of the key, which fits in its type.
+func (k *ExternalKey) Value() uint64 {
+	return k.value
+}
+
+// Bits returns the size of the key's type in bits.
+func (k *ExternalKey) Bits() int {
+	return k.bits
+}
+
+// AddRef must be called when the key is used in the generated code,
+// so that the parameter is named.
+func (k *ExternalKey) AddRef() {
 	k.refs++
 }
 
-func (k *externalKey) IsUsed() bool {
+// IsUsed reports whether AddRef was called.
+func (k *ExternalKey) IsUsed() bool {
 	return k.refs > 0
 }
 
-// obfuscator takes a byte slice and converts it to a ast.BlockStmt
-type obfuscator interface {
-	obfuscate(obfRand *mathrand.Rand, data []byte, extKeys []*externalKey) *ast.BlockStmt
+// Obfuscator takes a byte slice and converts it to a ast.BlockStmt,
+// which declares a "data" variable of type []byte holding the original bytes.
+// The statements may use the external keys by their names,
+// and the data may be modified in place.
+//
+// Obfuscators must be deterministic given the same random source,
+// so that builds are reproducible.
+type Obfuscator interface {
+	Obfuscate(obfRand *mathrand.Rand, data []byte, extKeys []*ExternalKey) *ast.BlockStmt
 }
 
 var (
-	// Obfuscators contains all types which implement the obfuscator Interface.
-	Obfuscators = []obfuscator{
-		simple{},
-		swap{},
-		split{},
-		shuffle{},
-		seed{},
-	}
-
-	// CheapObfuscators contains obfuscators safe to use on large literals.
-	// The expensive obfuscators scale poorly, so they are excluded here.
-	CheapObfuscators = []obfuscator{
-		simple{},
-		swap{},
-	}
-
 	TestObfuscator         string
-	testPkgToObfuscatorMap map[string]obfuscator
+	testPkgToObfuscatorMap map[string]Obfuscator
 )
 
 func genRandIntSlice(obfRand *mathrand.Rand, max, count int) []int {
@@ -147,9 +154,9 @@ var extKeyRanges = []struct {
 }
 
 // randExtKey generates a random external key with a unique name, type, value, and bitnesses
-func randExtKey(rand *mathrand.Rand, idx int) *externalKey {
+func randExtKey(rand *mathrand.Rand, idx int) *ExternalKey {
 	r := extKeyRanges[rand.Intn(len(extKeyRanges))]
-	return &externalKey{
+	return &ExternalKey{
 		name:  "garbleExternalKey" + strconv.Itoa(idx),
 		typ:   r.typ,
 		value: rand.Uint64() & r.max,
@@ -157,9 +164,9 @@ func randExtKey(rand *mathrand.Rand, idx int) *externalKey {
 	}
 }
 
-func randExtKeys(rand *mathrand.Rand) []*externalKey {
+func randExtKeys(rand *mathrand.Rand) []*ExternalKey {
 	count := minExtKeyCount + rand.Intn(maxExtKeyCount-minExtKeyCount)
-	keys := make([]*externalKey, count)
+	keys := make([]*ExternalKey, count)
 	for i := range count {
 		keys[i] = randExtKey(rand, i)
 	}
@@ -168,7 +175,7 @@ func randExtKeys(rand *mathrand.Rand) []*externalKey {
 
 // extKeysToParams converts a list of extKeys into a parameter list and argument expressions for function calls.
 // It ensures unused keys have placeholder names and sometimes use proxyDispatcher.HideValue for key values
-func extKeysToParams(objRand *obfRand, keys []*externalKey) (params *ast.FieldList, args []ast.Expr) {
+func extKeysToParams(objRand *obfRand, keys []*ExternalKey) (params *ast.FieldList, args []ast.Expr) {
 	params = &ast.FieldList{}
 	for _, key := range keys {
 		name := key.Name()
@@ -189,7 +196,7 @@ func extKeysToParams(objRand *obfRand, keys []*externalKey) (params *ast.FieldLi
 // extKeyToExpr converts an external key into an AST expression like:
 //
 //	uint8(key >> b)
-func (key *externalKey) ToExpr(b int) ast.Expr {
+func (key *ExternalKey) ToExpr(b int) ast.Expr {
 	var x ast.Expr = key.Name()
 	if b > 0 {
 		x = ah.BinaryExpr(x, token.SHR, ah.IntLit(b*8))
@@ -207,7 +214,7 @@ func (key *externalKey) ToExpr(b int) ast.Expr {
 //		data[<index>] = data[<index>] <random operator> byte(<external key> >> <random shift>) // repeated random times
 //		return data
 //	}()
-func dataToByteSliceWithExtKeys(rand *mathrand.Rand, data []byte, extKeys []*externalKey) ast.Expr {
+func dataToByteSliceWithExtKeys(rand *mathrand.Rand, data []byte, extKeys []*ExternalKey) ast.Expr {
 	extKeyOpCount := minByteSliceExtKeyOps + rand.Intn(maxByteSliceExtKeyOps-minByteSliceExtKeyOps)
 
 	var stmts []ast.Stmt
@@ -237,7 +244,7 @@ func dataToByteSliceWithExtKeys(rand *mathrand.Rand, data []byte, extKeys []*ext
 // byteLitWithExtKey scrambles a byte value into an AST expression like:
 //
 //	byte(<obfuscated value>) <random operator> byte(<external key> >> <random shift>)
-func byteLitWithExtKey(rand *mathrand.Rand, val byte, extKeys []*externalKey, extKeyProb externalKeyProbability) ast.Expr {
+func byteLitWithExtKey(rand *mathrand.Rand, val byte, extKeys []*ExternalKey, extKeyProb externalKeyProbability) ast.Expr {
 	if !extKeyProb.Try(rand) {
 		return ah.IntLit(int(val))
 	}
@@ -254,14 +261,42 @@ func byteLitWithExtKey(rand *mathrand.Rand, val byte, extKeys []*externalKey, ex
 	)
 }
 
+// heat tells how often the function being obfuscated runs, according to a profile.
+type heat uint8
+
+const (
+	heatUnknown heat = iota // no profile, or outside of functions
+	heatHot
+	heatCold
+)
+
 type obfRand struct {
 	rnd *mathrand.Rand
 
-	testObfuscator  obfuscator
+	heat            heat
+	weights         ObfuscatorWeights
+	testObfuscator  Obfuscator
 	proxyDispatcher *proxyDispatcher
+
+	// poolDispatcher hides the values used by the funcs of a [Pool].
+	// As the funcs themselves are hidden in proxyDispatcher,
+	// using it for both would make its variable refer to itself.
+	poolDispatcher *proxyDispatcher
+
+	// minSize is the lower bound of the size of the literals to obfuscate,
+	// and skipped counts those left alone; see [Config].
+	minSize int
+	skipped *SkippedSizes
 }
 
-func newObfRand(rand *mathrand.Rand, file *ast.File, nameFunc NameProviderFunc) *obfRand {
+func newObfRand(rand *mathrand.Rand, file *ast.File, weights ObfuscatorWeights, nameFunc NameProviderFunc) *obfRand {
 	testObf := testPkgToObfuscatorMap[file.Name.Name]
-	return &obfRand{rand, testObf, newProxyDispatcher(rand, nameFunc)}
+	return &obfRand{
+		rnd:             rand,
+		weights:         weights,
+		testObfuscator:  testObf,
+		proxyDispatcher: newProxyDispatcher(rand, nameFunc),
+		poolDispatcher:  newProxyDispatcher(rand, nameFunc),
+		minSize:         MinSize,
+	}
 }
@@ -0,0 +1,150 @@
+// Copyright (c) 2026, The Garble Authors.
+// See LICENSE for licensing information.
+
+package literals
+
+import (
+	"go/ast"
+	"go/constant"
+	"go/token"
+	"go/types"
+	"strings"
+
+	ah "mvdan.cc/garble/internal/asthelper"
+)
+
+// Pool shares the obfuscation of the strings which appear more than once
+// in a package. Each of them is obfuscated only once, as a func hidden behind
+// the proxy dispatcher of the first file using it, which all of its uses call:
+//
+//	<proxy dispatcher path>()
+//
+// Otherwise, the error messages or map keys repeated throughout a package
+// would each get their own decoding code and junk bytes, growing binaries.
+type Pool struct {
+	// counts holds how many times each string appears in the package.
+	counts map[string]int
+
+	// funcs holds the paths to the hidden funcs which decode each string.
+	funcs map[string]ast.Expr
+}
+
+// NewPool counts the strings in the files of a package,
+// which must then be obfuscated with the returned pool.
+func NewPool(files []*ast.File, info *types.Info) *Pool {
+	p := &Pool{
+		counts: make(map[string]int),
+		funcs:  make(map[string]ast.Expr),
+	}
+	for _, file := range files {
+		if !ah.HasDirective(file.Doc, NoLiteralsDirective) {
+			ast.Inspect(file, func(node ast.Node) bool { return p.count(node, info) })
+		}
+	}
+	return p
+}
+
+// count counts the strings which [Obfuscate] replaces at a node,
+// and reports whether the strings within the node should be counted too.
+// Like Obfuscate, it skips constant declarations, and each constant expression
+// is replaced as a whole, so its operands are not counted on their own.
+func (p *Pool) count(node ast.Node, info *types.Info) bool {
+	if expr, ok := node.(ast.Expr); ok {
+		if tv := info.Types[expr]; tv.IsValue() && tv.Value != nil {
+			if tv.Type == types.Typ[types.String] {
+				p.add(tv.Value)
+			}
+			return false
+		}
+	}
+	// Constants with defined string types are only replaced when
+	// switching on them or comparing them, as plain strings.
+	namedConst := func(expr ast.Expr) {
+		if tv := info.Types[expr]; tv.Value != nil && isNamedString(tv.Type) {
+			p.add(tv.Value)
+		}
+	}
+	switch node := node.(type) {
+	case *ast.FuncDecl:
+		if node.Doc != nil {
+			for _, comment := range node.Doc.List {
+				if strings.HasPrefix(comment.Text, "//go:nosplit") {
+					return false
+				}
+			}
+		}
+		return !ah.HasDirective(node.Doc, NoLiteralsDirective)
+	case *ast.GenDecl:
+		return node.Tok != token.CONST && !ah.HasDirective(node.Doc, NoLiteralsDirective)
+	case *ast.ValueSpec:
+		return !ah.HasDirective(node.Doc, NoLiteralsDirective)
+	case *ast.SwitchStmt:
+		if node.Tag == nil || !isNamedString(info.TypeOf(node.Tag)) {
+			break
+		}
+		for _, stmt := range node.Body.List {
+			for _, expr := range stmt.(*ast.CaseClause).List {
+				if !isNamedString(info.TypeOf(expr)) {
+					return true
+				}
+			}
+		}
+		namedConst(node.Tag)
+		for _, stmt := range node.Body.List {
+			for _, expr := range stmt.(*ast.CaseClause).List {
+				namedConst(expr)
+			}
+		}
+	case *ast.BinaryExpr:
+		if (node.Op == token.EQL || node.Op == token.NEQ) && types.Identical(info.TypeOf(node.X), info.TypeOf(node.Y)) {
+			namedConst(node.X)
+			namedConst(node.Y)
+		}
+	}
+	return true
+}
+
+// add counts a use of a string constant, unless it is too large to obfuscate.
+func (p *Pool) add(value constant.Value) {
+	if value := constant.StringVal(value); len(value) <= MaxSize {
+		p.counts[value]++
+	}
+}
+
+// call returns a call to the func which decodes a string appearing more than once,
+// or nil if the string should be obfuscated on its own.
+func (p *Pool) call(or *obfRand, value string) *ast.CallExpr {
+	if p == nil || p.counts[value] < 2 {
+		return nil
+	}
+	path, ok := p.funcs[value]
+	if !ok {
+		funcType := func() *ast.FuncType {
+			return &ast.FuncType{
+				Params:  &ast.FieldList{},
+				Results: &ast.FieldList{List: []*ast.Field{{Type: ast.NewIdent("string")}}},
+			}
+		}
+		decodeRand := *or
+		decodeRand.proxyDispatcher = or.poolDispatcher
+		decode := &ast.FuncLit{
+			Type: funcType(),
+			Body: ah.BlockStmt(ah.ReturnStmt(obfuscateString(&decodeRand, value))),
+		}
+		path = or.proxyDispatcher.HideValue(decode, funcType())
+		p.funcs[value] = path
+	}
+	return ah.CallExpr(copyPath(path))
+}
+
+// copyPath returns a copy of a path built by the proxy dispatcher,
+// as each use of a pooled string needs its own syntax nodes.
+func copyPath(path ast.Expr) ast.Expr {
+	switch path := path.(type) {
+	case *ast.Ident:
+		return ast.NewIdent(path.Name)
+	case *ast.SelectorExpr:
+		return &ast.SelectorExpr{X: copyPath(path.X), Sel: ast.NewIdent(path.Sel.Name)}
+	}
+	panic("unexpected proxy dispatcher path")
+}
@@ -0,0 +1,62 @@
+// Copyright (c) 2026, The Garble Authors.
+// See LICENSE for licensing information.
+
+package literals
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"testing"
+
+	"github.com/go-quicktest/qt"
+)
+
+func TestPoolCounts(t *testing.T) {
+	t.Parallel()
+	const src = `package p
+
+const single = "constant used once"
+
+type command string
+
+const activate command = "activate command"
+
+var (
+	concat = "left operand " + "right operand"
+	paren  = ("parenthesized string")
+	twice  = "repeated string"
+	length = len("measured string")
+)
+
+func f(c command) string {
+	switch c {
+	case activate:
+		return single
+	}
+	if c == activate {
+		return "repeated string"
+	}
+	return string(c)
+}
+
+//garble:noliterals
+func skipped() string { return "repeated string" }
+`
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "p.go", src, parser.ParseComments|parser.SkipObjectResolution)
+	qt.Assert(t, qt.IsNil(err))
+	info := &types.Info{Types: make(map[ast.Expr]types.TypeAndValue)}
+	_, err = new(types.Config).Check("p", fset, []*ast.File{file}, info)
+	qt.Assert(t, qt.IsNil(err))
+
+	p := NewPool([]*ast.File{file}, info)
+	qt.Assert(t, qt.DeepEquals(p.counts, map[string]int{
+		"constant used once":         1,
+		"activate command":           2,
+		"left operand right operand": 1,
+		"parenthesized string":       1,
+		"repeated string":            2,
+	}))
+}
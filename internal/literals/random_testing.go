@@ -13,7 +13,7 @@ func init() {
 	if obfMapEnv == "" {
 		panic("literals obfuscator map required for testing build")
 	}
-	testPkgToObfuscatorMap = make(map[string]obfuscator)
+	testPkgToObfuscatorMap = make(map[string]Obfuscator)
 
 	// Parse obfuscator mapping: pkgName1=obfIndex1,pkgName2=obfIndex2
 	pairs := strings.Split(obfMapEnv, ",")
@@ -25,7 +25,7 @@ func init() {
 		if err != nil {
 			panic(err)
 		}
-		testPkgToObfuscatorMap[pkgName] = Obfuscators[obfIndex]
+		testPkgToObfuscatorMap[pkgName] = registry[obfIndex].obf
 	}
 	TestObfuscator = obfMapEnv
 }
@@ -0,0 +1,143 @@
+// Copyright (c) 2026, The Garble Authors.
+// See LICENSE for licensing information.
+
+package literals
+
+import (
+	"fmt"
+	"slices"
+)
+
+// Cost is how expensive the code of an obfuscator is at run time.
+// Hot functions only use cheap obfuscators, and cold functions expensive ones,
+// unless none of them support a literal's size; see [Config.Hot].
+type Cost int
+
+const (
+	// Cheap obfuscators decode literals in time proportional to their size,
+	// such as with a single pass over the data.
+	Cheap Cost = iota
+
+	// Expensive obfuscators are harder to reverse, but decode literals
+	// in more time or with more code, such as one statement per byte.
+	Expensive
+)
+
+// registeredObfuscator is an obfuscator added via [Register].
+type registeredObfuscator struct {
+	name    string
+	obf     Obfuscator
+	weight  int
+	maxSize int
+	cost    Cost
+}
+
+// registry holds the obfuscators which can be picked for a literal,
+// in the order they were registered, which keeps the picks deterministic.
+var registry = []registeredObfuscator{
+	{"simple", simple{}, 1, MaxSizeUnchunked, Cheap},
+	{"swap", swap{}, 1, MaxSizeUnchunked, Cheap},
+	// The expensive obfuscators scale poorly, so they are only used on small literals.
+	{"split", split{}, 1, MaxSizeExpensive, Expensive},
+	{"shuffle", shuffle{}, 1, MaxSizeExpensive, Expensive},
+	{"seed", seed{}, 1, MaxSizeExpensive, Expensive},
+	// chunked is not picked by default, but it is used for literals
+	// which none of the enabled obfuscators support.
+	{"chunked", chunked{}, 0, MaxSize, Cheap},
+}
+
+// Register adds an obfuscator which may be picked at random for literals
+// of up to maxSize bytes, relative to the weights of the other obfuscators
+// with the same cost.
+// A weight of zero means that it is only used when selected by name,
+// such as via [ObfuscatorWeights].
+//
+// Register must be called from an init function,
+// so that every garble process agrees on the registered obfuscators.
+// It panics if the name is already registered or the arguments are invalid.
+func Register(name string, obf Obfuscator, weight, maxSize int, cost Cost) {
+	switch {
+	case name == "":
+		panic("literals: obfuscator name must not be empty")
+	case slices.ContainsFunc(registry, func(r registeredObfuscator) bool { return r.name == name }):
+		panic(fmt.Sprintf("literals: obfuscator %q registered twice", name))
+	case weight < 0:
+		panic(fmt.Sprintf("literals: obfuscator %q has a negative weight", name))
+	case maxSize < MinSize || maxSize > MaxSize:
+		panic(fmt.Sprintf("literals: obfuscator %q has a max size outside [%d, %d]", name, MinSize, MaxSize))
+	case cost != Cheap && cost != Expensive:
+		panic(fmt.Sprintf("literals: obfuscator %q has an unknown cost %d", name, cost))
+	}
+	registry = append(registry, registeredObfuscator{name, obf, weight, maxSize, cost})
+}
+
+// ObfuscatorNames returns the names of the registered obfuscators.
+func ObfuscatorNames() []string {
+	names := make([]string, len(registry))
+	for i, r := range registry {
+		names[i] = r.name
+	}
+	return names
+}
+
+// ObfuscatorWeights overrides the weights of the registered obfuscators by name.
+// Obfuscators missing from the map keep the weight they were registered with,
+// and a weight of zero disables an obfuscator.
+type ObfuscatorWeights map[string]int
+
+// pick returns a registered obfuscator at random according to the weights,
+// among those which support a literal of the given size.
+// When none do, the chunked obfuscator is used, as it supports any size.
+//
+// In hot functions, only the [Cheap] obfuscators are considered,
+// falling back to chunked as it is cheap too.
+// In cold functions, only the [Expensive] ones are considered,
+// unless none of them support the literal's size.
+func (w ObfuscatorWeights) pick(or *obfRand, size int) Obfuscator {
+	if or.heat != heatUnknown {
+		want := Expensive
+		if or.heat == heatHot {
+			want = Cheap
+		}
+		if obf := w.pickIf(or, size, func(r registeredObfuscator) bool {
+			return r.cost == want
+		}); obf != nil {
+			return obf
+		}
+		if want == Cheap {
+			return chunked{}
+		}
+	}
+	if obf := w.pickIf(or, size, nil); obf != nil {
+		return obf
+	}
+	return chunked{}
+}
+
+// pickIf is like pick, but only considers the obfuscators accepted by filter,
+// returning nil if none of them support a literal of the given size.
+func (w ObfuscatorWeights) pickIf(or *obfRand, size int, filter func(registeredObfuscator) bool) Obfuscator {
+	total := 0
+	weightOf := func(r registeredObfuscator) int {
+		if size > r.maxSize || (filter != nil && !filter(r)) {
+			return 0
+		}
+		if weight, ok := w[r.name]; ok {
+			return weight
+		}
+		return r.weight
+	}
+	for _, r := range registry {
+		total += weightOf(r)
+	}
+	if total == 0 {
+		return nil
+	}
+	n := or.rnd.Intn(total)
+	for _, r := range registry {
+		if n -= weightOf(r); n < 0 {
+			return r.obf
+		}
+	}
+	panic("unreachable")
+}
@@ -0,0 +1,59 @@
+// Copyright (c) 2026, The Garble Authors.
+// See LICENSE for licensing information.
+
+package literals
+
+import (
+	mathrand "math/rand"
+	"slices"
+	"testing"
+
+	"github.com/go-quicktest/qt"
+)
+
+// expensiveLarge is an expensive obfuscator which supports literals of any size,
+// so that its cost cannot be told from its maximum size.
+type expensiveLarge struct{ simple }
+
+func TestPickCost(t *testing.T) {
+	origRegistry := slices.Clone(registry)
+	t.Cleanup(func() { registry = origRegistry })
+	Register("expensive_large", expensiveLarge{}, 1, MaxSize, Expensive)
+
+	qt.Check(t, qt.PanicMatches(func() {
+		Register("unknown_cost", simple{}, 1, MaxSize, Cost(7))
+	}, `literals: obfuscator "unknown_cost" has an unknown cost 7`))
+
+	costOf := func(obf Obfuscator) Cost {
+		for _, r := range registry {
+			if r.obf == obf {
+				return r.cost
+			}
+		}
+		t.Fatalf("unregistered obfuscator %T", obf)
+		return 0
+	}
+	for _, tc := range []struct {
+		heat heat
+		size int
+		want Cost
+	}{
+		{heatHot, 16, Cheap},
+		{heatCold, 16, Expensive},
+		// Only expensive_large is expensive and supports large literals,
+		// and only chunked is cheap and supports them.
+		{heatHot, MaxSizeUnchunked * 2, Cheap},
+		{heatCold, MaxSizeUnchunked * 2, Expensive},
+	} {
+		or := &obfRand{rnd: mathrand.New(mathrand.NewSource(1)), heat: tc.heat}
+		picked := make(map[Obfuscator]bool)
+		for range 100 {
+			obf := ObfuscatorWeights(nil).pick(or, tc.size)
+			qt.Check(t, qt.Equals(costOf(obf), tc.want), qt.Commentf("%T for heat %d and size %d", obf, tc.heat, tc.size))
+			picked[obf] = true
+		}
+		if tc.heat == heatCold && tc.size > MaxSizeExpensive {
+			qt.Check(t, qt.DeepEquals(picked, map[Obfuscator]bool{expensiveLarge{}: true}))
+		}
+	}
+}
@@ -13,10 +13,10 @@ import (
 
 type seed struct{}
 
-// check that the obfuscator interface is implemented
-var _ obfuscator = seed{}
+// check that the Obfuscator interface is implemented
+var _ Obfuscator = seed{}
 
-func (seed) obfuscate(obfRand *mathrand.Rand, data []byte, extKeys []*externalKey) *ast.BlockStmt {
+func (seed) Obfuscate(obfRand *mathrand.Rand, data []byte, extKeys []*ExternalKey) *ast.BlockStmt {
 	seed := byte(obfRand.Uint32())
 	originalSeed := seed
 
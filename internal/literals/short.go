@@ -0,0 +1,54 @@
+// Copyright (c) 2026, The Garble Authors.
+// See LICENSE for licensing information.
+
+package literals
+
+import (
+	"go/ast"
+	"go/token"
+	mathrand "math/rand"
+
+	ah "mvdan.cc/garble/internal/asthelper"
+)
+
+// short is a cheap obfuscator for the literals shorter than [MinSize],
+// which are only obfuscated when a lower minimum size is configured.
+// Rather than storing a key as long as the data, each byte is xored
+// with a key derived from its index, keeping the code small and fast:
+//
+//	data := []byte("<obfuscated>")
+//	for i := range data {
+//		data[i] ^= <key> + byte(i)*<step>
+//	}
+//
+// It is not registered, as the other obfuscators are not worth it for short literals.
+type short struct{}
+
+// check that the Obfuscator interface is implemented
+var _ Obfuscator = short{}
+
+func (short) Obfuscate(rand *mathrand.Rand, data []byte, extKeys []*ExternalKey) *ast.BlockStmt {
+	key := byte(rand.Uint32())
+	step := byte(rand.Uint32()) | 1 // odd, so that every index gets a different key
+	for i := range data {
+		data[i] ^= key + byte(i)*step
+	}
+
+	return ah.BlockStmt(
+		ah.AssignDefineStmt(ast.NewIdent("data"), ah.DataToByteSlice(data)),
+		&ast.RangeStmt{
+			Key: ast.NewIdent("i"),
+			Tok: token.DEFINE,
+			X:   ast.NewIdent("data"),
+			Body: ah.BlockStmt(&ast.AssignStmt{
+				Lhs: []ast.Expr{ah.IndexExpr("data", ast.NewIdent("i"))},
+				Tok: token.XOR_ASSIGN,
+				Rhs: []ast.Expr{ah.BinaryExpr(
+					ah.IntLit(int(key)),
+					token.ADD,
+					ah.BinaryExpr(ah.CallExprByName("byte", ast.NewIdent("i")), token.MUL, ah.IntLit(int(step))),
+				)},
+			}),
+		},
+	)
+}
@@ -13,10 +13,10 @@ import (
 
 type shuffle struct{}
 
-// check that the obfuscator interface is implemented
-var _ obfuscator = shuffle{}
+// check that the Obfuscator interface is implemented
+var _ Obfuscator = shuffle{}
 
-func (shuffle) obfuscate(rand *mathrand.Rand, data []byte, extKeys []*externalKey) *ast.BlockStmt {
+func (shuffle) Obfuscate(rand *mathrand.Rand, data []byte, extKeys []*ExternalKey) *ast.BlockStmt {
 	key := make([]byte, len(data))
 	rand.Read(key)
 
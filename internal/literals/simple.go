@@ -13,10 +13,10 @@ import (
 
 type simple struct{}
 
-// check that the obfuscator interface is implemented
-var _ obfuscator = simple{}
+// check that the Obfuscator interface is implemented
+var _ Obfuscator = simple{}
 
-func (simple) obfuscate(rand *mathrand.Rand, data []byte, extKeys []*externalKey) *ast.BlockStmt {
+func (simple) Obfuscate(rand *mathrand.Rand, data []byte, extKeys []*ExternalKey) *ast.BlockStmt {
 	key := make([]byte, len(data))
 	rand.Read(key)
 
@@ -20,8 +20,8 @@ const (
 // then encrypts them using xor.
 type split struct{}
 
-// check that the obfuscator interface is implemented
-var _ obfuscator = split{}
+// check that the Obfuscator interface is implemented
+var _ Obfuscator = split{}
 
 func splitIntoRandomChunks(obfRand *mathrand.Rand, data []byte) [][]byte {
 	if len(data) == 1 {
@@ -66,7 +66,7 @@ func encryptChunks(chunks [][]byte, op token.Token, key byte) {
 	}
 }
 
-func (split) obfuscate(rand *mathrand.Rand, data []byte, extKeys []*externalKey) *ast.BlockStmt {
+func (split) Obfuscate(rand *mathrand.Rand, data []byte, extKeys []*ExternalKey) *ast.BlockStmt {
 	var chunks [][]byte
 	// Short arrays should be divided into single-byte fragments
 	if len(data)/maxChunkSize < minCaseCount {
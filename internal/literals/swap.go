@@ -14,8 +14,8 @@ import (
 
 type swap struct{}
 
-// check that the obfuscator interface is implemented
-var _ obfuscator = swap{}
+// check that the Obfuscator interface is implemented
+var _ Obfuscator = swap{}
 
 func getIndexType(dataLen int64) string {
 	switch {
@@ -58,7 +58,7 @@ func generateSwapCount(obfRand *mathrand.Rand, dataLen int) int {
 	return swapCount
 }
 
-func (swap) obfuscate(rand *mathrand.Rand, data []byte, extKeys []*externalKey) *ast.BlockStmt {
+func (swap) Obfuscate(rand *mathrand.Rand, data []byte, extKeys []*ExternalKey) *ast.BlockStmt {
 	swapCount := generateSwapCount(rand, len(data))
 	shiftKey := byte(rand.Uint32())
 
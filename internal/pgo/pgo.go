@@ -0,0 +1,189 @@
+// Copyright (c) 2026, The Garble Authors.
+// See LICENSE for licensing information.
+
+// Package pgo reads the profiles used for profile-guided optimization,
+// to tell which functions are on the hot path.
+package pgo
+
+import (
+	"bufio"
+	"fmt"
+	"go/ast"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// hotEdgePercent is the minimum share of a profile's total weight which a call edge
+// needs for its caller and callee to be considered hot.
+//
+// The compiler's PGO inlining instead takes the heaviest edges adding up to 99%
+// of the weight, which marks nearly every sampled function as hot.
+// A lower cumulative cutoff would favor leaf functions such as strings.Index,
+// as an edge's weight only counts the samples at that call site.
+// With a fixed share per edge, at most 100/hotEdgePercent edges are hot,
+// however long the tail of the profile is.
+const hotEdgePercent = 1
+
+// preprofileHeader starts the files written by "go tool preprofile",
+// which cmd/go passes to the compiler via -pgoprofile.
+const preprofileHeader = "GO PREPROFILE V1"
+
+// Profile holds the functions on the hot path of a profile.
+type Profile struct {
+	// hot holds function names as given by [normalizeName].
+	hot map[string]bool
+}
+
+// Load reads a profile file in the format written by "go tool preprofile".
+func Load(path string) (*Profile, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	prof, err := Parse(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return prof, nil
+}
+
+// Parse reads a profile in the format written by "go tool preprofile",
+// which lists the call edges as lines with the caller, the callee,
+// and the call site offset followed by the edge's weight.
+//
+// The callers and callees of the edges with at least [hotEdgePercent]
+// of the total weight are considered hot.
+func Parse(r io.Reader) (*Profile, error) {
+	type edge struct {
+		caller, callee string
+		weight         int64
+	}
+	var edges []edge
+	var total int64
+	scanner := bufio.NewScanner(r)
+	if !scanner.Scan() || scanner.Text() != preprofileHeader {
+		return nil, fmt.Errorf("not a preprocessed profile; missing %q header", preprofileHeader)
+	}
+	for scanner.Scan() {
+		caller := scanner.Text()
+		if !scanner.Scan() {
+			return nil, fmt.Errorf("missing callee for caller %q", caller)
+		}
+		callee := scanner.Text()
+		if !scanner.Scan() {
+			return nil, fmt.Errorf("missing weight for edge %q to %q", caller, callee)
+		}
+		_, weightStr, _ := strings.Cut(scanner.Text(), " ")
+		weight, err := strconv.ParseInt(weightStr, 10, 64)
+		if err != nil || weight < 0 {
+			return nil, fmt.Errorf("invalid weight for edge %q to %q: %q", caller, callee, scanner.Text())
+		}
+		edges = append(edges, edge{caller, callee, weight})
+		total += weight
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	prof := &Profile{hot: make(map[string]bool)}
+	for _, e := range edges {
+		if e.weight == 0 || e.weight*100 < total*hotEdgePercent {
+			continue
+		}
+		prof.hot[normalizeName(e.caller)] = true
+		prof.hot[normalizeName(e.callee)] = true
+	}
+	return prof, nil
+}
+
+// Hot reports whether a function declared in a package is on the hot path,
+// including the closures declared inside it. A nil Profile has no hot functions.
+//
+// pkgPath is the package path as used in symbol names, which is "main" for main packages.
+func (p *Profile) Hot(pkgPath string, decl *ast.FuncDecl) bool {
+	if p == nil {
+		return false
+	}
+	return p.hot[FuncName(pkgPath, decl)]
+}
+
+// FuncName returns the name of a function declaration as it appears in profiles,
+// such as "example.com/pkg.(*T).Method", but without any type parameters.
+func FuncName(pkgPath string, decl *ast.FuncDecl) string {
+	if decl.Recv == nil || len(decl.Recv.List) == 0 {
+		return pkgPath + "." + decl.Name.Name
+	}
+	recv := decl.Recv.List[0].Type
+	star := false
+	if expr, ok := recv.(*ast.StarExpr); ok {
+		recv, star = expr.X, true
+	}
+	switch expr := recv.(type) {
+	case *ast.IndexExpr:
+		recv = expr.X
+	case *ast.IndexListExpr:
+		recv = expr.X
+	}
+	typeName := "?"
+	if ident, ok := recv.(*ast.Ident); ok {
+		typeName = ident.Name
+	}
+	if star {
+		return pkgPath + ".(*" + typeName + ")." + decl.Name.Name
+	}
+	return pkgPath + "." + typeName + "." + decl.Name.Name
+}
+
+// normalizeName removes the type arguments from a symbol name in a profile,
+// as well as the suffixes of closures, so that they count towards the function
+// which declares them. For example, both "pkg.(*T[go.shape.int]).M" and
+// "pkg.(*T[go.shape.int]).M.func1.2" become "pkg.(*T).M".
+func normalizeName(name string) string {
+	if strings.Contains(name, "[") {
+		var sb strings.Builder
+		depth := 0
+		for _, r := range name {
+			switch {
+			case r == '[':
+				depth++
+			case r == ']':
+				depth--
+			case depth == 0:
+				sb.WriteRune(r)
+			}
+		}
+		name = sb.String()
+	}
+	// Only look at the part after the package path, which may contain dots.
+	slash := strings.LastIndexByte(name, '/')
+	for {
+		dot := strings.LastIndexByte(name, '.')
+		if dot <= slash || !isClosureSuffix(name[dot+1:]) {
+			return name
+		}
+		name = name[:dot]
+	}
+}
+
+// isClosureSuffix reports whether an element of a symbol name is added by the compiler
+// for closures, such as "func1", "gowrap2", "deferwrap3", or just "1" when nested.
+func isClosureSuffix(s string) bool {
+	for _, prefix := range []string{"func", "gowrap", "deferwrap"} {
+		if rest, ok := strings.CutPrefix(s, prefix); ok {
+			s = rest
+			break
+		}
+	}
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,132 @@
+package pgo
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"strings"
+	"testing"
+
+	"github.com/go-quicktest/qt"
+)
+
+func TestParse(t *testing.T) {
+	// The edge to cold has less than 1% of the total weight.
+	prof, err := Parse(strings.NewReader(`GO PREPROFILE V1
+example.com/pkg.run
+example.com/pkg.hot
+8 600
+example.com/pkg.hot
+example.com/pkg.(*Set[go.shape.int]).Add.func1.2
+3 300
+example.com/pkg.run
+example.com/pkg.warm
+12 95
+example.com/pkg.run
+example.com/pkg.cold
+14 5
+`))
+	qt.Assert(t, qt.IsNil(err))
+
+	src := `package p
+
+func run() {}
+func hot() {}
+func warm() {}
+func cold() {}
+func (*Set[T]) Add() {}
+func (Set[T]) Add() {}
+func (s *Set[T]) Len() {}
+`
+	f, err := parser.ParseFile(token.NewFileSet(), "p.go", src, 0)
+	qt.Assert(t, qt.IsNil(err))
+	decls := make(map[string]*ast.FuncDecl)
+	for _, decl := range f.Decls {
+		decl := decl.(*ast.FuncDecl)
+		decls[FuncName("example.com/pkg", decl)] = decl
+	}
+
+	hot := func(name string) bool {
+		decl := decls["example.com/pkg."+name]
+		qt.Assert(t, qt.IsNotNil(decl), qt.Commentf("%s", name))
+		return prof.Hot("example.com/pkg", decl)
+	}
+	qt.Check(t, qt.IsTrue(hot("run")))
+	qt.Check(t, qt.IsTrue(hot("hot")))
+	qt.Check(t, qt.IsTrue(hot("warm")))
+	qt.Check(t, qt.IsFalse(hot("cold")))
+	qt.Check(t, qt.IsTrue(hot("(*Set).Add")))
+	qt.Check(t, qt.IsFalse(hot("Set.Add")))
+	qt.Check(t, qt.IsFalse(hot("(*Set).Len")))
+
+	var nilProf *Profile
+	qt.Check(t, qt.IsFalse(nilProf.Hot("example.com/pkg", decls["example.com/pkg.hot"])))
+}
+
+func TestParseCutoff(t *testing.T) {
+	longTail := []int{50}
+	for range 200 {
+		longTail = append(longTail, 1)
+	}
+	for _, tc := range []struct {
+		name    string
+		weights []int
+		wantHot int // the number of leading callees which are hot
+	}{
+		{"Single", []int{10}, 1},
+		{"Even", []int{10, 10, 10, 10, 10}, 5},
+		{"AtCutoff", []int{99, 1}, 2},
+		{"BelowCutoff", []int{199, 1}, 1},
+		{"LongTail", longTail, 1},
+		{"ZeroWeight", []int{10, 0}, 1},
+		{"Empty", nil, 0},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var sb strings.Builder
+			sb.WriteString("GO PREPROFILE V1\n")
+			for i, weight := range tc.weights {
+				fmt.Fprintf(&sb, "main.caller%d\nmain.callee%d\n1 %d\n", i, i, weight)
+			}
+			prof, err := Parse(strings.NewReader(sb.String()))
+			qt.Assert(t, qt.IsNil(err))
+			for i := range tc.weights {
+				want := i < tc.wantHot
+				qt.Check(t, qt.Equals(prof.hot[fmt.Sprintf("main.callee%d", i)], want), qt.Commentf("callee %d", i))
+			}
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, tc := range []struct {
+		input   string
+		wantErr string
+	}{
+		{"", "not a preprocessed profile"},
+		{"\x0a\x00garbage", "not a preprocessed profile"},
+		{"GO PREPROFILE V1\nmain.main\n", "missing callee"},
+		{"GO PREPROFILE V1\nmain.main\nmain.f\n", "missing weight"},
+		{"GO PREPROFILE V1\nmain.main\nmain.f\n3 heavy\n", "invalid weight"},
+	} {
+		_, err := Parse(strings.NewReader(tc.input))
+		qt.Check(t, qt.ErrorMatches(err, ".*"+tc.wantErr+".*"), qt.Commentf("%q", tc.input))
+	}
+}
+
+func TestNormalizeName(t *testing.T) {
+	for name, want := range map[string]string{
+		"main.main":                        "main.main",
+		"main.main.func1":                  "main.main",
+		"main.main.func1.2.3":              "main.main",
+		"main.main.gowrap1":                "main.main",
+		"main.(*T).M.deferwrap2":           "main.(*T).M",
+		"main.Map[go.shape.string,int]":    "main.Map",
+		"example.com/v2.F.func3":           "example.com/v2.F",
+		"example.com/v2.init":              "example.com/v2.init",
+		"example.com/v2.init.0":            "example.com/v2.init",
+		"example.com/v2.(*T[...]).Method2": "example.com/v2.(*T).Method2",
+	} {
+		qt.Check(t, qt.Equals(normalizeName(name), want))
+	}
+}
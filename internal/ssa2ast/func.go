@@ -234,23 +234,11 @@ func (fc *funcConverter) convertCall(callCommon ssa.CallCommon) (*ast.CallExpr,
 				callExpr.Fun = methodName
 			}
 			if typeArgs := val.TypeArgs(); len(typeArgs) > 0 {
-				// Generic methods are called in a monomorphic view (e.g. "someMethod[int string]"),
-				// so to get the original name, delete everything starting from "[" inclusive.
-				methodName.Name, _, _ = strings.Cut(methodName.Name, "[")
-				genericCallExpr := &ast.IndexListExpr{
-					X: callExpr.Fun,
-				}
-
-				// For better readability of generated code and to avoid ambiguities,
-				// we explicitly specify generic method types (e.g. "someMethod[int, string](0, "str")")
-				for _, typArg := range typeArgs {
-					typeExpr, err := fc.tc.Convert(typArg)
-					if err != nil {
-						return nil, err
-					}
-					genericCallExpr.Indices = append(genericCallExpr.Indices, typeExpr)
+				var err error
+				callExpr.Fun, err = fc.instantiate(callExpr.Fun, methodName, typeArgs)
+				if err != nil {
+					return nil, err
 				}
-				callExpr.Fun = genericCallExpr
 			}
 		case *ssa.Builtin:
 			name := val.Name()
@@ -291,6 +279,25 @@ func (fc *funcConverter) convertCall(callCommon ssa.CallCommon) (*ast.CallExpr,
 	return callExpr, nil
 }
 
+// instantiate returns the expression referring to the function named name, instantiated with typeArgs.
+func (fc *funcConverter) instantiate(fun ast.Expr, name *ast.Ident, typeArgs []types.Type) (ast.Expr, error) {
+	// Generic functions are referred to in a monomorphic view (e.g. "someMethod[int string]"),
+	// so to get the original name, delete everything starting from "[" inclusive.
+	name.Name, _, _ = strings.Cut(name.Name, "[")
+	genericExpr := &ast.IndexListExpr{X: fun}
+
+	// For better readability of generated code and to avoid ambiguities,
+	// we explicitly specify generic method types (e.g. "someMethod[int, string](0, "str")")
+	for _, typArg := range typeArgs {
+		typeExpr, err := fc.tc.Convert(typArg)
+		if err != nil {
+			return nil, err
+		}
+		genericExpr.Indices = append(genericExpr.Indices, typeExpr)
+	}
+	return genericExpr, nil
+}
+
 func (fc *funcConverter) convertSsaValueNonExplicitNil(ssaValue ssa.Value) (ast.Expr, error) {
 	return fc.ssaValue(ssaValue, false)
 }
@@ -299,26 +306,48 @@ func (fc *funcConverter) convertSsaValue(ssaValue ssa.Value) (ast.Expr, error) {
 	return fc.ssaValue(ssaValue, true)
 }
 
+// getThunkMethodCall returns the method expression (e.g. "(*T).Method") for a thunk function.
 func (fc *funcConverter) getThunkMethodCall(val *ssa.Function) (ast.Expr, error) {
 	const thunkPrefix = "$thunk"
-	if !strings.HasSuffix(val.Name(), thunkPrefix) {
-		return nil, nil
-	}
-	thunkType, ok := val.Object().Type().Underlying().(*types.Signature)
+	name, ok := strings.CutSuffix(val.Name(), thunkPrefix)
 	if !ok {
-		return nil, fmt.Errorf("unsupported thunk type: %w", ErrUnsupported)
+		return nil, nil
 	}
-	recvVar := thunkType.Recv()
-	if recvVar == nil {
-		return nil, fmt.Errorf("unsupported non method thunk: %w", ErrUnsupported)
+	// The receiver of the method expression is the first parameter of the thunk.
+	// Note that it can differ from the receiver of the method,
+	// such as with promoted methods or value methods called on pointers.
+	params := val.Signature.Params()
+	if params.Len() == 0 {
+		return nil, fmt.Errorf("thunk %q without receiver: %w", val.Name(), ErrUnsupported)
 	}
-
-	thunkTypeAst, err := fc.tc.Convert(recvVar.Type())
+	thunkTypeAst, err := fc.tc.Convert(params.At(0).Type())
 	if err != nil {
 		return nil, err
 	}
-	trimmedName := ast.NewIdent(strings.TrimSuffix(val.Name(), thunkPrefix))
-	return ah.SelectExpr(&ast.ParenExpr{X: thunkTypeAst}, trimmedName), nil
+	name, _, _ = strings.Cut(name, "[")
+	return ah.SelectExpr(&ast.ParenExpr{X: thunkTypeAst}, ast.NewIdent(name)), nil
+}
+
+// getBoundMethodName returns the name of the method bound by a method value (e.g. "x.Method"),
+// which go/ssa represents as a closure of a bound function over the receiver.
+func getBoundMethodName(val *ssa.Function) (string, bool) {
+	const boundSuffix = "$bound"
+	name, ok := strings.CutSuffix(val.Name(), boundSuffix)
+	if !ok {
+		return "", false
+	}
+	name, _, _ = strings.Cut(name, "[")
+	return name, true
+}
+
+// localName returns the name of a parameter or free variable.
+// Those of synthetic functions, such as the bodies of range-over-func loops,
+// are given new names, as their names may clash or not be valid identifiers.
+func (fc *funcConverter) localName(val ssa.Value) string {
+	if name := val.Name(); val.Parent().Synthetic == "" && token.IsIdentifier(name) {
+		return name
+	}
+	return fc.getVarName(val)
 }
 
 func (fc *funcConverter) ssaValue(ssaValue ssa.Value, explicitNil bool) (expr ast.Expr, err error) {
@@ -360,12 +389,16 @@ func (fc *funcConverter) ssaValue(ssaValue ssa.Value, explicitNil bool) (expr as
 		}
 
 		name := ast.NewIdent(val.Name())
+		var funcExpr ast.Expr = name
 		if val.Signature.Recv() == nil && val.Pkg != nil {
 			if pkgIdent := fc.importNameResolver(val.Pkg.Pkg); pkgIdent != nil {
-				return ah.SelectExpr(pkgIdent, name), nil
+				funcExpr = ah.SelectExpr(pkgIdent, name)
 			}
 		}
-		return name, nil
+		if typeArgs := val.TypeArgs(); len(typeArgs) > 0 {
+			return fc.instantiate(funcExpr, name, typeArgs)
+		}
+		return funcExpr, nil
 	case *ssa.Const:
 		var constExpr ast.Expr
 		if val.Value == nil {
@@ -402,7 +435,7 @@ func (fc *funcConverter) ssaValue(ssaValue ssa.Value, explicitNil bool) (expr as
 		}
 		return ah.CallExpr(&ast.ParenExpr{X: castExpr}, constExpr), nil
 	case *ssa.Parameter, *ssa.FreeVar:
-		return ast.NewIdent(val.Name()), nil
+		return ast.NewIdent(fc.localName(val)), nil
 	default:
 		return ast.NewIdent(fc.getVarName(val)), nil
 	}
@@ -477,7 +510,7 @@ func (fc *funcConverter) convertBlock(astFunc *AstFunc, ssaBlock *ssa.BasicBlock
 		}
 
 		refs := r.Referrers()
-		if refs == nil || len(*refs) == 0 {
+		if refs == nil || len(*refs) == 0 || onlyOwnDefers(r, *refs) {
 			return ah.AssignStmt(ast.NewIdent("_"), expr)
 		}
 
@@ -541,11 +574,44 @@ func (fc *funcConverter) convertBlock(astFunc *AstFunc, ssaBlock *ssa.BasicBlock
 				Y:  yExpr,
 			})
 		case *ssa.Call:
+			if builtin, ok := instr.Call.Value.(*ssa.Builtin); ok {
+				switch builtin.Name() {
+				case "ssa:wrapnilchk":
+					// The pointer is always dereferenced next, which panics if it is nil.
+					ptrExpr, err := fc.convertSsaValue(instr.Call.Args[0])
+					if err != nil {
+						return err
+					}
+					stmt = defineVar(instr, ptrExpr)
+				case deferStackBuiltin:
+					// The stack is used after each range-over-func loop, so it is declared for the whole function.
+					stackName := fc.getVarName(instr)
+					astFunc.Vars[stackName] = instr.Type()
+					stmt = ah.AssignStmt(ast.NewIdent(stackName), ah.CallExprByName("new", deferStackType()))
+				}
+				if stmt != nil {
+					break
+				}
+			}
+
 			callFunExpr, err := fc.convertCall(instr.Call)
 			if err != nil {
 				return err
 			}
 			stmt = defineVar(instr, callFunExpr)
+			if callsYieldFunc(instr.Call) {
+				// Calls deferred by the body of a range-over-func loop are deferred once the loop is done.
+				// If the loop panics instead, they are deferred by a function deferred right before it,
+				// so that they still run before any call deferred earlier.
+				if stack := deferStackCall(instr.Parent()); stack != nil {
+					stackExpr := ast.NewIdent(fc.getVarName(stack))
+					astBlock.Body = append(astBlock.Body, &ast.DeferStmt{Call: ah.CallExpr(&ast.FuncLit{
+						Type: &ast.FuncType{Params: &ast.FieldList{}},
+						Body: fc.flushDeferStack(stackExpr).(*ast.BlockStmt),
+					})}, stmt)
+					stmt = fc.flushDeferStack(stackExpr)
+				}
+			}
 		case *ssa.ChangeInterface:
 			castExpr, err := fc.castCallExpr(instr.Type(), instr.X)
 			if err != nil {
@@ -569,7 +635,30 @@ func (fc *funcConverter) convertBlock(astFunc *AstFunc, ssaBlock *ssa.BasicBlock
 			if err != nil {
 				return err
 			}
-			stmt = &ast.DeferStmt{Call: callExpr}
+			if instr.DeferStack == nil || instr.Parent().Synthetic != yieldFuncSynthetic {
+				// The function owning the stack defers its own calls right away.
+				stmt = &ast.DeferStmt{Call: callExpr}
+				break
+			}
+
+			// Pushed calls with arguments are wrapped in a function literal, so they are not called directly
+			// when deferred, which would stop them from recovering a panic.
+			// Pushed calls are also deferred by another function if the loop panics, where they cannot recover it.
+			if mayRecover(instr.Call.Value) {
+				return fmt.Errorf("defer %v in range-over-func loop: %w", instr.Call.Value, ErrUnsupported)
+			}
+			stackExpr, err := fc.convertSsaValue(instr.DeferStack)
+			if err != nil {
+				return err
+			}
+			if _, ok := instr.Call.Value.(*ssa.Builtin); !ok && len(instr.Call.Args) == 0 {
+				stmt = deferStackPush(stackExpr, callExpr.Fun)
+				break
+			}
+			stmt, err = fc.deferStackPushCall(stackExpr, instr.Call)
+			if err != nil {
+				return err
+			}
 		case *ssa.Extract:
 			name := fc.tupleVarName(instr.Tuple, instr.Index)
 			stmt = defineVar(instr, ast.NewIdent(name))
@@ -835,7 +924,13 @@ func (fc *funcConverter) convertBlock(astFunc *AstFunc, ssaBlock *ssa.BasicBlock
 					if valHasRefs {
 						astFunc.Vars[valName] = valType
 					}
-					commStmt = ah.AssignStmt(ast.NewIdent(valName), &ast.UnaryExpr{Op: token.ARROW, X: chanExpr})
+					// The second value of the tuple reports whether the received value was sent,
+					// and is shared between all the receive cases.
+					commStmt = &ast.AssignStmt{
+						Lhs: []ast.Expr{ast.NewIdent(valName), ast.NewIdent(okName)},
+						Tok: token.ASSIGN,
+						Rhs: []ast.Expr{&ast.UnaryExpr{Op: token.ARROW, X: chanExpr}},
+					}
 					recvIndex++
 				default:
 					return fmt.Errorf("not supported select chan dir %d: %w", state.Dir, ErrUnsupported)
@@ -975,6 +1070,15 @@ func (fc *funcConverter) convertBlock(astFunc *AstFunc, ssaBlock *ssa.BasicBlock
 			}
 		case *ssa.MakeClosure:
 			anonFunc := instr.Fn.(*ssa.Function)
+			if methodName, ok := getBoundMethodName(anonFunc); ok {
+				recvExpr, err := fc.convertSsaValue(instr.Bindings[0])
+				if err != nil {
+					return err
+				}
+				stmt = defineVar(instr, ah.SelectExpr(recvExpr, ast.NewIdent(methodName)))
+				break
+			}
+
 			anonFuncName, err := fc.getAnonFunctionName(anonFunc)
 			if err != nil {
 				return err
@@ -1047,63 +1151,199 @@ func (fc *funcConverter) convertBlock(astFunc *AstFunc, ssaBlock *ssa.BasicBlock
 	return nil
 }
 
-func (fc *funcConverter) getAnonFuncName(idx int) string {
-	return fmt.Sprintf(fc.namePrefix+"anonFunc%d", idx)
+// deferStackCall returns the call to the ssa:deferstack builtin of a function, if any.
+func deferStackCall(ssaFunc *ssa.Function) *ssa.Call {
+	for _, block := range ssaFunc.Blocks {
+		for _, instr := range block.Instrs {
+			call, ok := instr.(*ssa.Call)
+			if !ok {
+				continue
+			}
+			if builtin, ok := call.Call.Value.(*ssa.Builtin); ok && builtin.Name() == deferStackBuiltin {
+				return call
+			}
+		}
+	}
+	return nil
 }
 
-func (fc *funcConverter) convertAnonFuncs(anonFuncs []*ssa.Function) ([]ast.Stmt, error) {
-	var stmts []ast.Stmt
+// callsYieldFunc reports whether a call passes the body of a range-over-func loop to an iterator.
+func callsYieldFunc(call ssa.CallCommon) bool {
+	for _, arg := range call.Args {
+		if closure, ok := arg.(*ssa.MakeClosure); ok && closure.Fn.(*ssa.Function).Synthetic == yieldFuncSynthetic {
+			return true
+		}
+	}
+	return false
+}
 
-	for i, anonFunc := range anonFuncs {
-		anonLit, err := fc.convertSignatureToFuncLit(anonFunc.Signature)
+// onlyOwnDefers reports whether all instructions are defer statements using a value as the defer stack
+// of the function owning it, which defers its calls directly and so does not use the stack.
+func onlyOwnDefers(value ssa.Value, instrs []ssa.Instruction) bool {
+	for _, instr := range instrs {
+		deferInstr, ok := instr.(*ssa.Defer)
+		if !ok || deferInstr.DeferStack != value || instr.Parent().Synthetic == yieldFuncSynthetic {
+			return false
+		}
+	}
+	return true
+}
+
+// deferStackPushCall returns a statement pushing a call with arguments onto a defer stack.
+// Like a defer statement, the function value and arguments are evaluated right away,
+// so they are bound to new variables in a block, which are fresh every time the block runs,
+// and the pushed function literal makes the call with them:
+//
+//	{
+//		var arg0 T0 = <receiver>
+//		var arg1 T1 = <argument>
+//		*stack = append(*stack, func() { arg0.Method(arg1) })
+//	}
+func (fc *funcConverter) deferStackPushCall(stack ast.Expr, call ssa.CallCommon) (ast.Stmt, error) {
+	bound := call.Args
+	switch call.Value.(type) {
+	case *ssa.Function, *ssa.Builtin:
+	default:
+		bound = append([]ssa.Value{call.Value}, bound...)
+	}
+
+	block := &ast.BlockStmt{}
+	remap := maps.Clone(fc.ssaValueRemap)
+	if remap == nil {
+		remap = make(map[ssa.Value]ast.Expr)
+	}
+	for i, value := range bound {
+		valueExpr, err := fc.convertSsaValue(value)
 		if err != nil {
 			return nil, err
 		}
-		anonStmts, err := fc.convertToStmts(anonFunc)
+		typeExpr, err := fc.tc.Convert(value.Type())
 		if err != nil {
 			return nil, err
 		}
-		anonLit.Body = ah.BlockStmt(anonStmts...)
+		name := ast.NewIdent(fc.namePrefix + "arg" + strconv.Itoa(i))
+		block.List = append(block.List, &ast.DeclStmt{Decl: &ast.GenDecl{
+			Tok:   token.VAR,
+			Specs: []ast.Spec{&ast.ValueSpec{Names: []*ast.Ident{name}, Type: typeExpr, Values: []ast.Expr{valueExpr}}},
+		}})
+		remap[value] = name
+	}
 
-		if len(anonFunc.FreeVars) == 0 {
-			stmts = append(stmts, &ast.AssignStmt{
-				Lhs: []ast.Expr{ast.NewIdent(fc.getAnonFuncName(i))},
-				Tok: token.DEFINE,
-				Rhs: []ast.Expr{anonLit},
-			})
-			continue
-		}
+	origRemap := fc.ssaValueRemap
+	fc.ssaValueRemap = remap
+	callExpr, err := fc.convertCall(call)
+	fc.ssaValueRemap = origRemap
+	if err != nil {
+		return nil, err
+	}
+	block.List = append(block.List, deferStackPush(stack, &ast.FuncLit{
+		Type: &ast.FuncType{Params: &ast.FieldList{}},
+		Body: ah.BlockStmt(ah.ExprStmt(callExpr)),
+	}))
+	return block, nil
+}
 
-		var closureVars []*types.Var
-		for _, freeVar := range anonFunc.FreeVars {
-			closureVars = append(closureVars, types.NewVar(token.NoPos, nil, freeVar.Name(), freeVar.Type()))
+// mayRecover reports whether a called function may call recover.
+// Only functions and closures whose bodies do not call recover are known not to,
+// as opposed to dynamic calls and wrappers such as bound method values.
+func mayRecover(value ssa.Value) bool {
+	if closure, ok := value.(*ssa.MakeClosure); ok {
+		value = closure.Fn
+	}
+	if builtin, ok := value.(*ssa.Builtin); ok {
+		return builtin.Name() == "recover"
+	}
+	fn, ok := value.(*ssa.Function)
+	if !ok || fn.Synthetic != "" || fn.Blocks == nil {
+		return true
+	}
+	for _, block := range fn.Blocks {
+		for _, instr := range block.Instrs {
+			call, ok := instr.(*ssa.Call)
+			if !ok {
+				continue
+			}
+			if builtin, ok := call.Call.Value.(*ssa.Builtin); ok && builtin.Name() == "recover" {
+				return true
+			}
 		}
+	}
+	return false
+}
+
+// flushDeferStack returns a statement deferring the calls pushed onto a defer stack, emptying it.
+func (fc *funcConverter) flushDeferStack(stack ast.Expr) ast.Stmt {
+	return ah.BlockStmt(
+		deferStackFlush(stack, fc.namePrefix+"f"),
+		ah.AssignStmt(ah.StarExpr(stack), ast.NewIdent("nil")),
+	)
+}
 
-		makeClosureType := types.NewSignatureType(nil, nil, nil, types.NewTuple(closureVars...), types.NewTuple(
-			types.NewVar(token.NoPos, nil, "", anonFunc.Signature),
-		), false)
+func (fc *funcConverter) getAnonFuncName(idx int) string {
+	return fmt.Sprintf(fc.namePrefix+"anonFunc%d", idx)
+}
 
-		makeClosureLit, err := fc.convertSignatureToFuncLit(makeClosureType)
+func (fc *funcConverter) convertAnonFuncs(anonFuncs []*ssa.Function) ([]ast.Stmt, error) {
+	var stmts []ast.Stmt
+	for i, anonFunc := range anonFuncs {
+		anonExpr, _, err := fc.convertAnonFunc(anonFunc)
 		if err != nil {
 			return nil, err
 		}
-		makeClosureLit.Body = ah.BlockStmt(&ast.ReturnStmt{Results: []ast.Expr{anonLit}})
-
 		stmts = append(stmts, &ast.AssignStmt{
 			Lhs: []ast.Expr{ast.NewIdent(fc.getAnonFuncName(i))},
 			Tok: token.DEFINE,
-			Rhs: []ast.Expr{makeClosureLit},
+			Rhs: []ast.Expr{anonExpr},
 		})
 	}
 	return stmts, nil
 }
 
-func (fc *funcConverter) convertToStmts(ssaFunc *ssa.Function) ([]ast.Stmt, error) {
-	stmts, err := fc.convertAnonFuncs(ssaFunc.AnonFuncs)
+// convertAnonFunc converts an anonymous function to a function literal, along with its type.
+// If the function has free variables, the literal instead takes them as parameters
+// and returns the function.
+func (fc *funcConverter) convertAnonFunc(anonFunc *ssa.Function) (ast.Expr, types.Type, error) {
+	// Parameters are named after the function's, as synthetic functions may not name them.
+	var params []*types.Var
+	for _, param := range anonFunc.Params {
+		params = append(params, types.NewParam(token.NoPos, nil, fc.localName(param), param.Type()))
+	}
+	anonSig := anonFunc.Signature
+	anonSig = types.NewSignatureType(nil, nil, nil, types.NewTuple(params...), anonSig.Results(), anonSig.Variadic())
+	anonLit, err := fc.convertSignatureToFuncLit(anonSig)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
+	anonStmts, err := fc.convertToStmts(anonFunc)
+	if err != nil {
+		return nil, nil, err
+	}
+	anonLit.Body = ah.BlockStmt(anonStmts...)
 
+	if len(anonFunc.FreeVars) == 0 {
+		return anonLit, anonFunc.Signature, nil
+	}
+
+	var closureVars []*types.Var
+	for _, freeVar := range anonFunc.FreeVars {
+		closureVars = append(closureVars, types.NewVar(token.NoPos, nil, fc.localName(freeVar), freeVar.Type()))
+	}
+
+	makeClosureType := types.NewSignatureType(nil, nil, nil, types.NewTuple(closureVars...), types.NewTuple(
+		types.NewVar(token.NoPos, nil, "", anonFunc.Signature),
+	), false)
+
+	makeClosureLit, err := fc.convertSignatureToFuncLit(makeClosureType)
+	if err != nil {
+		return nil, nil, err
+	}
+	makeClosureLit.Body = ah.BlockStmt(&ast.ReturnStmt{Results: []ast.Expr{anonLit}})
+	return makeClosureLit, makeClosureType, nil
+}
+
+// convertBlocks converts the blocks of a function, without declaring the variables
+// which are shared between blocks, which are collected in the result's Vars.
+func (fc *funcConverter) convertBlocks(ssaFunc *ssa.Function) (*AstFunc, error) {
 	f := &AstFunc{
 		Vars:   make(map[string]types.Type),
 		Blocks: make([]*AstBlock, len(ssaFunc.Blocks)),
@@ -1117,6 +1357,46 @@ func (fc *funcConverter) convertToStmts(ssaFunc *ssa.Function) ([]ast.Stmt, erro
 			return nil, err
 		}
 	}
+	for name, typ := range f.Vars {
+		f.Vars[name] = emulateDeferStackType(typ)
+	}
+
+	if fc.markerInstrCallback != nil {
+		for _, block := range f.Blocks {
+			var newBody []ast.Stmt
+			for _, stmt := range block.Body {
+				if stmt != nil {
+					newBody = append(newBody, stmt)
+				} else {
+					newBody = append(newBody, fc.markerInstrCallback(f.Vars)...)
+				}
+			}
+			block.Body = newBody
+		}
+	}
+	return f, nil
+}
+
+// blockStmt returns the statements of a converted block, which are labeled if the block is jumped to.
+func (fc *funcConverter) blockStmt(block *AstBlock) ast.Stmt {
+	blockStmts := &ast.BlockStmt{List: append(block.Body, block.Phi...)}
+	blockStmts.List = append(blockStmts.List, block.Exit)
+	if block.HasRefs {
+		return &ast.LabeledStmt{Label: fc.getLabelName(block.Index), Stmt: blockStmts}
+	}
+	return blockStmts
+}
+
+func (fc *funcConverter) convertToStmts(ssaFunc *ssa.Function) ([]ast.Stmt, error) {
+	stmts, err := fc.convertAnonFuncs(ssaFunc.AnonFuncs)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := fc.convertBlocks(ssaFunc)
+	if err != nil {
+		return nil, err
+	}
 
 	groupedVar := make(map[types.Type][]string)
 	for varName, varType := range f.Vars {
@@ -1156,25 +1436,7 @@ func (fc *funcConverter) convertToStmts(ssaFunc *ssa.Function) ([]ast.Stmt, erro
 	}
 
 	for _, block := range f.Blocks {
-		if fc.markerInstrCallback != nil {
-			var newBody []ast.Stmt
-			for _, stmt := range block.Body {
-				if stmt != nil {
-					newBody = append(newBody, stmt)
-				} else {
-					newBody = append(newBody, fc.markerInstrCallback(f.Vars)...)
-				}
-			}
-			block.Body = newBody
-		}
-
-		blockStmts := &ast.BlockStmt{List: append(block.Body, block.Phi...)}
-		blockStmts.List = append(blockStmts.List, block.Exit)
-		if block.HasRefs {
-			stmts = append(stmts, &ast.LabeledStmt{Label: fc.getLabelName(block.Index), Stmt: blockStmts})
-		} else {
-			stmts = append(stmts, blockStmts)
-		}
+		stmts = append(stmts, fc.blockStmt(block))
 	}
 	return stmts, nil
 }
@@ -8,6 +8,7 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/go-quicktest/qt"
@@ -86,6 +87,10 @@ func main() {
 	flowOps()
 	typeOps()
 	genericFunc()
+	selectOps()
+	thunkOps()
+	rangeFuncOps()
+	deferLoopOps()
 }
 
 func makeSprintf(tag string) func(vals ...interface{}) {
@@ -362,13 +367,282 @@ func genericFunc() {
     }
 	sprintf(sumIntsOrFloats(floats))
 }
+
+func selectOps() {
+	sprintf := makeSprintf("selectOps")
+
+	recv := make(chan int, 1)
+	send := make(chan int, 1)
+	var recvOnly <-chan int = recv
+	var sendOnly chan<- int = send
+	var nilChan chan int
+
+	// Blocking selects over channels of every direction, until all are done.
+	// Only one case is ready at a time, so that the output is deterministic.
+	recv <- 1
+	send <- 0
+	for recvOnly != nil || sendOnly != nil {
+		select {
+		case v, ok := <-recvOnly:
+			sprintf("recv", v, ok)
+			if ok {
+				close(recv)
+			} else {
+				recvOnly = nil
+				<-send
+			}
+		case sendOnly <- 2:
+			sprintf("send", <-send)
+			sendOnly = nil
+		case nilChan <- 3:
+			panic("unreachable")
+		}
+	}
+
+	// Non-blocking selects with a single case.
+	select {
+	case v := <-nilChan:
+		sprintf(v)
+	default:
+		sprintf("default recv")
+	}
+	select {
+	case send <- 4:
+		sprintf("sent", <-send)
+	default:
+		sprintf("default send")
+	}
+
+	// Discarded values and the receive of a value with a comma-ok.
+	send <- 5
+	select {
+	case _, ok := <-send:
+		sprintf("discarded", ok)
+	}
+	send <- 6
+	select {
+	case <-nilChan:
+	case v := <-send:
+		sprintf("last", v)
+	}
+}
+
+type embeddedCalls struct {
+	structCalls
+	*testStruct
+}
+
+func (s testStruct) Sum(n int) int {
+	return s.A + s.B + n
+}
+
+func (s testStruct) Print(tag string) {
+	fmt.Println(tag, s.A, s.B)
+}
+
+func thunkOps() {
+	sprintf := makeSprintf("thunkOps")
+
+	strct := structCalls{}
+	emb := embeddedCalls{testStruct: &testStruct{1, 2}}
+
+	// Method expressions, including promoted methods and value methods on pointers.
+	sprintf(embeddedCalls.Return1(emb))
+	sprintf((*embeddedCalls).Return2(&emb))
+	sprintf((*structCalls).Return1(&strct))
+	sprintf(embeddedCalls.Sum(emb, 3))
+	sprintf(interfaceCalls.Return1(strct))
+
+	// Method values, which are bound to the receiver when evaluated.
+	bound1 := strct.Return1
+	bound2 := emb.Return2
+	bound3 := emb.Sum
+	emb.testStruct = &testStruct{10, 20}
+	sprintf(bound1(), bound2(), bound3(3), emb.Sum(3))
+	var intrfs interfaceCalls = strct
+	bound4 := intrfs.Return1
+	sprintf(bound4())
+	defer sprintf("deferred method value", emb.Sum(0))
+	go strct.Return1()
+
+	// Instantiated generic functions used as values.
+	sum := sumIntsOrFloats[string, int64]
+	sprintf(sum(map[string]int64{"a": 1, "b": 2}))
+}
+
+func seqOf(n int) func(yield func(int, string) bool) {
+	return func(yield func(int, string) bool) {
+		for i := range n {
+			if !yield(i, strconv.Itoa(i*i)) {
+				return
+			}
+		}
+	}
+}
+
+func firstOver(n, limit int) (int, string) {
+	for i, s := range seqOf(n) {
+		for j := range seqOf(i) {
+			if j > 2 {
+				break
+			}
+		}
+		if len(s) > limit {
+			return i, s
+		}
+	}
+	return -1, ""
+}
+
+func rangeFuncOps() {
+	sprintf := makeSprintf("rangeFuncOps")
+
+	for i, s := range seqOf(5) {
+		if i == 1 {
+			continue
+		}
+		if i == 4 {
+			break
+		}
+		sprintf(i, s)
+	}
+	sprintf(firstOver(20, 2))
+	sprintf(firstOver(3, 2))
+
+outer:
+	for i := range seqOf(3) {
+		for j := range seqOf(3) {
+			if j == 2 {
+				continue outer
+			}
+			if i == 2 {
+				break outer
+			}
+			defer func() {
+				sprintf("deferred in range-over-func", i, j)
+			}()
+		}
+	}
+	rangeFuncPanic()
+	rangeFuncArgs()
+	rangeFuncOrder()
+	rangeFuncDeferRecoverArgs()
+	rangeFuncDeferRecover()
+}
+
+func rangeFuncPanic() {
+	sprintf := makeSprintf("rangeFuncPanic")
+
+	defer func() {
+		sprintf("recovered", recover())
+	}()
+	defer sprintf("deferred before range-over-func")
+	strct := testStruct{1, 2}
+	for i := range seqOf(3) {
+		defer func() {
+			sprintf("deferred in range-over-func", strct.Sum(i))
+		}()
+		if i == 1 {
+			panic("panic in range-over-func")
+		}
+	}
+	defer sprintf("deferred after range-over-func")
+}
+
+func recoverHelper(i int) {
+	fmt.Println("recoverHelper", i, recover())
+}
+
+// printArgs is deferred in range-over-func loops, as calls to dynamic
+// or external functions are not supported there; see rangeFuncDeferRecover.
+func printArgs(vals ...interface{}) {
+	fmt.Println(vals...)
+}
+
+func rangeFuncArgs() {
+	m := map[int]string{0: "zero", 1: "one", 2: "two"}
+	defer func() {
+		fmt.Println("rangeFuncArgs left in map", len(m), m[2])
+	}()
+	strct := testStruct{1, 2}
+	for i := range seqOf(3) {
+		j := i * 10
+		defer printArgs("rangeFuncArgs deferred with args", i, j)
+		j++
+		for k := range 2 {
+			// The arguments are bound anew every time, even within the same loop body.
+			defer printArgs("rangeFuncArgs deferred in inner loop", i, k, j)
+		}
+		defer printArgs("rangeFuncArgs sum", strct.Sum(i))
+		// The receiver is evaluated when deferring, too.
+		defer strct.Print("rangeFuncArgs receiver")
+		strct.A += 100
+		if i < 2 {
+			defer delete(m, i)
+		}
+	}
+}
+
+func rangeFuncOrder() {
+	n := 0
+	next := func() int {
+		n++
+		return n
+	}
+	for range seqOf(2) {
+		defer printArgs("rangeFuncOrder deferred", next(), next())
+		fmt.Println("rangeFuncOrder after defer", next())
+	}
+	fmt.Println("rangeFuncOrder after loop", n)
+}
+
+// Unsupported: the deferred call may recover,
+// which it could not do once it is bound to its arguments by a function literal.
+func rangeFuncDeferRecoverArgs() {
+	defer func() {
+		fmt.Println("rangeFuncDeferRecoverArgs", recover())
+	}()
+	for i := range seqOf(1) {
+		defer recoverHelper(i)
+		panic("panic in range-over-func")
+	}
+}
+
+// Unsupported: the deferred call may recover.
+// Calls to dynamic function values and to functions in other packages may recover too.
+func rangeFuncDeferRecover() {
+	defer func() {
+		fmt.Println("rangeFuncDeferRecover", recover())
+	}()
+	for range seqOf(1) {
+		defer func() {
+			fmt.Println("recovered in range-over-func", recover())
+		}()
+		panic("panic in range-over-func")
+	}
+}
+
+func deferLoopOps() (res string) {
+	sprintf := makeSprintf("deferLoopOps")
+
+	defer func() {
+		sprintf("result", res)
+	}()
+	for i := range 3 {
+		defer sprintf("deferred in loop", i)
+		defer func() {
+			res += strconv.Itoa(i)
+		}()
+	}
+	return "res:"
+}
 `
 
 func TestConvert(t *testing.T) {
 	runGoFile := func(f string) string {
 		cmd := exec.Command("go", "run", f)
 		out, err := cmd.CombinedOutput()
-		qt.Assert(t, qt.IsNil(err))
+		qt.Assert(t, qt.IsNil(err), qt.Commentf("%s", out))
 		return string(out)
 	}
 
@@ -391,6 +665,11 @@ func TestConvert(t *testing.T) {
 		ssaFunc := ssa.EnclosingFunction(ssaPkg, path)
 
 		astFunc, err := Convert(ssaFunc, DefaultConfig())
+		if strings.HasPrefix(funcDecl.Name.Name, "rangeFuncDeferRecover") {
+			// The original function is kept, so that the output stays the same.
+			qt.Assert(t, qt.ErrorIs(err, ErrUnsupported))
+			continue
+		}
 		qt.Assert(t, qt.IsNil(err))
 		file.Decls[fIdx] = astFunc
 	}
@@ -0,0 +1,343 @@
+package ssa2ast
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"go/types"
+	"slices"
+	"sort"
+	"strconv"
+
+	"golang.org/x/tools/go/ast/astutil"
+	"golang.org/x/tools/go/ssa"
+	ah "mvdan.cc/garble/internal/asthelper"
+)
+
+// Outline selects how [ConvertOutlined] splits the blocks of a function into parts.
+type Outline struct {
+	// Parts holds the indexes of the blocks moved into each part.
+	// Each block must belong to exactly one part.
+	Parts [][]int
+
+	// Keys holds a unique non-zero key for each block,
+	// used to resume the function at the block from another part.
+	Keys []int
+
+	// ContextName is the name of the struct type holding the state of a call,
+	// and PartNames holds the names of the functions for each part.
+	ContextName string
+	PartNames   []string
+}
+
+// OutlinedFunc is a function converted by [ConvertOutlined].
+type OutlinedFunc struct {
+	// Func is the converted function, which runs the parts until one of them returns.
+	Func *ast.FuncDecl
+
+	// Context declares the struct type holding the parameters, the results,
+	// and the values shared between blocks, along with the key of the next block to run.
+	Context *ast.GenDecl
+
+	// Parts are the functions holding the blocks, which take a pointer to the context.
+	Parts []*ast.FuncDecl
+
+	// Calls holds the call to each part in Func, which may be replaced
+	// as long as the part's statements run with the same context.
+	Calls []*ast.CallExpr
+}
+
+// ConvertOutlined is like [Convert], but it moves the blocks of the function
+// into separate functions, such that the size and boundaries of the original function
+// are not visible in the binary:
+//
+//	type <ContextName> struct {
+//		<params>, <shared values>, <results>
+//		k int
+//	}
+//
+//	func <name>(<params>) <results> {
+//		c := &<ContextName>{<params>, k: <entry key>}
+//		for c.k != 0 {
+//			switch c.k {
+//			case <keys of the part's entry blocks>:
+//				<part name>(c)
+//			}
+//		}
+//		return <results>
+//	}
+//
+//	func <part name>(c *<ContextName>) {
+//		switch c.k {
+//		case <key>:
+//			goto <label>
+//		}
+//		<blocks, which set c.k and return to jump to another part>
+//	}
+//
+// Generic functions and functions which use defer or recover are not supported,
+// as splitting them would change their behavior.
+func ConvertOutlined(ssaFunc *ssa.Function, cfg *ConverterConfig, outline *Outline) (*OutlinedFunc, error) {
+	return newFuncConverter(cfg).convertOutlined(ssaFunc, outline)
+}
+
+func (fc *funcConverter) convertOutlined(ssaFunc *ssa.Function, outline *Outline) (*OutlinedFunc, error) {
+	if ssaFunc.Signature.TypeParams().Len() > 0 || ssaFunc.Signature.RecvTypeParams().Len() > 0 {
+		return nil, fmt.Errorf("outlining generic function %v: %w", ssaFunc, ErrUnsupported)
+	}
+	if ssaFunc.Recover != nil {
+		return nil, fmt.Errorf("outlining function %v with defer: %w", ssaFunc, ErrUnsupported)
+	}
+	for _, block := range ssaFunc.Blocks {
+		for _, instr := range block.Instrs {
+			switch instr := instr.(type) {
+			case *ssa.Defer:
+				return nil, fmt.Errorf("outlining function %v with defer: %w", ssaFunc, ErrUnsupported)
+			case *ssa.Call:
+				if builtin, ok := instr.Call.Value.(*ssa.Builtin); ok && builtin.Name() == "recover" {
+					return nil, fmt.Errorf("outlining function %v with recover: %w", ssaFunc, ErrUnsupported)
+				}
+			}
+		}
+	}
+
+	partOf := make([]int, len(ssaFunc.Blocks))
+	for i := range partOf {
+		partOf[i] = -1
+	}
+	for part, blocks := range outline.Parts {
+		for _, idx := range blocks {
+			partOf[idx] = part
+		}
+	}
+	if slices.Contains(partOf, -1) {
+		return nil, fmt.Errorf("outlining function %v: not all blocks belong to a part", ssaFunc)
+	}
+
+	f, err := fc.convertBlocks(ssaFunc)
+	if err != nil {
+		return nil, err
+	}
+
+	ctxName := fc.namePrefix + "ctx"
+	ctxField := func(name string) ast.Expr {
+		return ah.SelectExpr(ast.NewIdent(ctxName), ast.NewIdent(name))
+	}
+	keyName := fc.namePrefix + "k"
+
+	// All the values which live across blocks are held in the context,
+	// so that each part can read and write them.
+	ctxType := &ast.StructType{Fields: &ast.FieldList{}}
+	shared := make(map[string]bool)
+	addField := func(name string, typ types.Type) error {
+		typeExpr, err := fc.tc.Convert(typ)
+		if err != nil {
+			return err
+		}
+		ctxType.Fields.List = append(ctxType.Fields.List, &ast.Field{
+			Names: []*ast.Ident{ast.NewIdent(name)},
+			Type:  typeExpr,
+		})
+		shared[name] = true
+		return nil
+	}
+
+	ctxLit := &ast.CompositeLit{Type: ast.NewIdent(outline.ContextName)}
+	var params []*types.Var
+	if recv := ssaFunc.Signature.Recv(); recv != nil {
+		params = append(params, recv)
+	}
+	for i := range ssaFunc.Signature.Params().Len() {
+		params = append(params, ssaFunc.Signature.Params().At(i))
+	}
+	for _, param := range params {
+		if name := param.Name(); name != "" && name != "_" {
+			if err := addField(name, param.Type()); err != nil {
+				return nil, err
+			}
+			ctxLit.Elts = append(ctxLit.Elts, &ast.KeyValueExpr{Key: ast.NewIdent(name), Value: ast.NewIdent(name)})
+		}
+	}
+	for i, anonFunc := range ssaFunc.AnonFuncs {
+		anonExpr, anonType, err := fc.convertAnonFunc(anonFunc)
+		if err != nil {
+			return nil, err
+		}
+		name := fc.getAnonFuncName(i)
+		if err := addField(name, anonType); err != nil {
+			return nil, err
+		}
+		ctxLit.Elts = append(ctxLit.Elts, &ast.KeyValueExpr{Key: ast.NewIdent(name), Value: anonExpr})
+	}
+	varNames := make([]string, 0, len(f.Vars))
+	for name := range f.Vars {
+		varNames = append(varNames, name)
+	}
+	sort.Strings(varNames)
+	for _, name := range varNames {
+		if err := addField(name, f.Vars[name]); err != nil {
+			return nil, err
+		}
+	}
+	results := ssaFunc.Signature.Results()
+	var resultNames []string
+	for i := range results.Len() {
+		name := fc.namePrefix + "r" + strconv.Itoa(i)
+		if err := addField(name, results.At(i).Type()); err != nil {
+			return nil, err
+		}
+		resultNames = append(resultNames, name)
+	}
+	if err := addField(keyName, types.Typ[types.Int]); err != nil {
+		return nil, err
+	}
+	ctxLit.Elts = append(ctxLit.Elts, &ast.KeyValueExpr{Key: ast.NewIdent(keyName), Value: ah.IntLit(outline.Keys[0])})
+
+	// The entry blocks of a part are those which other parts jump to.
+	// Labels are only kept for the blocks which are jumped to, as unused labels are an error.
+	entries := make([][]int, len(outline.Parts))
+	isEntry := make([]bool, len(ssaFunc.Blocks))
+	jumpedTo := make([]bool, len(ssaFunc.Blocks))
+	markEntry := func(idx int) {
+		if !isEntry[idx] {
+			isEntry[idx] = true
+			jumpedTo[idx] = true
+			entries[partOf[idx]] = append(entries[partOf[idx]], idx)
+		}
+	}
+	markEntry(0)
+	for _, block := range ssaFunc.Blocks {
+		for _, succ := range block.Succs {
+			if partOf[succ.Index] != partOf[block.Index] {
+				markEntry(succ.Index)
+			} else {
+				jumpedTo[succ.Index] = true
+			}
+		}
+	}
+	labels := make(map[string]int, len(ssaFunc.Blocks))
+	for i := range ssaFunc.Blocks {
+		labels[fc.getLabelName(i).Name] = i
+	}
+
+	out := &OutlinedFunc{
+		Context: &ast.GenDecl{
+			Tok:   token.TYPE,
+			Specs: []ast.Spec{&ast.TypeSpec{Name: ast.NewIdent(outline.ContextName), Type: ctxType}},
+		},
+	}
+
+	dispatch := &ast.SwitchStmt{Tag: ctxField(keyName), Body: &ast.BlockStmt{}}
+	for part, blocks := range outline.Parts {
+		body := &ast.BlockStmt{}
+		entrySwitch := &ast.SwitchStmt{Tag: ctxField(keyName), Body: &ast.BlockStmt{}}
+		body.List = append(body.List, entrySwitch)
+
+		// Resuming at an entry block jumps to its label.
+		var keys []ast.Expr
+		for _, idx := range entries[part] {
+			keys = append(keys, ah.IntLit(outline.Keys[idx]))
+			entrySwitch.Body.List = append(entrySwitch.Body.List, &ast.CaseClause{
+				List: []ast.Expr{ah.IntLit(outline.Keys[idx])},
+				Body: []ast.Stmt{fc.gotoStmt(idx)},
+			})
+		}
+
+		for _, idx := range blocks {
+			block := f.Blocks[idx]
+			block.HasRefs = jumpedTo[idx]
+			stmt := fc.blockStmt(block)
+
+			stmt = astutil.Apply(stmt, func(cursor *astutil.Cursor) bool {
+				switch node := cursor.Node().(type) {
+				case *ast.FuncLit:
+					// Function literals, such as polyfills, only use their own parameters.
+					return false
+				case *ast.Ident:
+					if !shared[node.Name] {
+						break
+					}
+					switch cursor.Parent().(type) {
+					case *ast.SelectorExpr:
+						if cursor.Name() == "Sel" {
+							return true
+						}
+					case *ast.KeyValueExpr:
+						if cursor.Name() == "Key" {
+							return true
+						}
+					case *ast.LabeledStmt, *ast.BranchStmt:
+						return true
+					}
+					cursor.Replace(ctxField(node.Name))
+				}
+				return true
+			}, func(cursor *astutil.Cursor) bool {
+				switch node := cursor.Node().(type) {
+				case *ast.BranchStmt:
+					target, ok := labels[node.Label.Name]
+					if node.Tok != token.GOTO || !ok || partOf[target] == part {
+						break
+					}
+					// Jumping to another part returns to the outlined function,
+					// which runs the part holding the target block.
+					cursor.Replace(ah.BlockStmt(
+						ah.AssignStmt(ctxField(keyName), ah.IntLit(outline.Keys[target])),
+						&ast.ReturnStmt{},
+					))
+				case *ast.ReturnStmt:
+					// Returning stores the results in the context,
+					// and stops the loop in the outlined function.
+					var stmts []ast.Stmt
+					if len(node.Results) > 0 {
+						assign := &ast.AssignStmt{Tok: token.ASSIGN, Rhs: node.Results}
+						for _, name := range resultNames {
+							assign.Lhs = append(assign.Lhs, ctxField(name))
+						}
+						stmts = append(stmts, assign)
+					}
+					stmts = append(stmts, ah.AssignStmt(ctxField(keyName), ah.IntLit(0)), &ast.ReturnStmt{})
+					cursor.Replace(ah.BlockStmt(stmts...))
+				}
+				return true
+			}).(ast.Stmt)
+			body.List = append(body.List, stmt)
+		}
+
+		partDecl := &ast.FuncDecl{
+			Name: ast.NewIdent(outline.PartNames[part]),
+			Type: &ast.FuncType{Params: &ast.FieldList{List: []*ast.Field{{
+				Names: []*ast.Ident{ast.NewIdent(ctxName)},
+				Type:  ah.StarExpr(ast.NewIdent(outline.ContextName)),
+			}}}},
+			Body: body,
+		}
+		call := ah.CallExpr(ast.NewIdent(outline.PartNames[part]), ast.NewIdent(ctxName))
+		out.Parts = append(out.Parts, partDecl)
+		out.Calls = append(out.Calls, call)
+		if len(keys) > 0 {
+			dispatch.Body.List = append(dispatch.Body.List, &ast.CaseClause{List: keys, Body: []ast.Stmt{ah.ExprStmt(call)}})
+		}
+	}
+
+	funcDecl, err := fc.convertSignatureToFuncDecl(ssaFunc.Name(), ssaFunc.Signature)
+	if err != nil {
+		return nil, err
+	}
+	funcDecl.Body = ah.BlockStmt(
+		ah.AssignDefineStmt(ast.NewIdent(ctxName), ah.UnaryExpr(token.AND, ctxLit)),
+		&ast.ForStmt{
+			Cond: ah.BinaryExpr(ctxField(keyName), token.NEQ, ah.IntLit(0)),
+			Body: ah.BlockStmt(dispatch),
+		},
+	)
+	if len(resultNames) > 0 {
+		ret := &ast.ReturnStmt{}
+		for _, name := range resultNames {
+			ret.Results = append(ret.Results, ctxField(name))
+		}
+		funcDecl.Body.List = append(funcDecl.Body.List, ret)
+	}
+	out.Func = funcDecl
+	return out, nil
+}
@@ -0,0 +1,94 @@
+package ssa2ast
+
+import (
+	"errors"
+	"go/ast"
+	"go/importer"
+	"go/printer"
+	"go/types"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/go-quicktest/qt"
+	"golang.org/x/tools/go/ast/astutil"
+	"golang.org/x/tools/go/ssa"
+	"golang.org/x/tools/go/ssa/ssautil"
+)
+
+func TestConvertOutlined(t *testing.T) {
+	runGoFile := func(f string) string {
+		cmd := exec.Command("go", "run", f)
+		out, err := cmd.CombinedOutput()
+		qt.Assert(t, qt.IsNil(err), qt.Commentf("%s", out))
+		return string(out)
+	}
+
+	testFile := filepath.Join(t.TempDir(), "convert.go")
+	err := os.WriteFile(testFile, []byte(mainSrc), 0o777)
+	qt.Assert(t, qt.IsNil(err))
+
+	originalOut := runGoFile(testFile)
+	file, fset, _, _ := mustParseAndTypeCheckFile(mainSrc)
+	ssaPkg, _, err := ssautil.BuildPackage(&types.Config{Importer: importer.Default()}, fset, types.NewPackage("test/main", ""), []*ast.File{file}, 0)
+	qt.Assert(t, qt.IsNil(err))
+
+	var outlinedDecls []ast.Decl
+	for fIdx, decl := range file.Decls {
+		funcDecl, ok := decl.(*ast.FuncDecl)
+		if !ok {
+			continue
+		}
+
+		path, _ := astutil.PathEnclosingInterval(file, funcDecl.Pos(), funcDecl.Pos())
+		ssaFunc := ssa.EnclosingFunction(ssaPkg, path)
+
+		// Spread the blocks over up to three parts, with keys unlike block indexes.
+		prefix := "_s2a" + strconv.Itoa(fIdx) + "_"
+		outline := &Outline{ContextName: prefix + "context"}
+		for i := range ssaFunc.Blocks {
+			part := i % 3
+			if part == len(outline.Parts) {
+				outline.Parts = append(outline.Parts, nil)
+				outline.PartNames = append(outline.PartNames, prefix+"part"+strconv.Itoa(part))
+			}
+			outline.Parts[part] = append(outline.Parts[part], i)
+			outline.Keys = append(outline.Keys, 1000+i*7)
+		}
+
+		cfg := DefaultConfig()
+		cfg.NamePrefix = prefix
+		out, err := ConvertOutlined(ssaFunc, cfg, outline)
+		if errors.Is(err, ErrUnsupported) {
+			// Functions which cannot be converted at all are kept as they are.
+			if astFunc, err := Convert(ssaFunc, DefaultConfig()); !errors.Is(err, ErrUnsupported) {
+				qt.Assert(t, qt.IsNil(err))
+				file.Decls[fIdx] = astFunc
+			}
+			continue
+		}
+		qt.Assert(t, qt.IsNil(err))
+		qt.Assert(t, qt.HasLen(out.Parts, len(outline.Parts)))
+		qt.Assert(t, qt.HasLen(out.Calls, len(outline.Parts)))
+		file.Decls[fIdx] = out.Func
+		outlinedDecls = append(outlinedDecls, out.Context)
+		for _, part := range out.Parts {
+			outlinedDecls = append(outlinedDecls, part)
+		}
+	}
+	qt.Assert(t, qt.Not(qt.HasLen(outlinedDecls, 0)))
+	file.Decls = append(file.Decls, outlinedDecls...)
+
+	convertedFile := filepath.Join(t.TempDir(), "main.go")
+	f, err := os.Create(convertedFile)
+	qt.Assert(t, qt.IsNil(err))
+	err = printer.Fprint(f, fset, file)
+	qt.Assert(t, qt.IsNil(err))
+	_ = f.Close()
+
+	convertedOut := runGoFile(convertedFile)
+
+	qt.Assert(t, qt.Equals(convertedOut, originalOut))
+}
@@ -4,6 +4,8 @@ import (
 	"go/ast"
 	"go/token"
 	"go/types"
+
+	ah "mvdan.cc/garble/internal/asthelper"
 )
 
 func makeMapIteratorPolyfill(tc *TypeConverter, mapType *types.Map) (ast.Expr, types.Type, error) {
@@ -174,3 +176,59 @@ func makeMapIteratorPolyfill(tc *TypeConverter, mapType *types.Map) (ast.Expr, t
 		},
 	}, nextType, nil
 }
+
+// Functions with range-over-func loops whose bodies contain defer statements
+// keep their deferred calls in a stack returned by the ssa:deferstack builtin,
+// as the bodies are moved to yield functions which cannot defer calls on behalf of their caller.
+// The stack is emulated by a slice of functions, which are deferred by the function owning it
+// after each range-over-func loop, or right away by the owning function's own defer statements.
+// Calls pushed by a loop which panics are deferred by a function deferred right before the loop,
+// so they are not called directly by the panic and cannot recover it.
+// Only deferred calls without arguments which cannot recover are thus supported in loop bodies.
+const (
+	deferStackBuiltin  = "ssa:deferstack"
+	deferStackTypeName = "deferStack"
+	yieldFuncSynthetic = "range-over-func yield"
+)
+
+// deferStackType is the type emulating the opaque type of a defer stack.
+func deferStackType() ast.Expr {
+	return &ast.ArrayType{Elt: &ast.FuncType{Params: &ast.FieldList{}}}
+}
+
+// emulateDeferStackType returns the type emulating typ if it is a defer stack or a pointer to one,
+// as other packages like go/types cannot handle the opaque type of defer stacks.
+func emulateDeferStackType(typ types.Type) types.Type {
+	if ptr, ok := typ.(*types.Pointer); ok {
+		if elem := emulateDeferStackType(ptr.Elem()); elem != ptr.Elem() {
+			return types.NewPointer(elem)
+		}
+		return typ
+	}
+	if typ.String() == deferStackTypeName {
+		return types.NewSlice(types.NewSignatureType(nil, nil, nil, nil, nil, false))
+	}
+	return typ
+}
+
+// deferStackFlush returns a statement deferring all calls pushed to a defer stack:
+//
+//	for _, f := range *stack {
+//		defer f()
+//	}
+func deferStackFlush(stack ast.Expr, funcName string) ast.Stmt {
+	return &ast.RangeStmt{
+		Key:   ast.NewIdent("_"),
+		Value: ast.NewIdent(funcName),
+		Tok:   token.DEFINE,
+		X:     ah.StarExpr(stack),
+		Body:  ah.BlockStmt(&ast.DeferStmt{Call: ah.CallExprByName(funcName)}),
+	}
+}
+
+// deferStackPush returns a statement pushing a function onto a defer stack:
+//
+//	*stack = append(*stack, f)
+func deferStackPush(stack, f ast.Expr) ast.Stmt {
+	return ah.AssignStmt(ah.StarExpr(stack), ah.CallExprByName("append", ah.StarExpr(stack), f))
+}
@@ -257,6 +257,9 @@ func (tc *TypeConverter) Convert(typ types.Type) (ast.Expr, error) {
 		}
 		return unionExpr, nil
 	default:
+		if typ.String() == deferStackTypeName {
+			return deferStackType(), nil
+		}
 		return nil, fmt.Errorf("type %v: %w", typ, ErrUnsupported)
 	}
 }
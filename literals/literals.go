@@ -0,0 +1,63 @@
+// Copyright (c) 2026, The Garble Authors.
+// See LICENSE for licensing information.
+
+// Package literals allows adding custom obfuscators for the literals
+// which garble obfuscates with the -literals flag.
+//
+// Since garble re-runs its own binary for each package in a build,
+// obfuscators must be registered from an init function in a package
+// which is part of the garble binary itself, such as a file added to
+// garble's main package when building it, for example via go build -overlay.
+// Registered obfuscators can then be weighted, disabled, or pinned per package
+// by name in garble.toml, just like the built-in ones.
+package literals
+
+import "mvdan.cc/garble/internal/literals"
+
+// Obfuscator takes a byte slice and converts it to a ast.BlockStmt,
+// which declares a "data" variable of type []byte holding the original bytes.
+// The statements may use the external keys by their names,
+// and the data may be modified in place.
+//
+// Obfuscators must be deterministic given the same random source,
+// so that builds are reproducible.
+type Obfuscator = literals.Obfuscator
+
+// ExternalKey is a random key passed as a parameter to the function
+// decoding a literal, so that its data is not enough to decode it.
+type ExternalKey = literals.ExternalKey
+
+// MinSize and MaxSize are the bounds for the maximum literal size
+// which an obfuscator is registered with.
+const (
+	MinSize = literals.MinSize
+	MaxSize = literals.MaxSize
+)
+
+// Cost is how expensive the code of an obfuscator is at run time.
+// When building with a PGO profile, functions on the hot path only use
+// cheap obfuscators, and cold functions only use expensive ones,
+// unless none of them support a literal's size.
+type Cost = literals.Cost
+
+const (
+	// Cheap obfuscators decode literals in time proportional to their size,
+	// such as with a single pass over the data.
+	Cheap = literals.Cheap
+
+	// Expensive obfuscators are harder to reverse, but decode literals
+	// in more time or with more code, such as one statement per byte.
+	Expensive = literals.Expensive
+)
+
+// Register adds an obfuscator which may be picked at random for literals
+// of up to maxSize bytes, relative to the weights of the other obfuscators
+// with the same cost.
+// A weight of zero means that it is only used when selected by name in garble.toml.
+//
+// Register must be called from an init function,
+// so that every garble process agrees on the registered obfuscators.
+// It panics if the name is already registered or the arguments are invalid.
+func Register(name string, obf Obfuscator, weight, maxSize int, cost Cost) {
+	literals.Register(name, obf, weight, maxSize, cost)
+}
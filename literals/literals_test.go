@@ -0,0 +1,86 @@
+// Copyright (c) 2026, The Garble Authors.
+// See LICENSE for licensing information.
+
+package literals_test
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/printer"
+	"go/token"
+	"go/types"
+	mathrand "math/rand"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/go-quicktest/qt"
+	internal "mvdan.cc/garble/internal/literals"
+	"mvdan.cc/garble/literals"
+)
+
+// xorConst is a trivial obfuscator, to test that registered ones get used.
+type xorConst struct{}
+
+func (xorConst) Obfuscate(rand *mathrand.Rand, data []byte, extKeys []*literals.ExternalKey) *ast.BlockStmt {
+	var elts []ast.Expr
+	for _, b := range data {
+		elts = append(elts, &ast.BasicLit{Kind: token.INT, Value: strconv.Itoa(int(b ^ 0x5a))})
+	}
+	return &ast.BlockStmt{List: []ast.Stmt{
+		&ast.AssignStmt{
+			Lhs: []ast.Expr{ast.NewIdent("data")},
+			Tok: token.DEFINE,
+			Rhs: []ast.Expr{&ast.CompositeLit{Type: &ast.ArrayType{Elt: ast.NewIdent("byte")}, Elts: elts}},
+		},
+		&ast.RangeStmt{
+			Key: ast.NewIdent("xorConstIndex"),
+			Tok: token.DEFINE,
+			X:   ast.NewIdent("data"),
+			Body: &ast.BlockStmt{List: []ast.Stmt{&ast.AssignStmt{
+				Lhs: []ast.Expr{&ast.IndexExpr{X: ast.NewIdent("data"), Index: ast.NewIdent("xorConstIndex")}},
+				Tok: token.XOR_ASSIGN,
+				Rhs: []ast.Expr{&ast.BasicLit{Kind: token.INT, Value: "0x5a"}},
+			}}},
+		},
+	}}
+}
+
+func TestRegister(t *testing.T) {
+	literals.Register("xor_const", xorConst{}, 0, literals.MaxSize, literals.Cheap)
+	qt.Assert(t, qt.IsTrue(slices.Contains(internal.ObfuscatorNames(), "xor_const")))
+	qt.Assert(t, qt.PanicMatches(func() {
+		literals.Register("xor_const", xorConst{}, 1, literals.MaxSize, literals.Cheap)
+	}, `literals: obfuscator "xor_const" registered twice`))
+
+	const src = `package p
+
+var s = "a secret string value"
+`
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "p.go", src, parser.SkipObjectResolution)
+	qt.Assert(t, qt.IsNil(err))
+	info := &types.Info{
+		Types: make(map[ast.Expr]types.TypeAndValue),
+		Defs:  make(map[*ast.Ident]types.Object),
+		Uses:  make(map[*ast.Ident]types.Object),
+	}
+	_, err = new(types.Config).Check("p", fset, []*ast.File{file}, info)
+	qt.Assert(t, qt.IsNil(err))
+
+	// Pin the registered obfuscator, as garble.toml would, by disabling the others.
+	weights := make(internal.ObfuscatorWeights)
+	for _, name := range internal.ObfuscatorNames() {
+		weights[name] = 0
+	}
+	weights["xor_const"] = 1
+	rand := mathrand.New(mathrand.NewSource(1))
+	file = internal.Obfuscate(rand, file, info, nil, internal.Config{Weights: weights}, func(rand *mathrand.Rand, baseName string) string {
+		return baseName
+	})
+	var out strings.Builder
+	qt.Assert(t, qt.IsNil(printer.Fprint(&out, fset, file)))
+	qt.Assert(t, qt.StringContains(out.String(), "xorConstIndex"))
+	qt.Assert(t, qt.Not(qt.StringContains(out.String(), "secret")))
+}
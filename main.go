@@ -30,7 +30,9 @@ import (
 	"strings"
 	"time"
 
+	"mvdan.cc/garble/internal/ctrlflow"
 	"mvdan.cc/garble/internal/linker"
+	"mvdan.cc/garble/internal/literals"
 )
 
 const actionGraphFileName = "action-graph.json"
@@ -103,16 +105,22 @@ var booleanFlags = map[string]bool{
 }
 
 var flagSet = flag.NewFlagSet("garble", flag.ExitOnError)
-var rxGarbleFlag = regexp.MustCompile(`-(?:literals|tiny|debug|debugdir|seed)(?:$|=)`)
+var rxGarbleFlag = regexp.MustCompile(`-(?:literals|tiny|methods|lines|mapfile|debug|debugdir|seed|controlflow|embed|cacheliterals|literalsminsize)(?:$|=)`)
 
 var (
-	flagLiterals bool
-	flagTiny     bool
-	flagDebug    bool
-	flagDebugDir string
-	flagSeed     seedFlag
-	// TODO(pagran): in the future, when control flow obfuscation will be stable migrate to flag
-	flagControlFlow = os.Getenv("GARBLE_EXPERIMENTAL_CONTROLFLOW") == "1"
+	flagLiterals      bool
+	flagCacheLiterals bool
+	flagLiteralsMin   = literalSizeFlag(literals.MinSize)
+	flagTiny          bool
+	flagMethods       bool
+	flagLines         bool
+	flagEmbed         bool
+	flagMapFile       string
+	flagDebug         bool
+	flagDebugDir      string
+	flagSeed          seedFlag
+
+	flagControlFlow controlFlowFlag
 
 	// Presumably OK to share fset across packages.
 	fset = token.NewFileSet()
@@ -123,10 +131,17 @@ var (
 func init() {
 	flagSet.Usage = usage
 	flagSet.BoolVar(&flagLiterals, "literals", false, "Obfuscate literals such as strings")
+	flagSet.BoolVar(&flagCacheLiterals, "cacheliterals", false, "Decode each literal obfuscated by -literals only once, keeping it in memory")
+	flagSet.Var(&flagLiteralsMin, "literalsminsize", "Minimum size in bytes of the literals obfuscated by -literals, using a cheaper algorithm below 8")
 	flagSet.BoolVar(&flagTiny, "tiny", false, "Optimize for binary size, losing some ability to reverse the process")
+	flagSet.BoolVar(&flagMethods, "methods", false, "Obfuscate exported methods which cannot implement any interface, analyzing the whole build")
+	flagSet.BoolVar(&flagLines, "lines", false, "Obfuscate the position of every line, so that reversed stack traces point to the exact line")
+	flagSet.BoolVar(&flagEmbed, "embed", false, "Encrypt files embedded via //go:embed, decrypting them at run time")
+	flagSet.StringVar(&flagMapFile, "mapfile", "", "Write a JSON mapping of obfuscated names and positions to a file, e.g. -mapfile=out.json")
 	flagSet.BoolVar(&flagDebug, "debug", false, "Print debug logs to stderr")
 	flagSet.StringVar(&flagDebugDir, "debugdir", "", "Write source and obfuscated trees to a directory, e.g. -debugdir=out")
 	flagSet.Var(&flagSeed, "seed", "Provide a base64-encoded seed, e.g. -seed=o9WDTZ4CN4w\nFor a random seed, provide -seed=random")
+	flagSet.Var(&flagControlFlow, "controlflow", "Obfuscate control flow: annotated, all, or auto, optionally followed by default parameters\ne.g. -controlflow='auto junk_jumps=4'")
 }
 
 func main() {
@@ -267,7 +282,10 @@ func mainErr(args []string) error {
 		if err := cmd.Run(); err != nil {
 			return err
 		}
-		return restoreDebugDirFromCache()
+		if err := restoreDebugDirFromCache(); err != nil {
+			return err
+		}
+		return writeMapFile()
 
 	case "toolexec":
 		_, tool := filepath.Split(args[0])
@@ -292,6 +310,11 @@ func mainErr(args []string) error {
 			var tf transformer
 			toolexecImportPath := os.Getenv("TOOLEXEC_IMPORTPATH")
 			tf.curPkg, _ = sharedCache.ListedPackages.get(toolexecImportPath)
+			if path, _, ok := strings.Cut(toolexecImportPath, " ["); ok && tf.curPkg == nil {
+				// A copy of a package made for a main package with a PGO profile,
+				// like "fmt [test/main]"; see [appendListedPackages].
+				tf.curPkg, _ = sharedCache.ListedPackages.get(path)
+			}
 			if tf.curPkg == nil {
 				return fmt.Errorf("TOOLEXEC_IMPORTPATH package not found in listed packages: %s", toolexecImportPath)
 			}
@@ -380,6 +403,15 @@ This command wraps "go %s". Below is its help:
 		return nil, errJustExit(1)
 	}
 
+	if os.Getenv("GARBLE_EXPERIMENTAL_CONTROLFLOW") == "1" && !flagControlFlow.enabled() {
+		fmt.Fprintln(os.Stderr, "warning: GARBLE_EXPERIMENTAL_CONTROLFLOW=1 is deprecated; use -controlflow=annotated instead")
+		flagSet.Set("controlflow", string(ctrlflow.ModeAnnotated))
+	}
+
+	if err := loadConfig(); err != nil {
+		return nil, err
+	}
+
 	execPath, err := os.Executable()
 	if err != nil {
 		return nil, err
@@ -408,6 +440,11 @@ This command wraps "go %s". Below is its help:
 	if err := appendListedPackages(args, true); err != nil {
 		return nil, err
 	}
+	if flagMethods {
+		if err := computeInterfaceMethods(); err != nil {
+			return nil, err
+		}
+	}
 
 	sharedTempDir, err = saveSharedCache()
 	if err != nil {
@@ -443,6 +480,13 @@ This command wraps "go %s". Below is its help:
 		}
 	}
 
+	if flagMapFile != "" {
+		// Like -debugdir, pass an absolute path down to the sub-processes.
+		if flagMapFile, err = filepath.Abs(flagMapFile); err != nil {
+			return nil, err
+		}
+	}
+
 	goArgs := append([]string{command}, garbleBuildFlags...)
 
 	// Pass the garble flags down to each toolexec invocation.
@@ -466,7 +510,10 @@ This command wraps "go %s". Below is its help:
 	toolexecFlag.WriteString(" toolexec")
 	goArgs = append(goArgs, toolexecFlag.String())
 
-	if flagControlFlow {
+	// The action graph lets us import indirect dependencies in the code we add,
+	// such as with control flow obfuscation, when caching literals,
+	// or when decrypting embedded files.
+	if flagControlFlow.enabled() || mayObfuscateLiterals() || flagEmbed {
 		goArgs = append(goArgs, "-debug-actiongraph", filepath.Join(sharedTempDir, actionGraphFileName))
 	}
 	if flagDebugDir != "" {
@@ -486,6 +533,12 @@ This command wraps "go %s". Below is its help:
 		goArgs = append(goArgs, "-vet=off")
 	}
 	goArgs = append(goArgs, flags...)
+	if overlay, err := linkerVariablesOverlay(sharedTempDir); err != nil {
+		return nil, err
+	} else if overlay != "" {
+		// After the user's flags, as it replaces any -overlay they gave.
+		goArgs = append(goArgs, "-overlay="+overlay)
+	}
 	goArgs = append(goArgs, args...)
 
 	return exec.Command("go", goArgs...), nil
@@ -530,6 +583,54 @@ func (f *seedFlag) Set(s string) error {
 	return nil
 }
 
+// literalSizeFlag holds the minimum size of the literals obfuscated by -literals.
+type literalSizeFlag int
+
+func (f literalSizeFlag) String() string { return strconv.Itoa(int(f)) }
+
+func (f *literalSizeFlag) Set(s string) error {
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 1 || n > literals.MaxSize {
+		return fmt.Errorf("-literalsminsize must be a number between 1 and %d; got %q", literals.MaxSize, s)
+	}
+	*f = literalSizeFlag(n)
+	return nil
+}
+
+// controlFlowFlag holds the -controlflow mode and its default parameters,
+// such as "all junk_jumps=4 flatten_hardening=xor".
+type controlFlowFlag struct {
+	mode   ctrlflow.Mode
+	params string
+}
+
+func (f controlFlowFlag) enabled() bool { return f.mode != "" }
+
+func (f controlFlowFlag) String() string {
+	if f.params == "" {
+		return string(f.mode)
+	}
+	return string(f.mode) + " " + f.params
+}
+
+func (f *controlFlowFlag) Set(s string) error {
+	mode, params, _ := strings.Cut(strings.TrimSpace(s), " ")
+	switch m := ctrlflow.Mode(mode); m {
+	case ctrlflow.ModeAnnotated, ctrlflow.ModeAll, ctrlflow.ModeAuto:
+		f.mode = m
+	default:
+		return fmt.Errorf("-controlflow mode must be annotated, all, or auto; got %q", mode)
+	}
+	if strings.ContainsAny(params, `"'`) {
+		return fmt.Errorf("-controlflow parameters cannot contain quotes")
+	}
+	if err := ctrlflow.CheckParams(params); err != nil {
+		return fmt.Errorf("-controlflow: %v", err)
+	}
+	f.params = strings.Join(strings.Fields(params), " ")
+	return nil
+}
+
 func goVersionOK() bool {
 	const (
 		minGoVersion  = "go1.26.0" // the minimum Go version we support; could be a bugfix release if needed
@@ -607,6 +708,8 @@ garble accepts the following flags before a command:
 	flagSet.PrintDefaults()
 	fmt.Fprint(os.Stderr, `
 
+These can also be set in a garble.toml file next to go.mod.
+
 For more information, see https://github.com/burrowers/garble.
 `[1:])
 }
@@ -729,6 +832,24 @@ func flagSetValue(flags []string, name, value string) []string {
 	return append(flags, name+"="+value)
 }
 
+// flagDeleteAll removes all the values for a flag such as "-foo",
+// in both the "-foo=bar" and "-foo" "bar" forms.
+func flagDeleteAll(flags []string, name string) []string {
+	var kept []string
+	for i := 0; i < len(flags); i++ {
+		arg := flags[i]
+		if strings.HasPrefix(arg, name+"=") {
+			continue // -name=value
+		}
+		if arg == name {
+			i++ // -name value
+			continue
+		}
+		kept = append(kept, arg)
+	}
+	return kept
+}
+
 func fetchGoEnv() error {
 	out, err := exec.Command("go", "env", "-json",
 		// Keep in sync with [sharedCacheType.GoEnv].
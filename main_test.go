@@ -4,6 +4,7 @@
 package main
 
 import (
+	"embed"
 	"flag"
 	"fmt"
 	"go/ast"
@@ -18,6 +19,7 @@ import (
 	"runtime"
 	"strings"
 	"testing"
+	"testing/fstest"
 	"time"
 
 	"github.com/go-quicktest/qt"
@@ -279,9 +281,9 @@ func generateLiterals(ts *testscript.TestScript, neg bool, args []string) {
 
 	var statements []ast.Stmt
 
-	// 100 literals up to MaxSize, all containing uniqueLitString.
+	// 100 literals up to MaxSizeUnchunked, all containing uniqueLitString.
 	for range 100 {
-		randSize := testRand.Intn(literals.MaxSize - len(uniqueLitString) + 1)
+		randSize := testRand.Intn(literals.MaxSizeUnchunked - len(uniqueLitString) + 1)
 		buffer := make([]byte, randSize)
 		testRand.Read(buffer)
 		statements = append(
@@ -294,9 +296,10 @@ func generateLiterals(ts *testscript.TestScript, neg bool, args []string) {
 		)
 	}
 
-	// 5 huge literals past MaxSize, without uniqueLitString; not obfuscated.
+	// 5 large literals past MaxSizeUnchunked, all containing uniqueLitString;
+	// obfuscated in chunks.
 	for range 5 {
-		size := literals.MaxSize + 1 + testRand.Intn(128<<10)
+		size := literals.MaxSizeUnchunked + 1 + testRand.Intn(128<<10)
 		buffer := make([]byte, size)
 		testRand.Read(buffer)
 		statements = append(
@@ -304,11 +307,23 @@ func generateLiterals(ts *testscript.TestScript, neg bool, args []string) {
 			&ast.AssignStmt{
 				Lhs: []ast.Expr{ast.NewIdent("x")},
 				Tok: token.ADD_ASSIGN,
-				Rhs: []ast.Expr{ah.StringLit(string(buffer))},
+				Rhs: []ast.Expr{ah.StringLit(string(buffer) + uniqueLitString)},
 			},
 		)
 	}
 
+	// A huge literal past MaxSize, without uniqueLitString; not obfuscated.
+	buffer := make([]byte, literals.MaxSize+1)
+	testRand.Read(buffer)
+	statements = append(
+		statements,
+		&ast.AssignStmt{
+			Lhs: []ast.Expr{ast.NewIdent("x")},
+			Tok: token.ADD_ASSIGN,
+			Rhs: []ast.Expr{ah.StringLit(string(buffer))},
+		},
+	)
+
 	// An `init` function which includes all assignments from above
 	initFunc := &ast.FuncDecl{
 		Name: &ast.Ident{
@@ -495,3 +510,170 @@ func TestFlagValue(t *testing.T) {
 		})
 	}
 }
+
+func TestFlagDeleteAll(t *testing.T) {
+	t.Parallel()
+	flags := []string{"-X=a.b=c", "-o", "out", "-X", "d.e=-f", "-Xfoo", "-X="}
+	got := flagDeleteAll(flags, "-X")
+	qt.Assert(t, qt.DeepEquals(got, []string{"-o", "out", "-Xfoo"}))
+}
+
+func TestMatchGarblePatterns(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		globs string
+		path  string
+		want  bool
+	}{
+		{"*", "foo.com/bar", true},
+		{"foo.com", "foo.com/bar", true},
+		{"foo.com", "other.com/bar", false},
+		{"*,!foo.com/bar", "foo.com/bar", false},
+		{"*,!foo.com/bar", "foo.com/bar/sub", false},
+		{"*,!foo.com/bar", "foo.com/barbaz", true},
+		{"*,!foo.com/bar", "other.com", true},
+		{"foo.com,!foo.com/*/internal", "foo.com/bar/internal", false},
+		{"foo.com,!foo.com/*/internal", "foo.com/bar/public", true},
+		{"!foo.com", "foo.com/bar", false},
+		{"!foo.com", "other.com", true},
+		{"", "foo.com", false},
+	}
+	for _, test := range tests {
+		got := matchGarblePatterns(test.globs, test.path)
+		qt.Assert(t, qt.Equals(got, test.want), qt.Commentf("%q in %q", test.path, test.globs))
+	}
+}
+
+func TestEncryptNamePairs(t *testing.T) {
+	t.Parallel()
+	pairs := []string{"Q3kD1Ge", "Foo", "bT9x", "unexportedField", "*xZ.Aa8", "*pkg.Name"}
+	size := 0
+	for _, name := range pairs {
+		size += len(name) + 1
+	}
+	for _, key := range []uint64{1, 0xdeadbeefcafe} {
+		data := encryptNamePairs(pairs, key)
+		for _, name := range pairs {
+			qt.Assert(t, qt.IsFalse(strings.Contains(string(data), name)))
+		}
+		// The key is not stored along with the data.
+		qt.Assert(t, qt.HasLen(data, size))
+		qt.Assert(t, qt.DeepEquals(_decryptNamePairs(string(data), key), pairs))
+		qt.Assert(t, qt.Not(qt.DeepEquals(_decryptNamePairs(string(data), key+2), pairs)))
+	}
+	qt.Assert(t, qt.IsNil(_decryptNamePairs("", 1)))
+}
+
+//go:embed testdata/mod
+var testEmbedFS embed.FS
+
+func TestEmbedFS(t *testing.T) {
+	t.Parallel()
+	const name = "testdata/mod/rsc.io_quote_v1.5.2.txt"
+	want, err := testEmbedFS.ReadFile(name)
+	qt.Assert(t, qt.IsNil(err))
+	for _, key := range []uint64{0, 1, 0xdeadbeefcafe} {
+		// Decrypting is the same as encrypting, so we can go both ways.
+		fsys := &_embedFS{fsys: testEmbedFS, key: key}
+		_, err := fsys.ReadDir("testdata/mod")
+		qt.Assert(t, qt.IsNil(err))
+		qt.Assert(t, qt.HasLen(fsys.files, 0)) // nothing is decrypted yet
+
+		got, err := fsys.ReadFile(name)
+		qt.Assert(t, qt.IsNil(err))
+		qt.Assert(t, qt.HasLen(got, len(want)))
+		qt.Assert(t, qt.Not(qt.DeepEquals(got, want)))
+		qt.Assert(t, qt.DeepEquals(_decryptEmbed(string(got), _embedState(name, key)), want))
+		qt.Assert(t, qt.HasLen(fsys.files, 1))
+
+		// Opened files must read the same contents as ReadFile.
+		qt.Assert(t, qt.IsNil(fstest.TestFS(fsys, name)))
+
+		// The original embed.FS is left untouched.
+		got, err = testEmbedFS.ReadFile(name)
+		qt.Assert(t, qt.IsNil(err))
+		qt.Assert(t, qt.DeepEquals(got, want))
+	}
+	_, err = (&_embedFS{key: 1}).ReadFile(name)
+	qt.Assert(t, qt.ErrorIs(err, fs.ErrNotExist))
+}
+
+func TestMapFileReplaces(t *testing.T) {
+	t.Parallel()
+	// Obfuscated names can be prefixes of one another,
+	// including across packages.
+	path := filepath.Join(t.TempDir(), "mapping.json")
+	err := os.WriteFile(path, []byte(`{
+		"test/main/foo": {"path": "xAb", "names": {"Ab": "Short", "AbC": "Long"}},
+		"test/main/bar": {"path": "yCd", "fields": {"AbCd": "Longest"}, "files": {"Ab.go": "bar.go"}}
+	}`), 0o666)
+	qt.Assert(t, qt.IsNil(err))
+
+	want, err := mapFileReplaces(path)
+	qt.Assert(t, qt.IsNil(err))
+	for i := 2; i < len(want); i += 2 {
+		qt.Assert(t, qt.IsTrue(len(want[i-2]) >= len(want[i])), qt.Commentf("%q before %q", want[i-2], want[i]))
+	}
+	for range 10 {
+		got, err := mapFileReplaces(path)
+		qt.Assert(t, qt.IsNil(err))
+		qt.Assert(t, qt.DeepEquals(got, want))
+	}
+	repl := strings.NewReplacer(want...)
+	qt.Assert(t, qt.Equals(repl.Replace("Ab AbC AbCd Ab.go xAb"), "Short Long Longest bar.go test/main/foo"))
+}
+
+func TestDecodeConfig(t *testing.T) {
+	t.Parallel()
+	yes, no := true, false
+	cfg, err := decodeConfig(`
+# A comment.
+literals = false
+literalsminsize = 1_000
+seed = "o9WDTZ4CN4w" # a trailing comment
+gogarble = '*,!example.com/#public'
+reflect = ["example.com/a.T",
+	"example.com/b.\"U\"",
+]
+
+[obfuscators]
+split = 0
+seed = 2
+
+[packages."example.com/hotpath"]
+literals = true
+obfuscators = []
+`)
+	qt.Assert(t, qt.IsNil(err))
+	qt.Assert(t, qt.DeepEquals(cfg, projectConfig{
+		Literals:        &no,
+		LiteralsMinSize: 1000,
+		Seed:            "o9WDTZ4CN4w",
+		GOGARBLE:        "*,!example.com/#public",
+		Reflect:         []string{"example.com/a.T", `example.com/b."U"`},
+		Obfuscators:     map[string]int{"split": 0, "seed": 2},
+		Packages: map[string]packageConfig{
+			"example.com/hotpath": {Literals: &yes},
+		},
+	}))
+
+	for _, test := range []struct {
+		data    string
+		wantErr string
+	}{
+		{"literal = true", `garble.toml:1: unknown setting "literal"`},
+		{"literals = 1", `garble.toml:1: literals: expected a boolean: 1`},
+		{"\nseed = o9WD", `garble.toml:2: seed: expected a string: o9WD`},
+		{"reflect = [\"a.T\" \"b.T\"]", `garble.toml:1: reflect: expected an array of strings: .*`},
+		{"tiny = true\ntiny = false", `garble.toml:2: duplicate setting "tiny"`},
+		{"a.b = 1", `garble.toml:1: unknown setting "a.b"`},
+		{"[other]", `garble.toml:1: unknown table other`},
+		{"[packages.\"foo\"", `garble.toml:1: invalid table header: .*`},
+		{"[obfuscators]\nsplit = many", `garble.toml:2: obfuscators.split: expected an integer: many`},
+		{"[packages.foo]\ntiny = true", `garble.toml:2: unknown setting "packages.foo.tiny"`},
+		{"literals", `garble.toml:1: expected key = value: literals`},
+	} {
+		_, err := decodeConfig(test.data)
+		qt.Check(t, qt.ErrorMatches(err, test.wantErr), qt.Commentf("%q", test.data))
+	}
+}
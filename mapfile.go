@@ -0,0 +1,235 @@
+// Copyright (c) 2026, The Garble Authors.
+// See LICENSE for licensing information.
+
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"go/types"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"github.com/rogpeppe/go-internal/cache"
+)
+
+// mapFile is the JSON mapping written by -mapfile, keyed by original import path.
+// Unlike "garble map", it is keyed by obfuscated names, as it is meant to
+// reverse obfuscated output such as stack traces without the original source.
+type mapFile map[string]*mapFilePackage
+
+// mapFilePackage describes how a single package was obfuscated during a build.
+type mapFilePackage struct {
+	// Path is the obfuscated import path of the package.
+	Path string `json:"path"`
+
+	// Names maps obfuscated names to their original names,
+	// such as the package name, types, functions, methods, and variables.
+	Names map[string]string `json:"names,omitempty"`
+
+	// Fields maps obfuscated struct field names to their original names.
+	// Note that fields are hashed with their parent struct via [hashWithStruct],
+	// so they may belong to a struct declared in another package.
+	Fields map[string]string `json:"fields,omitempty"`
+
+	// Positions maps obfuscated Go filenames, which always use line 1,
+	// to the original positions of the call sites they replace.
+	Positions map[string]mapFilePosition `json:"positions,omitempty"`
+
+	// Files maps obfuscated assembly filenames to their original names.
+	Files map[string]string `json:"files,omitempty"`
+}
+
+// mapFilePosition is an original position in a package's Go source.
+type mapFilePosition struct {
+	File string `json:"file"` // the file's base name
+	Line int    `json:"line"`
+}
+
+func newMapFilePackage(lpkg *listedPackage) *mapFilePackage {
+	mp := &mapFilePackage{
+		Path:      lpkg.obfuscatedImportPath(),
+		Names:     make(map[string]string),
+		Fields:    make(map[string]string),
+		Positions: make(map[string]mapFilePosition),
+		Files:     make(map[string]string),
+	}
+	if name := lpkg.obfuscatedPackageName(); name != lpkg.Name {
+		mp.Names[name] = lpkg.Name
+	}
+	for _, name := range lpkg.SFiles {
+		mp.Files[hashWithPackage(lpkg, name)+".s"] = name
+	}
+	return mp
+}
+
+// recordName records an object which was obfuscated from name to newName.
+func (mp *mapFilePackage) recordName(obj types.Object, name, newName string) {
+	if mp == nil {
+		return
+	}
+	if v, ok := obj.(*types.Var); ok && v.IsField() {
+		mp.Fields[newName] = name
+	} else {
+		mp.Names[newName] = name
+	}
+}
+
+// recordPosition records an obfuscated Go filename replacing a call site.
+func (mp *mapFilePackage) recordPosition(newName, file string, line int) {
+	if mp == nil {
+		return
+	}
+	mp.Positions[newName] = mapFilePosition{File: file, Line: line}
+}
+
+func mapFileCacheID(garbleActionID [sha256.Size]byte) [sha256.Size]byte {
+	hasher := sha256.New()
+	hasher.Write(garbleActionID[:])
+	hasher.Write([]byte("\x00mapfile-cache-v1\x00"))
+	var sum [sha256.Size]byte
+	hasher.Sum(sum[:0])
+	return sum
+}
+
+// saveMapFileForPkg stores a package's mapping in the cache, so that the top-level
+// garble process can write the entire mapping even when a package build is cached.
+func saveMapFileForPkg(lpkg *listedPackage, mp *mapFilePackage) error {
+	if mp == nil {
+		return nil
+	}
+	fsCache, err := openCache()
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(mp)
+	if err != nil {
+		return err
+	}
+	return fsCache.PutBytes(mapFileCacheID(lpkg.GarbleActionID), data)
+}
+
+func loadMapFileForPkg(fsCache *cache.Cache, lpkg *listedPackage) (*mapFilePackage, error) {
+	filename, _, err := fsCache.GetFile(mapFileCacheID(lpkg.GarbleActionID))
+	if err != nil {
+		return nil, nil // cache miss is expected
+	}
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	mp := new(mapFilePackage)
+	if err := json.Unmarshal(data, mp); err != nil {
+		return nil, err
+	}
+	return mp, nil
+}
+
+// builtObfuscatedPackages returns the obfuscated packages which are part of the build.
+// Note that ListedPackages may also include packages which are not built at all,
+// such as those in runtimeAndLinknamed which are not imported by any package,
+// or packages replaced by their test variants in "go test".
+// The top-level packages are the ones which no other listed package imports.
+func builtObfuscatedPackages() []*listedPackage {
+	listed := sharedCache.ListedPackages.all()
+	imported := make(map[string]bool)
+	for _, lpkg := range listed {
+		for _, path := range lpkg.Imports {
+			if path2 := lpkg.ImportMap[path]; path2 != "" {
+				path = path2
+			}
+			imported[path] = true
+		}
+		if lpkg.ForTest != "" {
+			imported[lpkg.ForTest] = true
+		}
+	}
+	built := make(map[string]bool)
+	var walk func(path string)
+	walk = func(path string) {
+		lpkg, ok := listed[path]
+		if !ok || built[path] {
+			return
+		}
+		built[path] = true
+		for _, path := range lpkg.Imports {
+			if path2 := lpkg.ImportMap[path]; path2 != "" {
+				path = path2
+			}
+			walk(path)
+		}
+	}
+	for path := range listed {
+		if !imported[path] && !runtimeAndLinknamed[path] {
+			walk(path)
+		}
+	}
+	var pkgs []*listedPackage
+	for _, path := range slices.Sorted(maps.Keys(built)) {
+		lpkg := listed[path]
+		if lpkg.ToObfuscate && len(lpkg.CompiledGoFiles) > 0 {
+			pkgs = append(pkgs, lpkg)
+		}
+	}
+	return pkgs
+}
+
+// computeMapFileForPkg regenerates a package's mapping from its original source,
+// for when the cache lacks it even though the package build is cached.
+// Could happen if GARBLE_CACHE was emptied but GOCACHE was not.
+// Only names and positions are recorded, so we don't need to obfuscate literals
+// nor control flow, which only add code without original names or positions.
+func computeMapFileForPkg(lpkg *listedPackage) (*mapFilePackage, error) {
+	tf, files, err := transformerForListedPackage(lpkg)
+	if err != nil {
+		return nil, err
+	}
+	tf.mapping = newMapFilePackage(lpkg)
+	for _, file := range files {
+		file = tf.transformNames(file)
+		if _, err := printFile(lpkg, file, tf.mapping); err != nil {
+			return nil, err
+		}
+	}
+	if err := saveMapFileForPkg(lpkg, tf.mapping); err != nil {
+		return nil, err
+	}
+	return tf.mapping, nil
+}
+
+// writeMapFile writes the -mapfile JSON once the build has finished,
+// joining the mappings which every compiled package stored in the cache.
+func writeMapFile() error {
+	if flagMapFile == "" {
+		return nil
+	}
+	fsCache, err := openCache()
+	if err != nil {
+		return err
+	}
+	mf := make(mapFile)
+	for _, lpkg := range builtObfuscatedPackages() {
+		mp, err := loadMapFileForPkg(fsCache, lpkg)
+		if err != nil {
+			return err
+		}
+		if mp == nil {
+			if mp, err = computeMapFileForPkg(lpkg); err != nil {
+				return fmt.Errorf("-mapfile: %s: %w", lpkg.ImportPath, err)
+			}
+		}
+		mf[lpkg.ImportPath] = mp
+	}
+	data, err := json.MarshalIndent(mf, "", "\t")
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+	if err := os.MkdirAll(filepath.Dir(flagMapFile), 0o777); err != nil {
+		return err
+	}
+	return os.WriteFile(flagMapFile, data, 0o666)
+}
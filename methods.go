@@ -0,0 +1,182 @@
+// Copyright (c) 2026, The Garble Authors.
+// See LICENSE for licensing information.
+
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"log"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+)
+
+// computeInterfaceMethods fills [sharedCacheType.InterfaceMethods] when
+// -methods is set, by looking at every package in the build.
+//
+// An exported method can only be called without its declaring package knowing
+// the callee in two ways: via an interface with a method of the same name, or
+// via reflection. We collect the method names of every interface type in the
+// program syntactically, including anonymous ones in function bodies such as
+// those used in type assertions, which do not appear in export data.
+// Any other exported method name can be obfuscated consistently across
+// packages, just like unexported methods are.
+//
+// Reflection can list methods via reflect.Type.Method, whose names we restore
+// at run time via [reflectInspector], but it can also look them up by name
+// via MethodByName, which binary searches the methods sorted by their
+// obfuscated names. MethodByName can only find the methods of the types whose
+// values reach it, so we keep the exported methods of the packages which can
+// reach a package using MethodByName; see [methodByNamePackages].
+//
+// The result affects how every package is obfuscated, so the action IDs are
+// recomputed to account for it.
+func computeInterfaceMethods() error {
+	startTime := time.Now()
+	names := make(map[string]bool)
+	methodByName := []byte(".MethodByName(")
+	var byName []string
+	for path, lpkg := range sharedCache.ListedPackages.all() {
+		for _, goFile := range lpkg.CompiledGoFiles {
+			if !filepath.IsAbs(goFile) {
+				goFile = filepath.Join(lpkg.Dir, goFile)
+			}
+			src, err := os.ReadFile(goFile)
+			if err != nil {
+				return err
+			}
+			// The reflect package itself implements MethodByName.
+			if path != "reflect" && !slices.Contains(byName, path) && bytes.Contains(src, methodByName) {
+				byName = append(byName, path)
+			}
+			// Parsing every file in the build is not cheap; most files
+			// do not declare any interface types at all.
+			if !bytes.Contains(src, []byte("interface")) {
+				continue
+			}
+			file, err := parser.ParseFile(token.NewFileSet(), goFile, src, parser.SkipObjectResolution)
+			if err != nil {
+				return err
+			}
+			for node := range ast.Preorder(file) {
+				iface, ok := node.(*ast.InterfaceType)
+				if !ok {
+					continue
+				}
+				for _, field := range iface.Methods.List {
+					// Embedded interfaces and type set terms have no names;
+					// embedded interfaces are declared elsewhere in the build.
+					for _, name := range field.Names {
+						names[name.Name] = true
+					}
+				}
+			}
+		}
+	}
+	sharedCache.InterfaceMethods = names
+	sharedCache.MethodByNamePackages = methodByNamePackages(byName)
+	for _, path := range slices.Sorted(maps.Keys(sharedCache.MethodByNamePackages)) {
+		log.Printf("not obfuscating exported methods in %s as MethodByName may reach them", path)
+	}
+
+	// Hash the sorted names and packages, so that the build cache is invalidated
+	// whenever an interface method or a use of MethodByName appears or disappears.
+	h := sha256.New()
+	for _, name := range slices.Sorted(maps.Keys(names)) {
+		h.Write([]byte(name))
+		h.Write([]byte{0})
+	}
+	h.Write([]byte{0})
+	for _, path := range slices.Sorted(maps.Keys(sharedCache.MethodByNamePackages)) {
+		h.Write([]byte(path))
+		h.Write([]byte{0})
+	}
+	sharedCache.InterfaceMethodsHash = h.Sum(nil)
+	for _, lpkg := range sharedCache.ListedPackages.all() {
+		if lpkg.BuildID != "" {
+			var err error
+			if lpkg.GarbleActionID, err = garbleActionID(lpkg); err != nil {
+				return err
+			}
+		}
+	}
+	log.Printf("collected %d interface method names in %s", len(names), debugSince(startTime))
+	return nil
+}
+
+// methodByNameForwarders are the packages which pass the values given by their
+// importers on to MethodByName in another package,
+// such as html/template executing templates via text/template.
+var methodByNameForwarders = map[string]bool{
+	"html/template": true,
+}
+
+// methodByNamePackages returns the packages whose types may reach MethodByName
+// as used in the byName packages.
+//
+// A package using MethodByName can reach the types of its dependencies,
+// as well as those of the packages importing it, which can pass their own values
+// as well as their dependencies' values. We don't track values further up the
+// import graph, unless the importer is one of [methodByNameForwarders].
+// For example, a program importing net/rpc still uses text/template
+// via html/template, but net/rpc does not pass the program's values to it.
+func methodByNamePackages(byName []string) map[string]bool {
+	listed := sharedCache.ListedPackages.all()
+	importers := make(map[string][]*listedPackage)
+	for _, lpkg := range listed {
+		for _, path := range lpkg.Imports {
+			if path2 := lpkg.ImportMap[path]; path2 != "" {
+				path = path2
+			}
+			importers[path] = append(importers[path], lpkg)
+		}
+	}
+	reaching := make(map[*listedPackage]bool)
+	expanded := make(map[string]bool)
+	var expand func(path string)
+	expand = func(path string) {
+		lpkg, ok := listed[path]
+		if !ok || expanded[path] {
+			return
+		}
+		expanded[path] = true
+		reaching[lpkg] = true
+		for _, importer := range importers[path] {
+			if methodByNameForwarders[importer.ImportPath] {
+				expand(importer.ImportPath)
+			} else {
+				reaching[importer] = true
+			}
+		}
+	}
+	for _, path := range byName {
+		expand(path)
+	}
+
+	pkgs := make(map[string]bool)
+	for path, lpkg := range listed {
+		if !lpkg.ToObfuscate {
+			continue // its methods are not obfuscated anyway
+		}
+		for reach := range reaching {
+			if reach.ImportPath == path || reach.hasDep(path) {
+				pkgs[path] = true
+				break
+			}
+		}
+	}
+	return pkgs
+}
+
+// obfuscatesExportedMethod reports whether an exported method name declared in
+// the package with the given path is obfuscated.
+// Methods which might implement an interface or be found by MethodByName never are.
+func obfuscatesExportedMethod(pkgPath, name string) bool {
+	return flagMethods && !sharedCache.MethodByNamePackages[pkgPath] && !sharedCache.InterfaceMethods[name]
+}
@@ -12,13 +12,16 @@ import (
 	"go/token"
 	"path/filepath"
 	"strings"
+
+	ah "mvdan.cc/garble/internal/asthelper"
 )
 
 var printBuf1, printBuf2 bytes.Buffer
 
 // printFile prints a Go file to a buffer, while also removing non-directive
 // comments and adding extra compiler directives to obfuscate position information.
-func printFile(lpkg *listedPackage, file *ast.File) ([]byte, error) {
+// The obfuscated positions are recorded in mapping, if it is not nil.
+func printFile(lpkg *listedPackage, file *ast.File, mapping *mapFilePackage) ([]byte, error) {
 	if lpkg.ToObfuscate {
 		// Omit comments from the final Go code.
 		// Keep directives, as they affect the build.
@@ -69,17 +72,63 @@ func printFile(lpkg *listedPackage, file *ast.File) ([]byte, error) {
 	// We want to use the original positions for the hashed positions.
 	// Since later we'll iterate on tokens rather than walking an AST,
 	// we use a list of offsets indexed by identifiers in source order.
-	var origCallOffsets []int
+	//
+	// With -lines, we also record the original line of each identifier
+	// which is the first on its line, or zero otherwise.
+	// The same applies to identifiers in declarations with //garble:noposition,
+	// which keep their original positions.
+	var origCallOffsets, origLines []int
+	var noPositions []bool
+	var noPosEnd token.Pos
+	if ah.HasDirective(file.Doc, directiveNoPosition) {
+		noPosEnd = file.End()
+	}
+	lines := obfuscatesLines(lpkg)
 	nextOffset := -1
+	lastLine := 0
+	lastNoPos := false
 	for node := range ast.Preorder(file) {
+		var doc *ast.CommentGroup
 		switch node := node.(type) {
+		case *ast.FuncDecl:
+			doc = node.Doc
+		case *ast.GenDecl:
+			doc = node.Doc
+		case *ast.TypeSpec:
+			doc = node.Doc
+		case *ast.ValueSpec:
+			doc = node.Doc
+		case *ast.Field:
+			doc = node.Doc
 		case *ast.CallExpr:
 			nextOffset = fsetFile.Position(node.Pos()).Offset
 		case *ast.Ident:
 			origCallOffsets = append(origCallOffsets, nextOffset)
 			nextOffset = -1
+
+			// Identifiers added by garble may lack a position,
+			// or point to a position in another file.
+			// Those take after the identifiers before them.
+			valid := node.Pos().IsValid() && fset.File(node.Pos()) == fsetFile
+			noPos := lastNoPos
+			if valid {
+				noPos = node.Pos() < noPosEnd
+			}
+			line := 0
+			if (lines || noPos) && valid {
+				if l := fsetFile.Line(node.Pos()); l != lastLine || noPos != lastNoPos {
+					line, lastLine = l, l
+				}
+			}
+			origLines = append(origLines, line)
+			noPositions = append(noPositions, noPos)
+			lastNoPos = noPos
+		}
+		if ah.HasDirective(doc, directiveNoPosition) {
+			noPosEnd = max(noPosEnd, node.End())
 		}
 	}
+	origFile := fsetFile
 
 	copied := 0
 	printBuf2.Reset()
@@ -99,8 +148,14 @@ func printFile(lpkg *listedPackage, file *ast.File) ([]byte, error) {
 	s.Init(fsetFile, src, nil, scanner.ScanComments)
 
 	identIndex := 0
+	// lineStart is the offset of the first token on the current line.
+	lineStart, lastLine := 0, 0
+	lastNoPos = false
 	for {
 		pos, tok, lit := s.Scan()
+		if line := fsetFile.Line(pos); tok != token.EOF && line != lastLine {
+			lineStart, lastLine = fsetFile.Offset(pos), line
+		}
 		switch tok {
 		case token.EOF:
 			// Copy the rest and return.
@@ -119,7 +174,45 @@ func printFile(lpkg *listedPackage, file *ast.File) ([]byte, error) {
 			copied = offset + len(lit)
 		case token.IDENT:
 			origOffset := origCallOffsets[identIndex]
+			origLine := origLines[identIndex]
+			noPos := noPositions[identIndex]
 			identIndex++
+			if noPos {
+				if origLine > 0 {
+					// Use the original filename, which the compiler
+					// rewrites via -trimpath just like any other.
+					offset := max(lineStart, copied)
+					printBuf2.Write(src[copied:offset])
+					copied = offset
+					fmt.Fprintf(&printBuf2, " /*line %s:%d*/ ", origFile.Name(), origLine)
+				}
+				lastNoPos = true
+				continue
+			}
+			if lastNoPos && (origLine == 0 || flagTiny) {
+				// Stop using the original positions from the previous declaration.
+				offset := max(lineStart, copied)
+				printBuf2.Write(src[copied:offset])
+				copied = offset
+				fmt.Fprintf(&printBuf2, " /*line %s:1*/ ", newPrefix)
+			}
+			lastNoPos = false
+			if origLine > 0 && !flagTiny {
+				// With -lines, position the entire line with its original line,
+				// so that any statement on it reverses to an accurate position.
+				// Hash the line rather than an offset, since the identifier
+				// may have been added by garble, such as with -literals.
+				// The comment goes before the line's first token,
+				// unless we already copied past it when removing a comment.
+				origPos := fmt.Sprintf("%s:line%d", filename, origLine)
+				newName := hashWithPackage(lpkg, origPos) + ".go"
+				mapping.recordPosition(newName, filename, origLine)
+
+				offset := max(lineStart, copied)
+				printBuf2.Write(src[copied:offset])
+				copied = offset
+				fmt.Fprintf(&printBuf2, " /*line %s%s:1*/ ", newPrefix, newName)
+			}
 			if origOffset == -1 {
 				continue // identifiers which don't start func calls are left untouched
 			}
@@ -127,6 +220,7 @@ func printFile(lpkg *listedPackage, file *ast.File) ([]byte, error) {
 			if !flagTiny {
 				origPos := fmt.Sprintf("%s:%d", filename, origOffset)
 				newName = hashWithPackage(lpkg, origPos) + ".go"
+				mapping.recordPosition(newName, filename, origFile.Line(origFile.Pos(origOffset)))
 				// log.Printf("%q hashed with %x to %q", origPos, curPkg.GarbleActionID, newName)
 			}
 
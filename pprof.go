@@ -0,0 +1,257 @@
+// Copyright (c) 2026, The Garble Authors.
+// See LICENSE for licensing information.
+
+package main
+
+import (
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// gzipMagic starts every gzip stream. pprof profiles as written by runtime/pprof
+// are always gzip-compressed protocol buffers, so "garble reverse" uses it to
+// tell them apart from text.
+var gzipMagic = []byte{0x1f, 0x8b}
+
+// Field numbers from github.com/google/pprof/proto/profile.proto.
+// We only decode the few messages we need to rewrite; the rest is copied as-is.
+const (
+	profileLocation    = 4
+	profileFunction    = 5
+	profileStringTable = 6
+
+	locationLine = 4
+
+	lineFunctionID = 1
+	lineLine       = 2
+
+	functionID        = 1
+	functionFilename  = 4
+	functionStartLine = 5
+)
+
+// protoField is a single field of an encoded protocol buffer message.
+// Varints are decoded into num; length-delimited fields keep their bytes in data.
+type protoField struct {
+	number   uint64
+	wireType uint64
+	num      uint64
+	data     []byte
+}
+
+// Protocol buffer wire types; pprof profiles do not use the deprecated groups.
+const (
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+	wireFixed32 = 5
+)
+
+var errBadProto = errors.New("malformed protocol buffer")
+
+func parseProto(b []byte) ([]protoField, error) {
+	var fields []protoField
+	for len(b) > 0 {
+		key, n := binary.Uvarint(b)
+		if n <= 0 {
+			return nil, errBadProto
+		}
+		b = b[n:]
+		f := protoField{number: key >> 3, wireType: key & 7}
+		switch f.wireType {
+		case wireVarint:
+			f.num, n = binary.Uvarint(b)
+			if n <= 0 {
+				return nil, errBadProto
+			}
+			b = b[n:]
+		case wireFixed64, wireFixed32:
+			size := 8
+			if f.wireType == wireFixed32 {
+				size = 4
+			}
+			if len(b) < size {
+				return nil, errBadProto
+			}
+			f.data, b = b[:size], b[size:]
+		case wireBytes:
+			size, n := binary.Uvarint(b)
+			if n <= 0 || uint64(len(b)-n) < size {
+				return nil, errBadProto
+			}
+			b = b[n:]
+			f.data, b = b[:size], b[size:]
+		default:
+			return nil, errBadProto
+		}
+		fields = append(fields, f)
+	}
+	return fields, nil
+}
+
+func appendProto(b []byte, fields []protoField) []byte {
+	for _, f := range fields {
+		b = binary.AppendUvarint(b, f.number<<3|f.wireType)
+		switch f.wireType {
+		case wireVarint:
+			b = binary.AppendUvarint(b, f.num)
+		case wireBytes:
+			b = binary.AppendUvarint(b, uint64(len(f.data)))
+			b = append(b, f.data...)
+		default:
+			b = append(b, f.data...)
+		}
+	}
+	return b
+}
+
+// reverseProfile reverses a gzip-compressed pprof profile read from r,
+// writing the result to w in the same format.
+//
+// Function names and filenames are reversed in the profile's string table,
+// using the same replacements as text. Since obfuscated positions always use
+// line 1 of a hashed filename, line numbers are reversed by replacing
+// "filename:line" and taking the resulting line, much like reversing text.
+func reverseProfile(w io.Writer, r io.Reader, repl *strings.Replacer) (bool, error) {
+	zr, err := gzip.NewReader(r)
+	if err != nil {
+		return false, err
+	}
+	data, err := io.ReadAll(zr)
+	if err != nil {
+		return false, err
+	}
+	fields, err := parseProto(data)
+	if err != nil {
+		return false, fmt.Errorf("cannot decode pprof profile: %v", err)
+	}
+
+	// The string table and functions may appear in any order,
+	// so collect them before rewriting any locations.
+	var strs []string
+	funcFiles := make(map[uint64]uint64) // function ID to filename string index
+	for _, f := range fields {
+		switch f.number {
+		case profileStringTable:
+			strs = append(strs, string(f.data))
+		case profileFunction:
+			fn, err := parseProto(f.data)
+			if err != nil {
+				return false, fmt.Errorf("cannot decode pprof profile: %v", err)
+			}
+			var id, file uint64
+			for _, f := range fn {
+				switch f.number {
+				case functionID:
+					id = f.num
+				case functionFilename:
+					file = f.num
+				}
+			}
+			funcFiles[id] = file
+		}
+	}
+	if len(strs) == 0 || strs[0] != "" {
+		return false, fmt.Errorf("cannot decode pprof profile: invalid string table")
+	}
+
+	modified := false
+	// reverseLine reverses a line number for a filename string index.
+	reverseLine := func(file, line uint64) uint64 {
+		if file >= uint64(len(strs)) {
+			return line
+		}
+		pos := fmt.Sprintf("%s:%d", strs[file], line)
+		newPos := repl.Replace(pos)
+		if newPos == pos {
+			return line
+		}
+		newLine, ok := positionLine(newPos)
+		if !ok {
+			return line
+		}
+		modified = true
+		return newLine
+	}
+
+	for i, f := range fields {
+		switch f.number {
+		case profileFunction:
+			fn, _ := parseProto(f.data)
+			var file uint64
+			for _, f := range fn {
+				if f.number == functionFilename {
+					file = f.num
+				}
+			}
+			for j, f := range fn {
+				if f.number == functionStartLine {
+					fn[j].num = reverseLine(file, f.num)
+				}
+			}
+			fields[i].data = appendProto(nil, fn)
+		case profileLocation:
+			loc, err := parseProto(f.data)
+			if err != nil {
+				return false, fmt.Errorf("cannot decode pprof profile: %v", err)
+			}
+			for j, f := range loc {
+				if f.number != locationLine {
+					continue
+				}
+				line, err := parseProto(f.data)
+				if err != nil {
+					return false, fmt.Errorf("cannot decode pprof profile: %v", err)
+				}
+				var funcID uint64
+				for _, f := range line {
+					if f.number == lineFunctionID {
+						funcID = f.num
+					}
+				}
+				for k, f := range line {
+					if f.number == lineLine {
+						line[k].num = reverseLine(funcFiles[funcID], f.num)
+					}
+				}
+				loc[j].data = appendProto(nil, line)
+			}
+			fields[i].data = appendProto(nil, loc)
+		}
+	}
+
+	// Reverse the strings last, as line numbers need the obfuscated filenames.
+	strIndex := 0
+	for i, f := range fields {
+		if f.number != profileStringTable {
+			continue
+		}
+		s := strs[strIndex]
+		strIndex++
+		if newStr := repl.Replace(s); newStr != s {
+			fields[i].data = []byte(newStr)
+			modified = true
+		}
+	}
+
+	zw := gzip.NewWriter(w)
+	if _, err := zw.Write(appendProto(nil, fields)); err != nil {
+		return modified, err
+	}
+	return modified, zw.Close()
+}
+
+// positionLine returns the line number from a "filename:line" position.
+func positionLine(pos string) (uint64, bool) {
+	i := strings.LastIndexByte(pos, ':')
+	if i < 0 {
+		return 0, false
+	}
+	line, err := strconv.ParseUint(pos[i+1:], 10, 64)
+	return line, err == nil
+}
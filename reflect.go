@@ -3,7 +3,10 @@ package main
 import (
 	"bytes"
 	_ "embed"
+	"encoding/binary"
 	"fmt"
+	"go/ast"
+	"go/token"
 	"go/types"
 	"log"
 	"maps"
@@ -49,7 +52,7 @@ func init() { _originalNamesInit() }
 // We split this into pre/post steps so that all variable names in the generated code
 // can be properly obfuscated - if we added the filled map directly, the obfuscated names
 // would appear as plain strings in the binary.
-func reflectMainPrePatch(path string) (string, error) {
+func reflectMainPrePatch(path string, lpkg *listedPackage) (string, error) {
 	if reflectPatchFile != "" {
 		// already patched another file in main
 		return "", nil
@@ -63,24 +66,75 @@ func reflectMainPrePatch(path string) (string, error) {
 	code = strings.ReplaceAll(code, "//disabledgo:", "//go:")
 	// This constant is declared in our hash.go file.
 	code = strings.ReplaceAll(code, "minHashLength", strconv.Itoa(minHashLength))
+	// The key is declared in reflect_abi_code.go, outside the injected code.
+	code = strings.ReplaceAll(code, "_originalNamePairsKey", fmt.Sprintf("%#x", namePairsKey(lpkg)))
 	return string(content) + code, nil
 }
 
+// reflectInjectedPos returns the position where the code added by
+// reflectMainPrePatch begins, or token.NoPos if files has none.
+func reflectInjectedPos(files []*ast.File) token.Pos {
+	for _, file := range files {
+		for _, decl := range file.Decls {
+			decl, ok := decl.(*ast.GenDecl)
+			if !ok || decl.Tok != token.VAR {
+				continue
+			}
+			if spec := decl.Specs[0].(*ast.ValueSpec); spec.Names[0].Name == "_originalNamePairsData" {
+				return decl.Pos()
+			}
+		}
+	}
+	return token.NoPos
+}
+
 // reflectMainPostPatch populates the name mapping with the final obfuscated->real name
 // mappings after all packages have been analyzed.
+// The mapping is encrypted, so that it can't be used as a dictionary to reverse
+// obfuscated names; see [encryptNamePairs].
 func reflectMainPostPatch(file []byte, lpkg *listedPackage, pkg pkgCache) []byte {
-	obfVarName := hashWithPackage(lpkg, "_originalNamePairs")
-	namePairs := fmt.Appendf(nil, "%s = []string{", obfVarName)
+	obfVarName := hashWithPackage(lpkg, "_originalNamePairsData")
+	namePairs := fmt.Appendf(nil, "%s = \"\"", obfVarName)
 
 	keys := slices.Sorted(maps.Keys(pkg.ReflectObjectNames))
-	namePairsFilled := bytes.Clone(namePairs)
+	if len(keys) == 0 {
+		return file
+	}
+	pairs := make([]string, 0, len(keys)*2)
 	for _, obf := range keys {
-		namePairsFilled = fmt.Appendf(namePairsFilled, "%q, %q,", obf, pkg.ReflectObjectNames[obf])
+		pairs = append(pairs, obf, pkg.ReflectObjectNames[obf])
 	}
-
+	namePairsFilled := fmt.Appendf(nil, "%s = %q", obfVarName, encryptNamePairs(pairs, namePairsKey(lpkg)))
 	return bytes.Replace(file, namePairs, namePairsFilled, 1)
 }
 
+// namePairsKey returns the key to encrypt the name mapping of a main package.
+// The key is deterministic, like the rest of the obfuscation,
+// and it changes with the package's build inputs, including the seed.
+// It is injected into the code by [reflectMainPrePatch], rather than stored with the data,
+// so that -literals obfuscates it like any other number.
+func namePairsKey(lpkg *listedPackage) uint64 {
+	return binary.BigEndian.Uint64(lpkg.GarbleActionID[:8]) | 1 // xorshift gets stuck at zero
+}
+
+// encryptNamePairs encodes name pairs for _decryptNamePairs in reflect_abi_code.go,
+// given a non-zero key.
+// Note that a xorshift keystream only hides the names from static analysis,
+// as the key must be included in the binary to decrypt them at run time.
+func encryptNamePairs(pairs []string, key uint64) []byte {
+	var data []byte
+	state := key
+	for _, name := range pairs {
+		for _, b := range append([]byte(name), 0) {
+			state ^= state << 13
+			state ^= state >> 7
+			state ^= state << 17
+			data = append(data, b^byte(state))
+		}
+	}
+	return data
+}
+
 type reflectInspector struct {
 	lpkg *listedPackage
 	pkg  *types.Package
@@ -134,6 +188,19 @@ func (ri *reflectInspector) ignoreReflectedTypes(ssaPkg *ssa.Package) {
 		ri.recursivelyRecordUsedForReflect(scope.Lookup("Value").Type())
 	}
 
+	// Types listed in garble.toml are used via reflection in ways we cannot detect.
+	for _, hint := range sharedCache.ReflectHints {
+		i := strings.LastIndexByte(hint, '.')
+		if hint[:i] != ri.pkg.Path() {
+			continue
+		}
+		if obj, ok := ri.pkg.Scope().Lookup(hint[i+1:]).(*types.TypeName); ok {
+			ri.recursivelyRecordUsedForReflect(obj.Type())
+		} else {
+			log.Printf("reflect hint %q does not name a type", hint)
+		}
+	}
+
 	for _, memb := range ssaPkg.Members {
 		switch x := memb.(type) {
 		case *ssa.Type:
@@ -507,7 +574,8 @@ func relatedParam(val ssa.Value, visited map[ssa.Value]bool) *ssa.Parameter {
 // recursivelyRecordUsedForReflect calls recordUsedForReflect on any named
 // types and fields under typ.
 //
-// Named types and fields reachable via reflection are recorded.
+// Named types, their obfuscated exported methods, and fields reachable via
+// reflection are recorded.
 // Foreign named types use the declaring package's hash salt, while fields use
 // [hashWithStruct], which is consistent across packages.
 func (ri *reflectInspector) recursivelyRecordUsedForReflect(t types.Type) {
@@ -533,6 +601,12 @@ func (ri *reflectInspector) recursivelyRecordUsedForReflectImpl(t types.Type, vi
 			return // prevent endless recursion
 		}
 		ri.recordUsedForReflect(obj, nil)
+		// Exported method names can be listed via reflection with -methods.
+		for method := range t.Origin().Methods() {
+			if method.Exported() && obfuscatesExportedMethod(method.Pkg().Path(), method.Name()) {
+				ri.recordUsedForReflect(method, nil)
+			}
+		}
 		// Match [computeFieldToStruct]: use the generic/origin struct, not an
 		// instantiated underlying, so field identities line up with [hashWithStruct].
 		ri.recursivelyRecordUsedForReflectImpl(t.Origin().Underlying(), visited)
@@ -579,7 +653,7 @@ func (ri *reflectInspector) obfuscatedObjectName(obj types.Object, parent *types
 }
 
 // recordUsedForReflect records the objects whose names we cannot obfuscate due to reflection.
-// We currently record named types and fields.
+// We currently record named types, methods, and fields.
 func (ri *reflectInspector) recordUsedForReflect(obj types.Object, parent *types.Struct) {
 	obfName := ri.obfuscatedObjectName(obj, parent)
 	if obfName == "" {
@@ -19,17 +19,44 @@ package main
 // The linknames below are only turned on when the code is injected,
 // so that we can test and benchmark this code normally.
 
+// _originalNamePairsKey is replaced with the key of _originalNamePairsData
+// when the code is injected; see reflectMainPrePatch.
+var _originalNamePairsKey uint64
+
 // Injected code below this line.
 
 // Each pair is the obfuscated and then the real name.
 // The pairs are sorted by obfuscated name, lexicographically.
-var _originalNamePairs = []string{}
+// Each name is followed by a zero byte, and the data is encrypted
+// so that it does not act as a dictionary; see _decryptNamePairs.
+// The key is part of the code instead, where -literals obfuscates it.
+var _originalNamePairsData = ""
 
 var _originalNamesReplacer *_genericReplacer
 
 //disabledgo:linkname _originalNamesInit internal/abi._originalNamesInit
 func _originalNamesInit() {
-	_originalNamesReplacer = _makeGenericReplacer(_originalNamePairs)
+	_originalNamesReplacer = _makeGenericReplacer(_decryptNamePairs(_originalNamePairsData, _originalNamePairsKey))
+}
+
+// _decryptNamePairs decrypts data as encrypted by encryptNamePairs,
+// by XORing it with a xorshift keystream seeded with a non-zero key.
+func _decryptNamePairs(data string, state uint64) []string {
+	var pairs []string
+	name := make([]byte, 0, 64)
+	for i := range len(data) {
+		state ^= state << 13
+		state ^= state >> 7
+		state ^= state << 17
+		b := data[i] ^ byte(state)
+		if b == 0 {
+			pairs = append(pairs, string(name))
+			name = name[:0]
+			continue
+		}
+		name = append(name, b)
+	}
+	return pairs
 }
 
 //disabledgo:linkname _originalNames internal/abi._originalNames
@@ -5,18 +5,22 @@ package main
 
 import (
 	"bufio"
+	"bytes"
+	"cmp"
+	"encoding/json"
 	"fmt"
 	"go/ast"
 	"go/types"
 	"io"
 	"os"
+	"slices"
 	"strings"
 )
 
 // commandReverse implements "garble reverse".
 func commandReverse(args []string) error {
 	flags, args := splitFlagsFromArgs(args)
-	if hasHelpFlag(flags) || len(args) == 0 {
+	if hasHelpFlag(flags) || (len(args) == 0 && flagMapFile == "") {
 		fmt.Fprint(os.Stderr, `
 usage: garble [garble flags] reverse [build flags] package [files]
 
@@ -27,21 +31,53 @@ For example, after building an obfuscated program as follows:
 One can reverse a captured panic stack trace as follows:
 
 	garble -literals reverse -tags=mytag ./cmd/mycmd panic-output.txt
+
+Gzip-compressed pprof profiles are reversed too, written as profiles:
+
+	garble -literals reverse -tags=mytag ./cmd/mycmd cpu.pb.gz >cpu-reversed.pb.gz
+
+If the build used -mapfile, one can instead reverse without the source code,
+the build flags, or a package argument:
+
+	garble -mapfile=mapping.json reverse panic-output.txt
 `[1:])
 		return errJustExit(2)
 	}
 
-	pkg, args := args[0], args[1:]
+	var replaces []string
+	if flagMapFile != "" {
+		if len(flags) > 0 {
+			return fmt.Errorf("build flags are not needed with -mapfile: %s", strings.Join(flags, " "))
+		}
+		var err error
+		if replaces, err = mapFileReplaces(flagMapFile); err != nil {
+			return err
+		}
+	} else {
+		pkg := args[0]
+		args = args[1:]
+		var err error
+		if replaces, err = sourceReplaces(flags, pkg); err != nil {
+			return err
+		}
+	}
+	return reverseFiles(args, strings.NewReplacer(replaces...))
+}
+
+// sourceReplaces returns the replacer pairs to reverse the obfuscation of pkg
+// and its dependencies, by loading and type-checking their original source code
+// with the given build flags.
+func sourceReplaces(flags []string, pkg string) ([]string, error) {
 	// We don't actually run `go list -toolexec=garble`; we only use toolexecCmd
 	// to ensure that sharedCache.ListedPackages is filled.
 	_, err := toolexecCmd("list", append(flags, pkg))
 	defer os.RemoveAll(os.Getenv("GARBLE_SHARED"))
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	if err := rejectUnknownBuildFlags(flags); err != nil {
-		return err
+		return nil, err
 	}
 
 	// A package's names are generally hashed with the action ID of its
@@ -50,7 +86,6 @@ One can reverse a captured panic stack trace as follows:
 	// export data only exposes exported names. Parsing Go files is cheap,
 	// so it's unnecessary to try to avoid this cost.
 	var replaces []string
-
 	for _, lpkg := range sharedCache.ListedPackages.all() {
 		if !lpkg.ToObfuscate {
 			continue
@@ -72,10 +107,26 @@ One can reverse a captured panic stack trace as follows:
 
 		tf, files, err := transformerForListedPackage(lpkg)
 		if err != nil {
-			return err
+			return nil, err
 		}
+		lines := obfuscatesLines(lpkg)
 		for i, file := range files {
 			goFile := lpkg.CompiledGoFiles[i]
+			if lines {
+				// Positions of entire lines are hashed by line number,
+				// mirroring printFile.
+				for line := 1; line <= fset.File(file.Pos()).LineCount(); line++ {
+					newFilename := hashWithPackage(lpkg, fmt.Sprintf("%s:line%d", goFile, line)) + ".go"
+					replaces = append(replaces,
+						newFilename+":1",
+						fmt.Sprintf("%s/%s:%d", lpkg.ImportPath, goFile, line),
+					)
+					replaces = append(replaces,
+						newFilename,
+						fmt.Sprintf("%s/%s", lpkg.ImportPath, goFile),
+					)
+				}
+			}
 			for node := range ast.Preorder(file) {
 				switch node := node.(type) {
 
@@ -125,8 +176,69 @@ One can reverse a captured panic stack trace as follows:
 			}
 		}
 	}
-	repl := strings.NewReplacer(replaces...)
+	return replaces, nil
+}
+
+// mapFileReplaces returns the replacer pairs to reverse the obfuscation
+// recorded in a mapping file written by -mapfile.
+func mapFileReplaces(path string) ([]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var mf mapFile
+	if err := json.Unmarshal(data, &mf); err != nil {
+		return nil, fmt.Errorf("cannot decode mapping file: %v", err)
+	}
+	// Map iteration is random, and [strings.NewReplacer] tries its old strings
+	// in argument order, so sort the pairs to be deterministic.
+	// Longer keys go first, so that a key is never shadowed by its prefix.
+	var pairs [][2]string
+	for importPath, mp := range mf {
+		// Main packages keep "main" as their path.
+		if mp.Path != importPath && mp.Path != "main" {
+			pairs = append(pairs, [2]string{mp.Path, importPath})
+		}
+		for newName, name := range mp.Names {
+			pairs = append(pairs, [2]string{newName, name})
+		}
+		for newName, name := range mp.Fields {
+			pairs = append(pairs, [2]string{newName, name})
+		}
+		for newName, name := range mp.Files {
+			pairs = append(pairs, [2]string{newName, name})
+		}
+		// Mirror the call site positions as done by sourceReplaces.
+		for newFilename, pos := range mp.Positions {
+			pairs = append(pairs, [2]string{
+				newFilename + ":1",
+				fmt.Sprintf("%s/%s:%d", importPath, pos.File, pos.Line),
+			})
+			pairs = append(pairs, [2]string{
+				newFilename,
+				fmt.Sprintf("%s/%s", importPath, pos.File),
+			})
+		}
+	}
+	slices.SortFunc(pairs, func(a, b [2]string) int {
+		if c := cmp.Compare(len(b[0]), len(a[0])); c != 0 {
+			return c
+		}
+		if c := strings.Compare(a[0], b[0]); c != 0 {
+			return c
+		}
+		return strings.Compare(a[1], b[1])
+	})
+	replaces := make([]string, 0, len(pairs)*2)
+	for _, pair := range pairs {
+		replaces = append(replaces, pair[0], pair[1])
+	}
+	return replaces, nil
+}
 
+// reverseFiles reverses the given files, or standard input if there are none,
+// writing the result to standard output.
+func reverseFiles(args []string, repl *strings.Replacer) error {
 	if len(args) == 0 {
 		modified, err := reverseContent(os.Stdout, os.Stdin, repl)
 		if err != nil {
@@ -158,6 +270,8 @@ One can reverse a captured panic stack trace as follows:
 	return nil
 }
 
+// reverseContent reverses text read from r line by line, writing it to w.
+// A gzip-compressed pprof profile is reversed via [reverseProfile] instead.
 func reverseContent(w io.Writer, r io.Reader, repl *strings.Replacer) (bool, error) {
 	// Read line by line.
 	// Reading the entire content at once wouldn't be interactive,
@@ -166,6 +280,9 @@ func reverseContent(w io.Writer, r io.Reader, repl *strings.Replacer) (bool, err
 	// We use bufio.Reader instead of bufio.Scanner,
 	// to also obtain the newline characters themselves.
 	br := bufio.NewReader(r)
+	if magic, _ := br.Peek(len(gzipMagic)); bytes.Equal(magic, gzipMagic) {
+		return reverseProfile(w, br, repl)
+	}
 	modified := false
 	for {
 		// Note that ReadString can return a line as well as an error if
@@ -10,6 +10,8 @@
 // that size. For each obfuscator, it measures:
 //   - Build time: time to "garble -literals build" versus "go build"
 //   - Run time: time to execute the resulting binary (strings are decrypted at init)
+//   - Binary size: with the same number of string uses, either all distinct
+//     or each repeated numRepeats times, which garble only obfuscates once per package
 //
 // The garble binary is built with the garble_testing tag to allow forcing a
 // specific obfuscator via GARBLE_TEST_LITERALS_OBFUSCATOR_MAP.
@@ -29,6 +31,10 @@
 // Or, if you obtained all results but want to show just one:
 //
 //	benchstat -col /obf -filter '/obf:(go OR swap)' out
+//
+// To see how much smaller repeated strings make the binaries, compare the sizes with:
+//
+//	benchstat -col /strings -filter '.name:Size' results.txt
 package main
 
 import (
@@ -63,20 +69,29 @@ var (
 	runFilter = flag.String("run", "", "regexp to filter which obfuscators to run (always includes go baseline)")
 )
 
-// obfuscatorNames maps index to name, matching internal/literals/obfuscators.go.
+// obfuscatorNames maps index to name, matching the registry in internal/literals/registry.go.
 var obfuscatorNames = []string{
 	"simple",
 	"swap",
 	"split",
 	"shuffle",
 	"seed",
+	"chunked",
 }
 
-// stringSizes to benchmark, from just above MinSize (8) to the maxSize limit (2048).
+// stringSizes to benchmark, from just above MinSize (8) to well past MaxSizeUnchunked (2048).
+// Larger strings always use the chunked obfuscator, whichever one is forced.
 var stringSizes = []int{
-	16, 64, 256, 1024, 2048,
+	16, 64, 256, 1024, 2048, 16384, 131072,
 }
 
+// sizeStringSizes are the string sizes for the binary size benchmarks,
+// which use numRepeats times as many strings.
+var sizeStringSizes = []int{16, 64, 256}
+
+// stringKinds are the layouts of the strings in the binary size benchmarks.
+var stringKinds = []string{"distinct", "repeated"}
+
 func main() {
 	flag.Parse()
 
@@ -104,6 +119,15 @@ func main() {
 		writeTestModule(dir, size)
 		sizeDirs[size] = dir
 	}
+	sizeBenchDirs := make(map[string]string)
+	for _, kind := range stringKinds {
+		for _, size := range sizeStringSizes {
+			dir := filepath.Join(tmpDir, fmt.Sprintf("%s_%d", kind, size))
+			must(os.MkdirAll(dir, 0o755))
+			writeSizeTestModule(dir, size, kind == "repeated")
+			sizeBenchDirs[fmt.Sprintf("%s_%d", kind, size)] = dir
+		}
+	}
 
 	// Warm the garble cache by building one program.
 	// Garble caches transformed stdlib, so the first build is much slower.
@@ -121,6 +145,12 @@ func main() {
 		bin := filepath.Join(tmpDir, fmt.Sprintf("go_%d_bin", size))
 		benchRunAndPrint("Run/obf=go", size, bin)
 	}
+	for _, kind := range stringKinds {
+		for _, size := range sizeStringSizes {
+			bin := filepath.Join(tmpDir, fmt.Sprintf("go_%s_%d_bin", kind, size))
+			benchSizeAndPrint("Size/obf=go/strings="+kind, size, sizeBenchDirs[fmt.Sprintf("%s_%d", kind, size)], nil, bin, "go", "build")
+		}
+	}
 
 	var filterRe *regexp.Regexp
 	if *runFilter != "" {
@@ -146,6 +176,12 @@ func main() {
 			bin := filepath.Join(tmpDir, fmt.Sprintf("garble_%s_%d_bin", name, size))
 			benchRunAndPrint("Run/obf="+name, size, bin)
 		}
+		for _, kind := range stringKinds {
+			for _, size := range sizeStringSizes {
+				bin := filepath.Join(tmpDir, fmt.Sprintf("garble_%s_%s_%d_bin", name, kind, size))
+				benchSizeAndPrint("Size/obf="+name+"/strings="+kind, size, sizeBenchDirs[fmt.Sprintf("%s_%d", kind, size)], env, bin, garbleBin, "-literals", "build")
+			}
+		}
 	}
 }
 
@@ -193,6 +229,22 @@ func benchRunAndPrint(benchName string, size int, bin string) {
 	}
 }
 
+// benchSizeAndPrint builds the binary once, printing one benchstat line with its size.
+// Builds are deterministic, so there is no need to repeat them.
+func benchSizeAndPrint(benchName string, size int, dir string, extraEnv []string, bin string, args ...string) {
+	name := fmt.Sprintf("Benchmark%s/%dB", benchName, size)
+	args = append(args, "-o", bin, ".")
+	if _, ok := runCmdWithTimeout(dir, extraEnv, args[0], args[1:]...); !ok {
+		fmt.Fprintf(os.Stderr, "    ^ timed out: %s %s\n", args[0], strings.Join(args[1:], " "))
+		return
+	}
+	info, err := os.Stat(bin)
+	if err != nil {
+		fatal("stat: %v", err)
+	}
+	fmt.Printf("%s 1 %d B\n", name, info.Size())
+}
+
 // runCmdWithTimeout runs the command with the configured timeout.
 // It returns the elapsed time and true on success, or zero and false on timeout.
 // The command is started in its own process group so that on timeout,
@@ -271,6 +323,33 @@ func writeTestModule(dir string, stringSize int) {
 	must(os.WriteFile(filepath.Join(dir, "main.go"), []byte(b.String()), 0o644))
 }
 
+// numRepeats is the number of times each string is used in the binary size benchmarks.
+const numRepeats = 10
+
+// writeSizeTestModule writes a program with numStrings*numRepeats uses of strings.
+// With repeated, only numStrings of them are distinct.
+func writeSizeTestModule(dir string, stringSize int, repeated bool) {
+	goMod := "module test/bench\n\ngo 1.26\n"
+	must(os.WriteFile(filepath.Join(dir, "go.mod"), []byte(goMod), 0o644))
+
+	var b strings.Builder
+	b.WriteString("package main\n\nimport \"os\"\n\nfunc main() {\n")
+	b.WriteString("\tf, _ := os.Create(os.DevNull)\n")
+	for range numStrings {
+		str := randomHex(stringSize)
+		for range numRepeats {
+			if !repeated {
+				str = randomHex(stringSize)
+			}
+			fmt.Fprintf(&b, "\tf.WriteString(%q)\n", str)
+		}
+	}
+	b.WriteString("\tf.Close()\n")
+	b.WriteString("}\n")
+
+	must(os.WriteFile(filepath.Join(dir, "main.go"), []byte(b.String()), 0o644))
+}
+
 func randomHex(n int) string {
 	raw := make([]byte, (n+1)/2)
 	rng.Read(raw)
@@ -13,6 +13,7 @@ import (
 	"go/token"
 	"go/types"
 	"io/fs"
+	"iter"
 	"log"
 	"maps"
 	mathrand "math/rand"
@@ -26,8 +27,10 @@ import (
 
 	"golang.org/x/tools/go/ast/astutil"
 	"golang.org/x/tools/go/ssa"
+	ah "mvdan.cc/garble/internal/asthelper"
 	"mvdan.cc/garble/internal/ctrlflow"
 	"mvdan.cc/garble/internal/literals"
+	"mvdan.cc/garble/internal/pgo"
 )
 
 // cmd/bundle will include a go:generate directive in its output by default.
@@ -36,52 +39,168 @@ import (
 //go:generate go tool bundle -o cmdgo_quoted.go -prefix cmdgoQuoted cmd/internal/quoted
 //go:generate sed -i /go:generate/d cmdgo_quoted.go
 
+// linkerVariable is a string variable set via the linker's -X flag,
+// given in the form of "foo.com/bar.name=value".
+type linkerVariable struct {
+	path  string // "foo.com/bar", or "main" for the main package being linked
+	name  string
+	value string
+}
+
+// linkerVariables iterates over the values of the linker's -X flags,
+// skipping any invalid ones just like cmd/link does.
+func linkerVariables(ldflags []string) iter.Seq[linkerVariable] {
+	return func(yield func(linkerVariable) bool) {
+		for val := range flagValues(ldflags, "-X") {
+			fullName, value, found := strings.Cut(val, "=")
+			if !found {
+				continue // invalid
+			}
+			i := strings.LastIndexByte(fullName, '.')
+			if i < 0 {
+				continue // invalid
+			}
+			if !yield(linkerVariable{fullName[:i], fullName[i+1:], value}) {
+				return
+			}
+		}
+	}
+}
+
+// inPackage reports whether a variable set via -X belongs to a package.
+// Note that package main always has import path "main" as part of a build,
+// and that test variants like "foo [foo.test]" are still "foo" to the linker.
+func (v linkerVariable) inPackage(importPath, name string) bool {
+	path, _, _ := strings.Cut(importPath, " [")
+	return v.path == path || (v.path == "main" && name == "main")
+}
+
+// buildLdflags returns the -ldflags build flag, split into arguments.
+func buildLdflags() ([]string, error) {
+	return cmdgoQuotedSplit(flagValue(sharedCache.ForwardBuildFlags, "-ldflags"))
+}
+
+// injectsLinkerVariables reports whether the strings set via -ldflags=-X
+// for variables in a package are injected at compile time rather than by the linker,
+// so that they can be obfuscated like any other string literal.
+func injectsLinkerVariables(lpkg *listedPackage) bool {
+	return lpkg.ToObfuscate && obfuscatesLiterals(lpkg)
+}
+
+// linkerStringVar returns the variable which -X sets and which is injected at compile time,
+// if the package declares one with the given name. As cmd/link only sets string variables,
+// variables of any other type are left for it to report an error.
+func linkerStringVar(pkg *types.Package, name string) *types.Var {
+	obj, _ := pkg.Scope().Lookup(name).(*types.Var)
+	if obj == nil || !types.Identical(obj.Type(), types.Typ[types.String]) {
+		return nil
+	}
+	return obj
+}
+
 // computeLinkerVariableStrings iterates over the -ldflags arguments,
-// filling a map with all the string values set via the linker's -X flag.
-// TODO: can we put this in sharedCache, using the obfuscated object name as a key?
+// filling a map with all the string values set via the linker's -X flag
+// for variables declared in the current package.
+//
+// Note that, since these values are injected at compile time,
+// they are part of the package's inputs; see [linkerVariablesOverlay].
 func computeLinkerVariableStrings(pkg *types.Package) (map[*types.Var]string, error) {
 	linkerVariableStrings := make(map[*types.Var]string)
-
-	// TODO: this is a linker flag that affects how we obfuscate a package at
-	// compile time. Note that, if the user changes ldflags, then Go may only
-	// re-link the final binary, without re-compiling any packages at all.
-	// It's possible that this could result in:
-	//
-	//    garble -literals build -ldflags=-X=pkg.name=before # name="before"
-	//    garble -literals build -ldflags=-X=pkg.name=after  # name="before" as cached
-	//
-	// We haven't been able to reproduce this problem for now,
-	// but it's worth noting it and keeping an eye out for it in the future.
-	// If we do confirm this theoretical bug,
-	// the solution will be to either find a different solution for -literals,
-	// or to force including -ldflags into the build cache key.
-	ldflags, err := cmdgoQuotedSplit(flagValue(sharedCache.ForwardBuildFlags, "-ldflags"))
+	ldflags, err := buildLdflags()
 	if err != nil {
 		return nil, err
 	}
-	for val := range flagValues(ldflags, "-X") {
-		// val is in the form of "foo.com/bar.name=value".
-		fullName, stringValue, found := strings.Cut(val, "=")
-		if !found {
-			continue // invalid
+	for v := range linkerVariables(ldflags) {
+		if !v.inPackage(pkg.Path(), pkg.Name()) {
+			continue // not the current package
+		}
+		if obj := linkerStringVar(pkg, v.name); obj != nil {
+			linkerVariableStrings[obj] = v.value
 		}
+	}
+	return linkerVariableStrings, nil
+}
 
-		// fullName is "foo.com/bar.name"
-		i := strings.LastIndexByte(fullName, '.')
-		path, name := fullName[:i], fullName[i+1:]
+// linkerVariablesOverlayName is the Go file added to the packages
+// whose -ldflags=-X strings are injected at compile time.
+const linkerVariablesOverlayName = "garble_ldflags.go"
 
-		// Note that package main always has import path "main" as part of a build.
-		if path != pkg.Path() && (path != "main" || pkg.Name() != "main") {
-			continue // not the current package
+// linkerVariablesOverlay writes an overlay file for "go build -overlay",
+// adding a Go file to each package whose -ldflags=-X strings are injected
+// at compile time, and returns its path, or an empty string if there are none.
+//
+// cmd/go only re-links when -ldflags change, so it would reuse the compiled
+// packages with the old strings. The added file holds a hash of the strings
+// and nothing else, which makes cmd/go recompile only those packages.
+// Since the user may also pass -overlay, their replacements are kept.
+func linkerVariablesOverlay(dir string) (string, error) {
+	if !mayObfuscateLiterals() {
+		return "", nil
+	}
+	ldflags, err := buildLdflags()
+	if err != nil {
+		return "", err
+	}
+	vars := slices.Collect(linkerVariables(ldflags))
+	if len(vars) == 0 {
+		return "", nil
+	}
+	var overlay struct{ Replace map[string]string }
+	if path := flagValue(sharedCache.ForwardBuildFlags, "-overlay"); path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return "", err
 		}
-
-		obj, _ := pkg.Scope().Lookup(name).(*types.Var)
-		if obj == nil {
-			continue // no such variable; skip
+		if err := json.Unmarshal(data, &overlay); err != nil {
+			return "", fmt.Errorf("cannot parse -overlay file %s: %v", path, err)
 		}
-		linkerVariableStrings[obj] = stringValue
 	}
-	return linkerVariableStrings, nil
+	if overlay.Replace == nil {
+		overlay.Replace = make(map[string]string)
+	}
+	added := 0
+	listed := sharedCache.ListedPackages.all()
+	for _, path := range slices.Sorted(maps.Keys(listed)) {
+		lpkg := listed[path]
+		// Test variants like "foo [foo.test]" share the directory with "foo",
+		// and test main packages like "foo.test" are generated by cmd/go.
+		if lpkg.ForTest != "" || strings.HasSuffix(path, ".test") ||
+			len(lpkg.CompiledGoFiles) == 0 || !injectsLinkerVariables(lpkg) {
+			continue
+		}
+		var strs []byte
+		for _, v := range vars {
+			if v.inPackage(lpkg.ImportPath, lpkg.Name) {
+				strs = fmt.Appendf(strs, " -X=%s=%s", v.name, v.value)
+			}
+		}
+		if strs == nil {
+			continue
+		}
+		src := fmt.Sprintf("// Code generated by garble. DO NOT EDIT.\n\npackage %s\n\n// -ldflags=-X strings: %x\n",
+			lpkg.Name, sha256.Sum256(strs))
+		file := filepath.Join(dir, "ldflags", strconv.Itoa(added), linkerVariablesOverlayName)
+		if err := os.MkdirAll(filepath.Dir(file), 0o777); err != nil {
+			return "", err
+		}
+		if err := os.WriteFile(file, []byte(src), 0o666); err != nil {
+			return "", err
+		}
+		overlay.Replace[filepath.Join(lpkg.Dir, linkerVariablesOverlayName)] = file
+		added++
+	}
+	if added == 0 {
+		return "", nil
+	}
+	overlayPath := filepath.Join(dir, "overlay.json")
+	data, err := json.Marshal(overlay)
+	if err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(overlayPath, data, 0o666); err != nil {
+		return "", err
+	}
+	return overlayPath, nil
 }
 
 // typecheck type-checks the package, populating only the [types.Info] maps that
@@ -284,9 +403,28 @@ type transformer struct {
 
 	// linkerVariableStrings records objects for variables used in -ldflags=-X flags,
 	// as well as the strings the user wants to inject them with.
-	// Used when obfuscating literals, so that we obfuscate the injected value.
+	// Used when obfuscating literals, so that we inject and obfuscate the values
+	// in the variable declarations themselves.
 	linkerVariableStrings map[*types.Var]string
 
+	// literalCache is set when some literals of curPkg are decoded only once,
+	// via -cacheliterals or the directive. See [transformer.literalCacheConfig].
+	literalCache *literals.CacheConfig
+
+	// literalPool shares the obfuscation of the strings repeated across curPkg.
+	literalPool *literals.Pool
+
+	// literalsSkipped counts the literals of curPkg left alone due to their size.
+	literalsSkipped literals.SkippedSizes
+
+	// hotFunc, if not nil, reports whether a function in curPkg is on the hot path
+	// according to the profile given via -pgo. See [transformer.loadHotFunc].
+	hotFunc func(*ast.FuncDecl) bool
+
+	// keptObjects holds the objects of each package kept via //garble:keep.
+	// See [transformer.keptObject].
+	keptObjects map[*types.Package]map[types.Object]bool
+
 	// fieldToStruct helps locate struct types from any of their field
 	// objects. Useful when obfuscating field names. See [computeFieldToStruct].
 	fieldToStruct map[*types.Var]*types.Struct
@@ -303,8 +441,11 @@ type transformer struct {
 	// decisions on how to obfuscate our input code.
 	origImporter importerWithMap
 
+	// mapping records how curPkg is obfuscated for -mapfile.
+	// It is nil when the flag is not set or curPkg is not obfuscated.
+	mapping *mapFilePackage
+
 	// usedAllImportsFiles is used to prevent multiple calls of tf.useAllImports function on one file
-	// in case of simultaneously applied control flow and literals obfuscation
 	usedAllImportsFiles map[*ast.File]bool
 }
 
@@ -661,7 +802,7 @@ func (tf *transformer) replaceAsmNames(buf *bytes.Buffer, remaining []byte) {
 		name := string(remaining[:nameEnd])
 		remaining = remaining[nameEnd:]
 
-		if lpkg.ToObfuscate && !compilerIntrinsics[lpkg.ImportPath][name] {
+		if lpkg.ToObfuscate && !compilerIntrinsics[lpkg.ImportPath][name] && !lpkg.GarbleKeep[name] {
 			newName := hashWithPackage(lpkg, name)
 			if flagDebug { // TODO(mvdan): remove once https://go.dev/issue/53465 if fixed
 				log.Printf("asm name %q hashed with %x to %q", name, tf.curPkg.GarbleActionID, newName)
@@ -701,6 +842,19 @@ func (tf *transformer) writeSourceFile(basename, obfuscated string, content []by
 	return dstPath, nil
 }
 
+// checkVirtualized fails if any function asks to be virtualized without -controlflow,
+// as the function would otherwise be left as plain code without any warning.
+func checkVirtualized(files []*ast.File) error {
+	for _, file := range files {
+		for _, decl := range file.Decls {
+			if decl, ok := decl.(*ast.FuncDecl); ok && ah.HasDirective(decl.Doc, ctrlflow.VirtualizeDirective) {
+				return fmt.Errorf("%s: %s requires -controlflow", fset.Position(decl.Pos()), ctrlflow.VirtualizeDirective)
+			}
+		}
+	}
+	return nil
+}
+
 func (tf *transformer) transformCompile(args []string) ([]string, error) {
 	flags, paths := splitFlagsFromFiles(args, ".go")
 	var debugArtifacts cachedDebugArtifacts
@@ -720,6 +874,10 @@ func (tf *transformer) transformCompile(args []string) ([]string, error) {
 		}
 	}
 
+	if flagMapFile != "" && tf.curPkg.ToObfuscate {
+		tf.mapping = newMapFilePackage(tf.curPkg)
+	}
+
 	// We will force the linker to drop DWARF via -w, so don't spend time
 	// generating it.
 	flags = append(flags, "-dwarf=false")
@@ -745,19 +903,61 @@ func (tf *transformer) transformCompile(args []string) ([]string, error) {
 	// to miss on a package and for our cache to hit.
 	// The go/ssa builder needs Selections and Instances; we build SSA for control
 	// flow obfuscation, and in computePkgCache for reflect-importing packages.
-	withSSAInfo := flagControlFlow || tf.curPkg.hasDep("reflect")
+	withSSAInfo := flagControlFlow.enabled() || tf.curPkg.hasDep("reflect") || tf.curPkg.hasReflectHints()
 	if tf.pkg, tf.info, err = typecheck(tf.curPkg.ImportPath, files, tf.origImporter, withSSAInfo); err != nil {
 		return nil, err
 	}
 
-	var (
-		ssaPkg       *ssa.Package
-		requiredPkgs []string
-	)
-	if flagControlFlow {
+	var requiredPkgs []string
+	if flagEmbed && tf.curPkg.ToObfuscate && !tf.curPkg.Standard {
+		var newFile *ast.File
+		if flags, newFile, err = tf.obfuscateEmbeds(flags, files); err != nil {
+			return nil, err
+		}
+		if newFile != nil {
+			files = append(files, newFile)
+			paths = append(paths, embedFileName)
+			// The code decrypting the files imports indirect dependencies of embed.
+			for _, imp := range newFile.Imports {
+				path, err := strconv.Unquote(imp.Path.Value)
+				if err != nil {
+					panic(err) // should never happen
+				}
+				requiredPkgs = append(requiredPkgs, path)
+			}
+			if tf.pkg, tf.info, err = typecheck(tf.curPkg.ImportPath, files, tf.origImporter, withSSAInfo); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if tf.hotFunc, err = tf.loadHotFunc(flags); err != nil {
+		return nil, err
+	}
+
+	var ssaPkg *ssa.Package
+	if flagControlFlow.enabled() {
 		ssaPkg = ssaBuildPkg(tf.pkg, files, tf.info)
 
-		newFileName, newFile, affectedFiles, err := ctrlflow.Obfuscate(fset, ssaPkg, files, tf.obfRand)
+		cfg := ctrlflow.Config{
+			Mode:          flagControlFlow.mode,
+			DefaultParams: flagControlFlow.params,
+			Hot:           tf.hotFunc,
+		}
+		// Only obfuscate functions without the directive in the packages
+		// the user chose to obfuscate, and never in std.
+		if !tf.curPkg.ToObfuscate || tf.curPkg.Standard {
+			cfg.Mode = ctrlflow.ModeAnnotated
+		}
+		// Leave the code we inject into main packages alone,
+		// as it runs while the runtime resolves type names.
+		if injected := reflectInjectedPos(files); injected.IsValid() {
+			cfg.Skip = func(decl *ast.FuncDecl) bool {
+				file := fset.File(injected)
+				return file == fset.File(decl.Pos()) && decl.Pos() >= injected
+			}
+		}
+		newFileName, newFile, err := ctrlflow.Obfuscate(fset, ssaPkg, files, tf.info, tf.obfRand, cfg)
 		if err != nil {
 			return nil, err
 		}
@@ -765,9 +965,6 @@ func (tf *transformer) transformCompile(args []string) ([]string, error) {
 		if newFile != nil {
 			files = append(files, newFile)
 			paths = append(paths, newFileName)
-			for _, file := range affectedFiles {
-				tf.useAllImports(file)
-			}
 			if tf.pkg, tf.info, err = typecheck(tf.curPkg.ImportPath, files, tf.origImporter, false); err != nil {
 				return nil, err
 			}
@@ -780,6 +977,8 @@ func (tf *transformer) transformCompile(args []string) ([]string, error) {
 				requiredPkgs = append(requiredPkgs, path)
 			}
 		}
+	} else if err := checkVirtualized(files); err != nil {
+		return nil, err
 	}
 
 	if tf.curPkgCache, err = loadPkgCache(tf.curPkg, tf.pkg, files, tf.info, ssaPkg); err != nil {
@@ -788,12 +987,21 @@ func (tf *transformer) transformCompile(args []string) ([]string, error) {
 
 	// These maps are not kept in pkgCache, since they are only needed to obfuscate curPkg.
 	tf.fieldToStruct = computeFieldToStruct(tf.info)
-	if flagLiterals {
+	if injectsLinkerVariables(tf.curPkg) {
 		if tf.linkerVariableStrings, err = computeLinkerVariableStrings(tf.pkg); err != nil {
 			return nil, err
 		}
 	}
 
+	if tf.literalCache, err = tf.literalCacheConfig(files); err != nil {
+		return nil, err
+	} else if tf.literalCache != nil {
+		requiredPkgs = append(requiredPkgs, "sync")
+	}
+	if obfuscatesLiterals(tf.curPkg) && tf.curPkg.ToObfuscate {
+		tf.literalPool = literals.NewPool(files, tf.info)
+	}
+
 	if len(tf.curPkg.SFiles) > 0 && tf.curPkg.ToObfuscate {
 		if err := tf.saveGoAsmNames(); err != nil {
 			return nil, err
@@ -836,7 +1044,7 @@ func (tf *transformer) transformCompile(args []string) ([]string, error) {
 		file = tf.transformGoFile(file)
 		file.Name.Name = tf.curPkg.obfuscatedPackageName()
 
-		src, err := printFile(tf.curPkg, file)
+		src, err := printFile(tf.curPkg, file, tf.mapping)
 		if err != nil {
 			return nil, err
 		}
@@ -853,15 +1061,23 @@ func (tf *transformer) transformCompile(args []string) ([]string, error) {
 			newPaths = append(newPaths, path)
 		}
 		if flagDebugDir != "" {
-			debugArtifacts.GarbledFiles[basename] = src
+			// src may point into a buffer reused by printFile.
+			debugArtifacts.GarbledFiles[basename] = bytes.Clone(src)
 		}
 	}
 	if tf.curPkg.ImportPath == "runtime" && flagTiny {
 		validateDirectRuntimeStripping(runtimeStrippedByFile)
 	}
+	if skipped := tf.literalsSkipped; skipped.Short > 0 || skipped.Long > 0 {
+		log.Printf("literals in %s not obfuscated due to their size: %d under %d bytes, %d over %d bytes",
+			tf.curPkg.ImportPath, skipped.Short, flagLiteralsMin, skipped.Long, literals.MaxSize)
+	}
 	if err := saveDebugArtifactsForPkg(tf.curPkg, debugCacheKindCompile, debugArtifacts); err != nil {
 		return nil, err
 	}
+	if err := saveMapFileForPkg(tf.curPkg, tf.mapping); err != nil {
+		return nil, err
+	}
 	flags = flagSetValue(flags, "-importcfg", newImportCfg)
 
 	return append(flags, newPaths...), nil
@@ -1002,22 +1218,28 @@ func (tf *transformer) transformLinkname(localName, newName string) (string, str
 
 	var newForeignName string
 	if receiver, name, ok := strings.Cut(foreignName, "."); ok {
-		if receiver, ok = strings.CutPrefix(receiver, "(*"); ok {
-			// pkg/path.(*Receiver).method
+		// pkg/path.Receiver.method or pkg/path.(*Receiver).method
+		receiver, ptr := strings.CutPrefix(receiver, "(*")
+		if ptr {
 			receiver, _ = strings.CutSuffix(receiver, ")")
-			receiver = "(*" + hashWithPackage(lpkg, receiver) + ")"
-		} else {
-			// pkg/path.Receiver.method
-			receiver = hashWithPackage(lpkg, receiver)
 		}
-		// Exported methods are never obfuscated.
+		// Exported methods are only obfuscated with -methods.
 		//
 		// TODO(mvdan): We're duplicating the logic behind these decisions.
 		// Reuse the logic with transformCompile.
-		if !token.IsExported(name) {
+		if (!token.IsExported(name) || obfuscatesExportedMethod(lpkg.ImportPath, name)) && !lpkg.GarbleKeep[receiver+"."+name] {
 			name = hashWithPackage(lpkg, name)
 		}
+		if !lpkg.GarbleKeep[receiver] {
+			receiver = hashWithPackage(lpkg, receiver)
+		}
+		if ptr {
+			receiver = "(*" + receiver + ")"
+		}
 		newForeignName = receiver + "." + name
+	} else if lpkg.GarbleKeep[foreignName] {
+		// pkg/path.function kept via //garble:keep
+		newForeignName = foreignName
 	} else {
 		// pkg/path.function
 		newForeignName = hashWithPackage(lpkg, foreignName)
@@ -1296,6 +1518,9 @@ func (tf *transformer) obfuscatedObjectName(obj types.Object) (string, bool) {
 	if !lpkg.ToObfuscate {
 		return "", false // we're not obfuscating this package
 	}
+	if tf.keptObject(lpkg, obj) {
+		return "", false // kept via //garble:keep
+	}
 	debugName := "variable"
 
 	// log.Printf("%s: %#v %T", fset.Position(node.Pos()), node, obj)
@@ -1344,7 +1569,9 @@ func (tf *transformer) obfuscatedObjectName(obj types.Object) (string, bool) {
 			debugName = "method"
 		}
 		if obj.Exported() && sign.Recv() != nil {
-			return "", false // might implement an interface
+			if types.IsInterface(sign.Recv().Type()) || !obfuscatesExportedMethod(path, name) {
+				return "", false // might implement an interface
+			}
 		}
 		switch name {
 		case "main", "init", "TestMain":
@@ -1365,6 +1592,79 @@ func (tf *transformer) obfuscatedObjectName(obj types.Object) (string, bool) {
 	return newName, true
 }
 
+// literalCacheConfig returns how to cache the literals of curPkg,
+// or nil if none of them are decoded only once.
+//
+// The cached literals are guarded by sync.Once, so they are only supported
+// in packages which depend on sync, which covers most packages using strings.
+// We can't add new dependencies, as the build is already planned.
+// Packages without sync are left alone by -cacheliterals,
+// but asking for it via the directive is an error.
+func (tf *transformer) literalCacheConfig(files []*ast.File) (*literals.CacheConfig, error) {
+	if !obfuscatesLiterals(tf.curPkg) || !tf.curPkg.ToObfuscate {
+		return nil, nil
+	}
+	directivePos := token.NoPos
+	for _, file := range files {
+		if directivePos = cacheLiteralsDirectivePos(file); directivePos.IsValid() {
+			break
+		}
+	}
+	if !flagCacheLiterals && !directivePos.IsValid() {
+		return nil, nil
+	}
+	if !tf.curPkg.hasDep("sync") {
+		if directivePos.IsValid() {
+			return nil, fmt.Errorf("%s: %s requires the package to depend on sync", fset.Position(directivePos), directiveCacheLiterals)
+		}
+		log.Printf("not caching literals, as %s does not depend on sync", tf.curPkg.ImportPath)
+		return nil, nil
+	}
+	syncPkg, err := tf.origImporter.ImportFrom("sync", tf.curPkg.Dir, 0)
+	if err != nil {
+		return nil, err
+	}
+	return &literals.CacheConfig{All: flagCacheLiterals, Sync: syncPkg}, nil
+}
+
+// loadHotFunc returns whether each function in curPkg is on the hot path,
+// according to the profile which cmd/go passes to the compiler when building with -pgo,
+// or nil if there is no profile or neither literals nor control flow are obfuscated.
+//
+// Note that the profile should come from a binary built without garble,
+// as the names of the obfuscated functions would not match.
+func (tf *transformer) loadHotFunc(flags []string) (func(*ast.FuncDecl) bool, error) {
+	path := flagValue(flags, "-pgoprofile")
+	if path == "" || (!flagControlFlow.enabled() && !(obfuscatesLiterals(tf.curPkg) && tf.curPkg.ToObfuscate)) {
+		return nil, nil
+	}
+	profile, err := pgo.Load(path)
+	if err != nil {
+		return nil, err
+	}
+	// Symbols in profiles use the package path given to the compiler,
+	// which is "main" for main packages.
+	symPath := flagValue(flags, "-p")
+	return func(decl *ast.FuncDecl) bool {
+		return profile.Hot(symPath, decl)
+	}, nil
+}
+
+// cacheLiteralsDirectivePos returns the position of the doc comment with
+// the [directiveCacheLiterals] directive in a file or any of its functions,
+// if there is one.
+func cacheLiteralsDirectivePos(file *ast.File) token.Pos {
+	if ah.HasDirective(file.Doc, directiveCacheLiterals) {
+		return file.Doc.Pos()
+	}
+	for _, decl := range file.Decls {
+		if decl, ok := decl.(*ast.FuncDecl); ok && ah.HasDirective(decl.Doc, directiveCacheLiterals) {
+			return decl.Doc.Pos()
+		}
+	}
+	return token.NoPos
+}
+
 // transformGoFile obfuscates the provided Go syntax file.
 func (tf *transformer) transformGoFile(file *ast.File) *ast.File {
 	// Only obfuscate the literals here if the flag is on
@@ -1373,13 +1673,25 @@ func (tf *transformer) transformGoFile(file *ast.File) *ast.File {
 	// We can't obfuscate literals in the runtime and its dependencies,
 	// because obfuscated literals sometimes escape to heap,
 	// and that's not allowed in the runtime itself.
-	if flagLiterals && tf.curPkg.ToObfuscate {
-		file = literals.Obfuscate(tf.obfRand, file, tf.info, tf.linkerVariableStrings, randomName)
+	if obfuscatesLiterals(tf.curPkg) && tf.curPkg.ToObfuscate {
+		file = literals.Obfuscate(tf.obfRand, file, tf.info, tf.linkerVariableStrings, literals.Config{
+			Cache:   tf.literalCache,
+			Weights: obfuscatorWeights(tf.curPkg),
+			Pool:    tf.literalPool,
+			Hot:     tf.hotFunc,
+			MinSize: int(flagLiteralsMin),
+			Skipped: &tf.literalsSkipped,
+		}, randomName)
 
 		// some imported constants might not be needed anymore, remove unnecessary imports
 		tf.useAllImports(file)
 	}
+	return tf.transformNames(file)
+}
 
+// transformNames obfuscates the names and import paths in the provided Go syntax file,
+// recording the obfuscated names in tf.mapping.
+func (tf *transformer) transformNames(file *ast.File) *ast.File {
 	pre := func(cursor *astutil.Cursor) bool {
 		node, ok := cursor.Node().(*ast.Ident)
 		if !ok {
@@ -1432,6 +1744,7 @@ func (tf *transformer) transformGoFile(file *ast.File) *ast.File {
 
 		if newName, ok := tf.obfuscatedObjectName(obj); ok {
 			node.Name = newName
+			tf.mapping.recordName(obj, name, newName)
 		}
 		return true
 	}
@@ -1476,28 +1789,28 @@ func (tf *transformer) transformLink(args []string) ([]string, error) {
 		return nil, err
 	}
 
-	// TODO: unify this logic with the -X handling when using -literals.
-	// We should be able to handle both cases via the syntax tree.
-	//
 	// Make sure -X works with obfuscated identifiers.
 	// To cover both obfuscated and non-obfuscated names,
 	// duplicate each flag with a obfuscated version.
-	for val := range flagValues(flags, "-X") {
-		// val is in the form of "foo.com/bar.name=value".
-		fullName, stringValue, found := strings.Cut(val, "=")
-		if !found {
-			continue // invalid
-		}
-
-		// fullName is "foo.com/bar.name"
-		i := strings.LastIndexByte(fullName, '.')
-		path, name := fullName[:i], fullName[i+1:]
-
+	//
+	// Packages obfuscating literals already had the strings injected
+	// into the variable declarations at compile time; see [computeLinkerVariableStrings].
+	// Drop their flags, so that the linker does not add the strings in plain text.
+	// Flags for variables which were not injected, such as those of a named string type,
+	// are kept so that the linker still reports them as errors.
+	linkerVars := slices.Collect(linkerVariables(flags))
+	flags = flagDeleteAll(flags, "-X")
+	injectedPkgs := make(map[*listedPackage]*types.Package)
+	for _, v := range linkerVars {
 		// If the package path is "main", it's the current top-level
 		// package we are linking. Otherwise, find it in the cache.
+		// Test binaries link the test variant of a package, if there is one.
 		lpkg := tf.curPkg
-		if path != "main" {
-			lpkg, _ = sharedCache.ListedPackages.get(path)
+		if v.path != "main" {
+			lpkg, _ = sharedCache.ListedPackages.get(v.path + " [" + tf.curPkg.ImportPath + "]")
+			if lpkg == nil {
+				lpkg, _ = sharedCache.ListedPackages.get(v.path)
+			}
 		}
 		if lpkg == nil {
 			// We couldn't find the package.
@@ -1505,8 +1818,28 @@ func (tf *transformer) transformLink(args []string) ([]string, error) {
 			// cmd/link ignores those, so we should too.
 			continue
 		}
-		newName := hashWithPackage(lpkg, name)
-		flags = append(flags, fmt.Sprintf("-X=%s.%s=%s", lpkg.obfuscatedImportPath(), newName, stringValue))
+		if injectsLinkerVariables(lpkg) {
+			// Unexported variables are not in the export data,
+			// so type-check the package to tell which variables were injected.
+			pkg := injectedPkgs[lpkg]
+			if pkg == nil {
+				files, err := parseFiles(lpkg, lpkg.Dir, lpkg.CompiledGoFiles, false)
+				if err != nil {
+					return nil, err
+				}
+				if pkg, _, err = typecheck(lpkg.ImportPath, files, importerForPkg(lpkg), false); err != nil {
+					return nil, err
+				}
+				injectedPkgs[lpkg] = pkg
+			}
+			if linkerStringVar(pkg, v.name) != nil {
+				continue
+			}
+		}
+		flags = append(flags,
+			fmt.Sprintf("-X=%s.%s=%s", v.path, v.name, v.value),
+			fmt.Sprintf("-X=%s.%s=%s", lpkg.obfuscatedImportPath(), hashWithPackage(lpkg, v.name), v.value),
+		)
 	}
 
 	// Starting in Go 1.17, Go's version is implicitly injected by the linker.